@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"gourbot/internal/config"
+)
+
+// showConfig prints the effective configuration for "gourbot config show [flags]".
+func showConfig(args []string) error {
+	cfg, err := config.Load(args...)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	return cfg.Show(os.Stdout)
+}
+
+// checkConfig validates the configuration for "gourbot config check [flags]" and fails if
+// there are problems, for use in deploy scripts.
+func checkConfig(args []string) error {
+	cfg, err := config.Load(args...)
+	if err == nil {
+		err = cfg.Validate()
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Println("Configuration is valid.")
+	return nil
+}
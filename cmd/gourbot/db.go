@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"gourbot/internal/config"
+	"gourbot/internal/storage"
+)
+
+// migrateDB creates or migrates the database for "gourbot db migrate"; opening the
+// storage does the work.
+func migrateDB(args []string) error {
+	_, store, rest, err := openStorage(args)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	if len(rest) > 0 {
+		return fmt.Errorf("unexpected argument %q", rest[0])
+	}
+	version, err := store.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Database is at schema version %d.\n", version)
+	return nil
+}
+
+// vacuumDB rebuilds the database file for "gourbot db vacuum".
+func vacuumDB(args []string) error {
+	_, store, rest, err := openStorage(args)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	if len(rest) > 0 {
+		return fmt.Errorf("unexpected argument %q", rest[0])
+	}
+	return store.Vacuum()
+}
+
+// backupDB copies the database for "gourbot db backup [file]". The file defaults to a new
+// backup in the backup directory, e.g. backups/gourbot-20240102-150405.sqlite, which
+// counts for the rotation of the scheduled backups.
+func backupDB(args []string) error {
+	cfg, store, rest, err := openStorage(args)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	if len(rest) > 1 {
+		return fmt.Errorf("unexpected argument %q", rest[1])
+	}
+	filename := storage.BackupName(cfg.DbPath, cfg.BackupDir, time.Now())
+	if len(rest) == 1 {
+		filename = rest[0]
+	} else if err := os.MkdirAll(cfg.BackupDir, 0o700); err != nil {
+		return err
+	}
+	if err := store.Backup(filename); err != nil {
+		return err
+	}
+	fmt.Printf("Database copied to %s.\n", filename)
+	return nil
+}
+
+// restoreDB replaces the database with a backup for "gourbot db restore <file>" after
+// checking that the file is a gourbot database of a supported schema version, and then
+// migrates it. It refuses to run while the bot has the database open.
+func restoreDB(args []string) error {
+	cfg, rest, err := config.LoadArgs(args)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	if len(rest) != 1 {
+		return fmt.Errorf("usage: gourbot db restore [flags] <file>")
+	}
+	version, err := storage.CheckBackup(rest[0])
+	if err != nil {
+		return err
+	}
+	kept, err := storage.Restore(rest[0], cfg.DbPath)
+	if kept != "" {
+		fmt.Printf("The replaced database is kept as %s.\n", kept)
+	}
+	if err != nil {
+		return err
+	}
+	store := storage.NewStorage(cfg)
+	if err := store.Open(); err != nil {
+		return fmt.Errorf("failed to open the restored database: %w", err)
+	}
+	defer store.Close()
+	fmt.Printf("Restored %s (schema version %d) to %s, now at schema version %d.\n", rest[0], version, cfg.DbPath, storage.SchemaVersion)
+	return nil
+}
+
+// exportDB writes all rows as JSON lines for "gourbot db export [file]", to stdout
+// without a file.
+func exportDB(args []string) error {
+	_, store, rest, err := openStorage(args)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	if len(rest) > 1 {
+		return fmt.Errorf("unexpected argument %q", rest[1])
+	}
+	if len(rest) == 0 {
+		return store.Export(os.Stdout)
+	}
+	file, err := os.OpenFile(rest[0], os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	err = store.Export(file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -2,20 +2,109 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"strings"
 
 	"gourbot/internal/config"
 	"gourbot/internal/logger"
+	"gourbot/internal/storage"
 	"gourbot/internal/tgbot"
+	"gourbot/internal/types"
 )
 
+// command is a subcommand of gourbot; it gets the arguments after its name, starting with
+// the configuration flags.
+type command func(args []string) error
+
+// commands maps the names of the subcommands, with subcommands of their own joined by a space.
+var commands = map[string]command{
+	"serve":         serve,
+	"users list":    listUsers,
+	"users grant":   grantUser,
+	"users approve": approveUser,
+	"users revoke":  revokeUser,
+	"db migrate":    migrateDB,
+	"db vacuum":     vacuumDB,
+	"db backup":     backupDB,
+	"db restore":    restoreDB,
+	"db export":     exportDB,
+	"config show":   showConfig,
+	"config check":  checkConfig,
+	"replay":        replay,
+	"version":       version,
+}
+
+const usage = `Usage: gourbot [command] [flags] [arguments]
+
+Commands:
+  serve                          run the bot (the default without a command)
+  users list                     list the known users and their permissions
+  users grant <id> <perm>...     grant permissions to a user
+  users approve <id> [perm...]   grant CanChat or the given permissions to a user
+  users revoke <id> [perm...]    revoke all or the given permissions of a user
+  db migrate                     create or migrate the database to the current schema
+  db vacuum                      rebuild the database file to reclaim space
+  db backup [file]               copy the database while the bot may be running
+  db restore <file>              replace the database with a backup, the bot must be stopped
+  db export [file]               write all rows as JSON lines to the file or stdout
+  config show                    print the effective configuration and its sources
+  config check                   validate the configuration, exit status 1 on problems
+  replay [-chat id] [-after uid] [-limit n]
+                                 print the recorded Telegram traffic
+  version                        print the version of gourbot
+
+Every command accepts the configuration flags, e.g. -config gourbot.yaml; they come
+before the arguments of the command. See docs/configuration.md.
+`
+
 func main() {
+	name, args := commandName(os.Args[1:])
+	if name == "help" {
+		fmt.Print(usage)
+		return
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command %q.\n\n%s", name, usage)
+		os.Exit(2)
+	}
+	if err := cmd(args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// commandName splits the command name off the arguments. Without a command, or with only
+// flags, the command is serve; a group such as "users" without a subcommand is help.
+func commandName(args []string) (string, []string) {
+	if len(args) == 0 {
+		return "serve", args
+	}
+	switch args[0] {
+	case "-h", "-help", "--help":
+		return "help", nil
+	case "users", "db", "config":
+		if len(args) < 2 {
+			return "help", nil
+		}
+		return args[0] + " " + args[1], args[2:]
+	}
+	if strings.HasPrefix(args[0], "-") {
+		return "serve", args
+	}
+	return args[0], args[1:]
+}
+
+// serve runs the bot until it is stopped.
+func serve(args []string) error {
 	// Загрузка конфигурации
-	cfg, err := config.LoadConfig()
+	cfg, err := config.LoadConfig(args...)
 	if err != nil {
-		log.Fatalf("Failed to load configuration: %v", err)
+		return fmt.Errorf("failed to load configuration: %w", err)
 	}
 
 	// Инициализация логгера
@@ -31,6 +120,17 @@ func main() {
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer cancel()
 
+	// Перезагрузка конфигурации при изменении файла и по SIGHUP
+	go config.Watch(ctx, cfg.ConfigFile, func(reason string) {
+		newCfg, err := config.LoadConfig(args...)
+		if err != nil {
+			logger.Errorf("Failed to reload configuration: %v", err)
+			tgBot.Notify(types.NotifyError, fmt.Sprintf("Configuration not reloaded (%s), keeping the running one:\n%v", reason, err))
+			return
+		}
+		tgBot.ApplyConfig(newCfg, reason)
+	})
+
 	// Запуск бота
 	if err := tgBot.Start(ctx); err != nil {
 		logger.Fatalf("TgBot stopped with error: %v", err)
@@ -38,4 +138,20 @@ func main() {
 		logger.Info("TgBot finished without error")
 	}
 	logger.Info("That's all, folks!")
+	return nil
+}
+
+// openStorage loads the configuration from the flags at the start of args and opens the
+// database for the offline commands. It returns the arguments after the flags. The
+// configuration is not validated: the commands need only the database.
+func openStorage(args []string, define ...func(fs *flag.FlagSet)) (*config.Config, *storage.Storage, []string, error) {
+	cfg, rest, err := config.LoadArgs(args, define...)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+	store := storage.NewStorage(cfg)
+	if err := store.Open(); err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to open database %s: %w", cfg.DbPath, err)
+	}
+	return cfg, store, rest, nil
 }
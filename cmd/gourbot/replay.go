@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot/models"
+)
+
+// replayPage is the number of records read from the database at once.
+const replayPage = 500
+
+// replay prints the Telegram traffic recorded in the tgdump table for "gourbot replay",
+// the updates received and the messages sent in the order of recording, to retrace what
+// the bot did.
+func replay(args []string) error {
+	var chatID, after int64
+	var limit int
+	_, store, rest, err := openStorage(args, func(fs *flag.FlagSet) {
+		fs.Int64Var(&chatID, "chat", 0, "print only the traffic of this chat")
+		fs.Int64Var(&after, "after", 0, "start after the record with this number")
+		fs.IntVar(&limit, "limit", 0, "print at most this many records, 0 for all")
+	})
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	if len(rest) > 0 {
+		return fmt.Errorf("unexpected argument %q", rest[0])
+	}
+
+	printed := 0
+	for limit == 0 || printed < limit {
+		records, err := store.GetTgRecords(after, replayPage)
+		if err != nil {
+			return err
+		}
+		if len(records) == 0 {
+			break
+		}
+		for _, record := range records {
+			after = record.Uid
+			line, chat, err := describeRecord(record.Out, record.Data)
+			if err != nil {
+				fmt.Printf("%d ?? cannot decode record: %v\n", record.Uid, err)
+				continue
+			}
+			if chatID != 0 && chat != chatID {
+				continue
+			}
+			fmt.Printf("%d %s\n", record.Uid, line)
+			printed++
+			if printed == limit {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// describeRecord formats a recorded update or sent message as one line and returns the
+// chat it belongs to.
+func describeRecord(out bool, data []byte) (string, int64, error) {
+	if out {
+		var msg models.Message
+		if err := json.Unmarshal(data, &msg); err != nil {
+			return "", 0, err
+		}
+		return describeMessage(">>", &msg), msg.Chat.ID, nil
+	}
+	var update models.Update
+	if err := json.Unmarshal(data, &update); err != nil {
+		return "", 0, err
+	}
+	switch {
+	case update.Message != nil:
+		return describeMessage("<<", update.Message), update.Message.Chat.ID, nil
+	case update.EditedMessage != nil:
+		return describeMessage("<e", update.EditedMessage), update.EditedMessage.Chat.ID, nil
+	case update.ChannelPost != nil:
+		return describeMessage("<c", update.ChannelPost), update.ChannelPost.Chat.ID, nil
+	case update.CallbackQuery != nil:
+		query := update.CallbackQuery
+		chat := query.From.ID
+		if query.Message.Message != nil {
+			chat = query.Message.Message.Chat.ID
+		}
+		return fmt.Sprintf("<b chat %d from %s (%d): button %q", chat, query.From.Username, query.From.ID, query.Data), chat, nil
+	case update.InlineQuery != nil:
+		query := update.InlineQuery
+		return fmt.Sprintf("<i from %s (%d): inline %q", query.From.Username, query.From.ID, query.Query), query.From.ID, nil
+	}
+	return fmt.Sprintf("<? update %d", update.ID), 0, nil
+}
+
+// describeMessage formats a message with its direction, time, chat, sender and text.
+func describeMessage(direction string, msg *models.Message) string {
+	text := msg.Text
+	if text == "" {
+		text = msg.Caption
+	}
+	text = strings.ReplaceAll(text, "\n", " ")
+	from := ""
+	if msg.From != nil {
+		from = fmt.Sprintf(" from %s (%d)", msg.From.Username, msg.From.ID)
+	}
+	at := time.Unix(int64(msg.Date), 0).Format("2006-01-02 15:04:05")
+	return fmt.Sprintf("%s %s chat %d%s: %q", direction, at, msg.Chat.ID, from, text)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"gourbot/internal/tgbot"
+	"gourbot/internal/types"
+)
+
+// listUsers prints the known users for "gourbot users list".
+func listUsers(args []string) error {
+	_, store, rest, err := openStorage(args)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	if len(rest) > 0 {
+		return fmt.Errorf("unexpected argument %q", rest[0])
+	}
+	users, err := store.GetAllTgUsers()
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tPERMISSIONS\tSEEN")
+	for _, user := range users {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", user.Id, user.Name, user.PermissionsToString(), user.SeenAt.Format("2006-01-02 15:04"))
+	}
+	return w.Flush()
+}
+
+// grantUser grants permissions for "gourbot users grant <id> <permission>...". Unknown
+// users are added, so that a user may be allowed before they write to the bot.
+func grantUser(args []string) error {
+	return changeUser(args, func(user *types.TgUser, permissions []string) error {
+		if len(permissions) == 0 {
+			return fmt.Errorf("no permissions to grant, known are %s", strings.Join(types.KnownPermissions, ", "))
+		}
+		for _, permission := range permissions {
+			user.AddPermission(permission)
+		}
+		return nil
+	})
+}
+
+// approveUser grants CanChat or the given permissions for "gourbot users approve <id>
+// [permission...]", like the /approve command.
+func approveUser(args []string) error {
+	return changeUser(args, func(user *types.TgUser, permissions []string) error {
+		if len(permissions) == 0 {
+			permissions = []string{types.CanChat}
+		}
+		for _, permission := range permissions {
+			user.AddPermission(permission)
+		}
+		return nil
+	})
+}
+
+// revokeUser revokes all or the given permissions for "gourbot users revoke <id>
+// [permission...]", like the /revoke command.
+func revokeUser(args []string) error {
+	return changeUser(args, func(user *types.TgUser, permissions []string) error {
+		if len(permissions) == 0 {
+			user.ClearPermissions()
+		}
+		for _, permission := range permissions {
+			user.RemovePermission(permission)
+		}
+		return nil
+	})
+}
+
+// changeUser implements the commands which change the permissions of a user.
+func changeUser(args []string, change func(user *types.TgUser, permissions []string) error) error {
+	cfg, store, rest, err := openStorage(args)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	userID, permissions, err := tgbot.ParseUserPermissionArgs(strings.Join(rest, " "))
+	if err != nil {
+		return err
+	}
+	user, err := store.GetTgUser(userID)
+	exists := err == nil
+	if err == sql.ErrNoRows {
+		user, err = types.NewTgUser(userID, fmt.Sprint(userID), nil), nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := change(user, permissions); err != nil {
+		return err
+	}
+	if exists {
+		err = store.UpdateTgUser(user)
+	} else {
+		err = store.AddTgUser(user)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("User %s (%d) now has permissions [%s].\n", user.Name, user.Id, user.PermissionsToString())
+	if slices.Contains(cfg.MasterUIDs, user.Id) || slices.Contains(cfg.AdminUIDs, user.Id) {
+		fmt.Println("The user is listed in the configuration, the bot restores their permissions on start.")
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"fmt"
+
+	"gourbot/internal/buildinfo"
+)
+
+// version prints the build of gourbot for "gourbot version".
+func version(args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("unexpected argument %q", args[0])
+	}
+	fmt.Println(buildinfo.Get())
+	return nil
+}
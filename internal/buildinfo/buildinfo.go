@@ -0,0 +1,104 @@
+// Package buildinfo reports which build of gourbot is running.
+//
+// The variables are set by the Makefile with
+//
+//	-ldflags "-X gourbot/internal/buildinfo.Version=... -X gourbot/internal/buildinfo.Commit=... -X gourbot/internal/buildinfo.BuildTime=..."
+//
+// and filled from the build information of the Go toolchain when they are not.
+package buildinfo
+
+import (
+	"fmt"
+	"runtime/debug"
+	"strings"
+	"sync"
+)
+
+// Set with -ldflags -X by the Makefile.
+var (
+	Version   string // Release version, e.g. v1.2.0 or the output of git describe
+	Commit    string // VCS revision
+	BuildTime string // When the binary was built
+)
+
+// Info describes the running build.
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+	Modified  bool   `json:"modified,omitempty"` // Built from a tree with uncommitted changes
+	GoVersion string `json:"go_version"`
+}
+
+var (
+	once sync.Once
+	info Info
+)
+
+// Get returns the information about the running build.
+func Get() Info {
+	once.Do(func() {
+		info = read(Version, Commit, BuildTime, debug.ReadBuildInfo)
+	})
+	return info
+}
+
+// read combines the values set with -ldflags with the build information of the
+// toolchain, the former take precedence.
+func read(version, commit, buildTime string, readBuildInfo func() (*debug.BuildInfo, bool)) Info {
+	i := Info{Version: version, Commit: commit, BuildTime: buildTime}
+	if bi, ok := readBuildInfo(); ok {
+		i.GoVersion = bi.GoVersion
+		if i.Version == "" && bi.Main.Version != "(devel)" {
+			i.Version = bi.Main.Version
+		}
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				if i.Commit == "" {
+					i.Commit = s.Value
+				}
+			case "vcs.time":
+				if i.BuildTime == "" {
+					i.BuildTime = s.Value
+				}
+			case "vcs.modified":
+				i.Modified = s.Value == "true"
+			}
+		}
+	}
+	if i.Version == "" {
+		i.Version = "devel"
+	}
+	return i
+}
+
+// ShortCommit returns the first 12 characters of the commit, as shown by git.
+func (i Info) ShortCommit() string {
+	if len(i.Commit) > 12 {
+		return i.Commit[:12]
+	}
+	return i.Commit
+}
+
+// String formats the information on one line, e.g.
+// "gourbot v1.2.0 (0123456789ab, built 2024-01-02 15:04:05 UTC, go1.21.0)".
+func (i Info) String() string {
+	var details []string
+	if commit := i.ShortCommit(); commit != "" {
+		if i.Modified {
+			commit += "-dirty"
+		}
+		details = append(details, commit)
+	}
+	if i.BuildTime != "" {
+		details = append(details, "built "+i.BuildTime)
+	}
+	if i.GoVersion != "" {
+		details = append(details, i.GoVersion)
+	}
+	if len(details) == 0 {
+		return "gourbot " + i.Version
+	}
+	return fmt.Sprintf("gourbot %s (%s)", i.Version, strings.Join(details, ", "))
+}
@@ -0,0 +1,43 @@
+package buildinfo
+
+import (
+	"runtime/debug"
+	"testing"
+)
+
+// TestRead tests combining the ldflags values with the build information.
+// Boundary conditions:
+// - Values set with -ldflags take precedence over the build information.
+// - Without build information the version is "devel".
+// - A (devel) main module version is not reported.
+func TestRead(t *testing.T) {
+	buildInfo := func() (*debug.BuildInfo, bool) {
+		return &debug.BuildInfo{
+			GoVersion: "go1.21.0",
+			Main:      debug.Module{Version: "(devel)"},
+			Settings: []debug.BuildSetting{
+				{Key: "vcs.revision", Value: "0123456789abcdef0123"},
+				{Key: "vcs.time", Value: "2024-01-02T15:04:05Z"},
+				{Key: "vcs.modified", Value: "true"},
+			},
+		}, true
+	}
+
+	info := read("", "", "", buildInfo)
+	if info.Version != "devel" || info.Commit != "0123456789abcdef0123" || info.BuildTime != "2024-01-02T15:04:05Z" || !info.Modified {
+		t.Errorf("Unexpected info from the build information: %+v", info)
+	}
+	if got, want := info.String(), "gourbot devel (0123456789ab-dirty, built 2024-01-02T15:04:05Z, go1.21.0)"; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+
+	info = read("v1.2.0", "fedcba", "2024-02-03 10:00:00 UTC", buildInfo)
+	if info.Version != "v1.2.0" || info.Commit != "fedcba" || info.BuildTime != "2024-02-03 10:00:00 UTC" {
+		t.Errorf("Expected the ldflags values to take precedence, got %+v", info)
+	}
+
+	info = read("", "", "", func() (*debug.BuildInfo, bool) { return nil, false })
+	if info.String() != "gourbot devel" {
+		t.Errorf("Expected \"gourbot devel\" without build information, got %q", info.String())
+	}
+}
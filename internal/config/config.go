@@ -1,77 +1,245 @@
 package config
 
 import (
+	"flag"
 	"fmt"
-	"log"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
-
-	"github.com/joho/godotenv"
 )
 
+// ProviderConfig describes an OpenAI-compatible LLM endpoint such as llama.cpp, Ollama or vLLM.
+type ProviderConfig struct {
+	Name    string
+	BaseURL string
+	APIKey  Secret   // Optional, local servers usually do not check it
+	Models  []string // Models offered in /model, the first one is the provider default
+}
+
 // Config holds the application configuration.
 type Config struct {
-	OpenAIKey     string
-	TGBotToken    string
-	MasterUID     int64
-	LogFilename   string
-	LogMaxSize    int
-	LogMaxBackups int
-	LogMaxAge     int
-	LogCompress   bool
-	LogStdout     bool
-	DbPath        string
+	OpenAIKey          Secret
+	OpenAIBaseURL      string
+	OpenAIModel        string
+	OpenAIModels       []string // Chat models offered by the OpenAI provider, OpenAIModel goes first
+	Providers          []ProviderConfig
+	DefaultModel       string // Default chat model as "provider/model", empty means the first offered one
+	ImageModel         string
+	ImageEditModel     string
+	TranscribeModel    string
+	SpeechModel        string
+	SpeechVoice        string
+	TGBotToken         Secret
+	MasterUIDs         []int64 // Users with all permissions
+	AdminUIDs          []int64 // Users who may manage users and chats and stop the bot
+	AdminChatID        int64   // Group getting the notifications instead of the masters and admins; 0 means none
+	LogLevel           string  // Level of the log: error, warn, info, debug or trace
+	LogFilename        string
+	LogMaxSize         int
+	LogMaxBackups      int
+	LogMaxAge          int
+	LogCompress        bool
+	LogStdout          bool
+	DbPath             string
+	BackupSchedule     string  // Cron expression of the database backups, in the Timezone; empty disables them
+	BackupDir          string  // Directory of the database backups
+	BackupKeep         int     // Number of backups kept, older ones are deleted
+	StreamEditInterval int     // Minimal interval between streaming message edits, in milliseconds
+	UserDailyQuota     float64 // Maximal cost in USD a user may spend per day, 0 means unlimited
+	ToolsEnabled       bool    // Whether the LLM may call the bot's tools
+	ToolMaxSteps       int     // Maximal number of tool-call rounds per answer
+	HistoryMaxTokens   int     // Estimated history size in tokens that triggers summarization
+	HistoryKeepTokens  int     // Estimated size of the recent turns kept verbatim after summarization
+	SummaryModel       string  // Model used for summaries; empty means the chat's model
+	LeaveUnapproved    bool    // Whether the bot leaves groups it is added to before they are approved
+	DialogTimeout      int     // Minutes of silence after which a multi-step dialog is abandoned
+	InlineDebounce     int     // Pause in typing before an inline query is answered, in milliseconds
+	InlineCacheTTL     int     // Minutes an inline answer is reused for the same query
+	Timezone           string  // Default IANA time zone of reminders; empty means the server's one
+	BroadcastRate      int     // Messages per second sent by /broadcast
+	NotifyDigest       string  // Cron expression of the notification digest, in the Timezone
+	HealthAddr         string  // Listen address of the health endpoint, empty to disable it
+
+	ConfigFile  string            // Path of the loaded YAML config file, empty if there is none
+	sources     map[string]string // Layer every set GOURBOT_ variable came from
+	secretFiles map[string]string // Files the secrets were read from, by their variables
+	problems    []string          // Problems found while loading, reported by Validate
+}
+
+// LoadConfig loads the configuration, see Load, and validates it.
+func LoadConfig(args ...string) (*Config, error) {
+	config, err := Load(args...)
+	if err != nil {
+		return nil, err
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
 }
 
-// LoadConfig loads configuration from environment variables or .env file.
-func LoadConfig() (*Config, error) {
-	// Load .env file if it exists
-	if err := godotenv.Load(); err != nil {
-		log.Println("Warning: .env file not found, relying on environment variables")
+// Load loads the configuration from its layers, from the lowest to the highest priority:
+// defaults, the YAML config file, the .env file, environment variables and command-line flags.
+// The config file is given with -config or GOURBOT_CONFIG and defaults to <executable_name>.yaml
+// if it exists.
+func Load(args ...string) (*Config, error) {
+	config, rest, err := LoadArgs(args)
+	if err == nil && len(rest) > 0 {
+		return nil, fmt.Errorf("unexpected argument %q", rest[0])
 	}
+	return config, err
+}
 
+// LoadArgs loads the configuration like Load from the flags at the start of args and
+// returns the arguments after them, for the subcommands of gourbot. The define functions
+// add flags of the subcommand, which are parsed along with the configuration flags.
+func LoadArgs(args []string, define ...func(fs *flag.FlagSet)) (*Config, []string, error) {
 	// Determine default prefix for log and database filenames
 	execPath, err := os.Executable()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defaultPrefix := strings.TrimSuffix(execPath, filepath.Ext(execPath))
 
-	masterUID, _ := strconv.ParseInt(os.Getenv("GOURBOT_MASTER_UID"), 10, 64)
+	loadMu.Lock()
+	defer loadMu.Unlock()
+	layers, err := readLayers(args, defaultPrefix+".yaml", define...)
+	if err != nil {
+		return nil, nil, err
+	}
+	layered = layers.values
+	defer func() { layered = nil }()
 
 	config := &Config{
-		OpenAIKey:     os.Getenv("GOURBOT_OPENAI_KEY"),
-		TGBotToken:    os.Getenv("GOURBOT_TGBOT_TOKEN"),
-		MasterUID:     masterUID,
-		LogFilename:   getEnvOrDefault("GOURBOT_LOG_FILENAME", defaultPrefix+".log"),
-		LogMaxSize:    getEnvAsInt("GOURBOT_LOG_MAX_SIZE", 10),
-		LogMaxBackups: getEnvAsInt("GOURBOT_LOG_MAX_BACKUPS", 3),
-		LogMaxAge:     getEnvAsInt("GOURBOT_LOG_MAX_AGE", 28),
-		LogCompress:   getEnvAsBool("GOURBOT_LOG_COMPRESS", true),
-		LogStdout:     getEnvAsBoolFromFirstChar("GOURBOT_LOG_STDOUT", false),
-		DbPath:        getEnvOrDefault("GOURBOT_DB_PATH", defaultPrefix+".sqlite"),
+		OpenAIBaseURL:      getEnvOrDefault("GOURBOT_OPENAI_BASE_URL", "https://api.openai.com/v1"),
+		OpenAIModel:        getEnvOrDefault("GOURBOT_OPENAI_MODEL", "gpt-4o-mini"),
+		ImageModel:         getEnvOrDefault("GOURBOT_IMAGE_MODEL", "dall-e-3"),
+		ImageEditModel:     getEnvOrDefault("GOURBOT_IMAGE_EDIT_MODEL", "gpt-image-1"),
+		TranscribeModel:    getEnvOrDefault("GOURBOT_TRANSCRIBE_MODEL", "whisper-1"),
+		SpeechModel:        getEnvOrDefault("GOURBOT_SPEECH_MODEL", "tts-1"),
+		SpeechVoice:        getEnvOrDefault("GOURBOT_SPEECH_VOICE", "alloy"),
+		MasterUIDs:         getEnvAsIDList("GOURBOT_MASTER_UID"),
+		AdminUIDs:          getEnvAsIDList("GOURBOT_ADMIN_UIDS"),
+		AdminChatID:        getEnvAsInt64("GOURBOT_ADMIN_CHAT", 0),
+		LogLevel:           strings.ToLower(getEnvOrDefault("GOURBOT_LOG_LEVEL", "info")),
+		LogFilename:        getEnvOrDefault("GOURBOT_LOG_FILENAME", defaultPrefix+".log"),
+		LogMaxSize:         getEnvAsInt("GOURBOT_LOG_MAX_SIZE", 10),
+		LogMaxBackups:      getEnvAsInt("GOURBOT_LOG_MAX_BACKUPS", 3),
+		LogMaxAge:          getEnvAsInt("GOURBOT_LOG_MAX_AGE", 28),
+		LogCompress:        getEnvAsBool("GOURBOT_LOG_COMPRESS", true),
+		LogStdout:          getEnvAsBoolFromFirstChar("GOURBOT_LOG_STDOUT", false),
+		DbPath:             getEnvOrDefault("GOURBOT_DB_PATH", defaultPrefix+".sqlite"),
+		BackupSchedule:     getEnvOrDefault("GOURBOT_BACKUP_SCHEDULE", "30 3 * * *"),
+		BackupDir:          getEnv("GOURBOT_BACKUP_DIR"),
+		BackupKeep:         getEnvAsInt("GOURBOT_BACKUP_KEEP", 7),
+		StreamEditInterval: getEnvAsInt("GOURBOT_STREAM_EDIT_INTERVAL", 1500),
+		UserDailyQuota:     getEnvAsFloat("GOURBOT_USER_DAILY_QUOTA", 1.0),
+		ToolsEnabled:       getEnvAsBool("GOURBOT_LLM_TOOLS", true),
+		ToolMaxSteps:       getEnvAsInt("GOURBOT_LLM_TOOL_MAX_STEPS", 5),
+		HistoryMaxTokens:   getEnvAsInt("GOURBOT_HISTORY_MAX_TOKENS", 4000),
+		HistoryKeepTokens:  getEnvAsInt("GOURBOT_HISTORY_KEEP_TOKENS", 1500),
+		SummaryModel:       getEnv("GOURBOT_SUMMARY_MODEL"),
+		LeaveUnapproved:    getEnvAsBool("GOURBOT_LEAVE_UNAPPROVED", false),
+		DialogTimeout:      getEnvAsInt("GOURBOT_DIALOG_TIMEOUT", 10),
+		InlineDebounce:     getEnvAsInt("GOURBOT_INLINE_DEBOUNCE", 700),
+		InlineCacheTTL:     getEnvAsInt("GOURBOT_INLINE_CACHE_TTL", 60),
+		Timezone:           getEnv("GOURBOT_TIMEZONE"),
+		BroadcastRate:      getEnvAsInt("GOURBOT_BROADCAST_RATE", 20),
+		NotifyDigest:       getEnvOrDefault("GOURBOT_NOTIFY_DIGEST", "0 9 * * *"),
+		HealthAddr:         getEnv("GOURBOT_HEALTH_ADDR"),
 	}
 
-	// Validate required fields
-	if config.OpenAIKey == "" || config.TGBotToken == "" {
-		return nil, fmt.Errorf("missing required environment variables: GOURBOT_OPENAI_KEY, GOURBOT_TGBOT_TOKEN")
+	if config.BackupDir == "" {
+		config.BackupDir = filepath.Join(filepath.Dir(config.DbPath), "backups")
 	}
+	config.ConfigFile = layers.file
+	config.sources = layers.sources
+	config.secretFiles = make(map[string]string)
+	config.problems = layers.problems
+	config.TGBotToken = config.getSecret("telegram.token", "GOURBOT_TGBOT_TOKEN")
+	config.OpenAIKey = config.getSecret("llm.openai_key", "GOURBOT_OPENAI_KEY")
 
-	return config, nil
+	config.OpenAIModels = []string{config.OpenAIModel}
+	for _, model := range getEnvAsList("GOURBOT_OPENAI_MODELS") {
+		if model != config.OpenAIModel {
+			config.OpenAIModels = append(config.OpenAIModels, model)
+		}
+	}
+	config.DefaultModel = getEnv("GOURBOT_LLM_DEFAULT_MODEL")
+	if config.Providers, err = config.loadProviders(); err != nil {
+		return nil, nil, err
+	}
+	config.problems = append(config.problems, config.checkValues()...)
+	return config, layers.args, nil
+}
+
+// loadProviders reads OpenAI-compatible endpoints from GOURBOT_LLM_PROVIDERS, a comma-separated
+// list of name=baseURL pairs. Each provider may have GOURBOT_LLM_<NAME>_KEY and a comma-separated
+// GOURBOT_LLM_<NAME>_MODELS list. The key may be read from a file, see getSecret.
+func (c *Config) loadProviders() ([]ProviderConfig, error) {
+	var providers []ProviderConfig
+	for _, entry := range getEnvAsList("GOURBOT_LLM_PROVIDERS") {
+		name, baseURL, found := strings.Cut(entry, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !found || name == "" || strings.TrimSpace(baseURL) == "" {
+			return nil, fmt.Errorf("bad GOURBOT_LLM_PROVIDERS entry %q, expected name=baseURL", entry)
+		}
+		if name == "openai" || strings.Contains(name, "/") {
+			return nil, fmt.Errorf("bad provider name %q in GOURBOT_LLM_PROVIDERS", name)
+		}
+		prefix := providerPrefix(name)
+		providers = append(providers, ProviderConfig{
+			Name:    name,
+			BaseURL: strings.TrimSpace(baseURL),
+			APIKey:  c.getSecret("llm.providers."+name+".key", prefix+"KEY"),
+			Models:  getEnvAsList(prefix + "MODELS"),
+		})
+	}
+	return providers, nil
 }
 
 // Helper functions to get environment variables with defaults
 func getEnvOrDefault(key, defaultValue string) string {
-	if value, exists := os.LookupEnv(key); exists {
+	if value, exists := lookupEnv(key); exists {
 		return value
 	}
 	return defaultValue
 }
 
+// getEnvAsList splits a comma-separated environment variable, skipping empty items.
+func getEnvAsList(key string) []string {
+	var list []string
+	for _, item := range strings.Split(getEnv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// getEnvAsIDList parses a comma-separated list of Telegram IDs, skipping bad items.
+func getEnvAsIDList(key string) []int64 {
+	var ids []int64
+	for _, item := range getEnvAsList(key) {
+		if id, err := strconv.ParseInt(item, 10, 64); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func getEnvAsInt64(key string, defaultValue int64) int64 {
+	if value, exists := lookupEnv(key); exists {
+		if intValue, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return intValue
+		}
+	}
+	return defaultValue
+}
+
 func getEnvAsInt(key string, defaultValue int) int {
-	if value, exists := os.LookupEnv(key); exists {
+	if value, exists := lookupEnv(key); exists {
 		if intValue, err := strconv.Atoi(value); err == nil {
 			return intValue
 		}
@@ -79,8 +247,17 @@ func getEnvAsInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+func getEnvAsFloat(key string, defaultValue float64) float64 {
+	if value, exists := lookupEnv(key); exists {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
+
 func getEnvAsBool(key string, defaultValue bool) bool {
-	if value, exists := os.LookupEnv(key); exists {
+	if value, exists := lookupEnv(key); exists {
 		if boolValue, err := strconv.ParseBool(value); err == nil {
 			return boolValue
 		}
@@ -89,7 +266,7 @@ func getEnvAsBool(key string, defaultValue bool) bool {
 }
 
 func getEnvAsBoolFromFirstChar(key string, defaultValue bool) bool {
-	if value, exists := os.LookupEnv(key); exists && len(value) > 0 {
+	if value, exists := lookupEnv(key); exists && len(value) > 0 {
 		switch strings.ToUpper(string(value[0])) {
 		case "1", "T", "Y":
 			return true
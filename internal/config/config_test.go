@@ -1,10 +1,20 @@
 package config
 
 import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
 	"testing"
 )
 
+// testToken is a well-formed bot token.
+const testToken = "123456:ABCdefGHIjklMNOpqrSTUvwxYZ0123456789"
+
 // TestLoadConfig tests the LoadConfig function.
 // Boundary conditions:
 // - Ensure .env file is loaded if present.
@@ -13,7 +23,7 @@ import (
 func TestLoadConfig(t *testing.T) {
 	// Set up environment variables for testing
 	os.Setenv("GOURBOT_OPENAI_KEY", "test_openai_key")
-	os.Setenv("GOURBOT_TGBOT_TOKEN", "test_tg_bot_token")
+	os.Setenv("GOURBOT_TGBOT_TOKEN", testToken)
 	os.Setenv("GOURBOT_MASTER_UID", "12345")
 	os.Setenv("GOURBOT_LOG_MAX_SIZE", "20")
 	os.Setenv("GOURBOT_LOG_STDOUT", "true")
@@ -36,11 +46,11 @@ func TestLoadConfig(t *testing.T) {
 	if config.OpenAIKey != "test_openai_key" {
 		t.Errorf("Expected OpenAIKey to be 'test_openai_key', got '%s'", config.OpenAIKey)
 	}
-	if config.TGBotToken != "test_tg_bot_token" {
-		t.Errorf("Expected TGBotToken to be 'test_tg_bot_token', got '%s'", config.TGBotToken)
+	if config.TGBotToken != testToken {
+		t.Errorf("Expected TGBotToken to be '%s', got '%s'", testToken, config.TGBotToken)
 	}
-	if config.MasterUID != 12345 {
-		t.Errorf("Expected MasterUID to be 12345, got %d", config.MasterUID)
+	if len(config.MasterUIDs) != 1 || config.MasterUIDs[0] != 12345 {
+		t.Errorf("Expected MasterUIDs to be [12345], got %v", config.MasterUIDs)
 	}
 	if config.LogMaxSize != 20 {
 		t.Errorf("Expected LogMaxSize to be 20, got %d", config.LogMaxSize)
@@ -50,6 +60,53 @@ func TestLoadConfig(t *testing.T) {
 	}
 }
 
+// TestLoadConfigProviders tests loading of OpenAI-compatible providers.
+// Boundary conditions:
+// - GOURBOT_OPENAI_KEY is optional when a provider is configured.
+// - Provider keys and model lists are read from per-provider variables.
+// - Malformed provider entries are rejected.
+func TestLoadConfigProviders(t *testing.T) {
+	os.Setenv("GOURBOT_TGBOT_TOKEN", testToken)
+	os.Setenv("GOURBOT_MASTER_UID", "12345")
+	os.Setenv("GOURBOT_LLM_PROVIDERS", "Local=http://localhost:8080/v1, ollama=http://localhost:11434/v1")
+	os.Setenv("GOURBOT_LLM_LOCAL_KEY", "local_key")
+	os.Setenv("GOURBOT_LLM_OLLAMA_MODELS", "llama3, qwen2")
+
+	// Clean up after test
+	defer func() {
+		os.Unsetenv("GOURBOT_TGBOT_TOKEN")
+		os.Unsetenv("GOURBOT_MASTER_UID")
+		os.Unsetenv("GOURBOT_LLM_PROVIDERS")
+		os.Unsetenv("GOURBOT_LLM_LOCAL_KEY")
+		os.Unsetenv("GOURBOT_LLM_OLLAMA_MODELS")
+	}()
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if len(config.Providers) != 2 {
+		t.Fatalf("Expected 2 providers, got %d", len(config.Providers))
+	}
+	local, ollama := config.Providers[0], config.Providers[1]
+	if local.Name != "local" || local.BaseURL != "http://localhost:8080/v1" || local.APIKey != "local_key" {
+		t.Errorf("Unexpected local provider: %+v", local)
+	}
+	if ollama.Name != "ollama" || len(ollama.Models) != 2 || ollama.Models[1] != "qwen2" {
+		t.Errorf("Unexpected ollama provider: %+v", ollama)
+	}
+
+	os.Setenv("GOURBOT_LLM_PROVIDERS", "no-url")
+	if _, err := LoadConfig(); err == nil {
+		t.Errorf("Expected an error for a malformed provider entry")
+	}
+
+	os.Unsetenv("GOURBOT_LLM_PROVIDERS")
+	if _, err := LoadConfig(); err == nil {
+		t.Errorf("Expected an error when no LLM provider is configured")
+	}
+}
+
 // TestGetEnvOrDefault tests the getEnvOrDefault helper function.
 // Boundary conditions:
 // - Environment variable exists.
@@ -71,6 +128,24 @@ func TestGetEnvOrDefault(t *testing.T) {
 	}
 }
 
+// TestGetEnvAsList tests the getEnvAsList helper function.
+// Boundary conditions:
+// - Environment variable holds a comma-separated list with spaces and empty items.
+// - Environment variable is not set.
+func TestGetEnvAsList(t *testing.T) {
+	key := "TEST_ENV_LIST"
+
+	os.Setenv(key, " a, b,,c ,")
+	if value := getEnvAsList(key); len(value) != 3 || value[0] != "a" || value[1] != "b" || value[2] != "c" {
+		t.Errorf("Expected [a b c], got %v", value)
+	}
+	os.Unsetenv(key)
+
+	if value := getEnvAsList(key); len(value) != 0 {
+		t.Errorf("Expected an empty list, got %v", value)
+	}
+}
+
 // TestGetEnvAsInt tests the getEnvAsInt helper function.
 // Boundary conditions:
 // - Environment variable is a valid integer.
@@ -100,6 +175,35 @@ func TestGetEnvAsInt(t *testing.T) {
 	os.Unsetenv(key)
 }
 
+// TestGetEnvAsFloat tests the getEnvAsFloat helper function.
+// Boundary conditions:
+// - Environment variable is a valid float.
+// - Environment variable is not set.
+// - Environment variable is invalid.
+func TestGetEnvAsFloat(t *testing.T) {
+	key := "TEST_ENV_FLOAT"
+	defaultValue := 1.5
+
+	// Test valid float
+	os.Setenv(key, "0.25")
+	if value := getEnvAsFloat(key, defaultValue); value != 0.25 {
+		t.Errorf("Expected 0.25, got %f", value)
+	}
+	os.Unsetenv(key)
+
+	// Test unset environment variable
+	if value := getEnvAsFloat(key, defaultValue); value != defaultValue {
+		t.Errorf("Expected %f, got %f", defaultValue, value)
+	}
+
+	// Test invalid float
+	os.Setenv(key, "invalid")
+	if value := getEnvAsFloat(key, defaultValue); value != defaultValue {
+		t.Errorf("Expected %f, got %f", defaultValue, value)
+	}
+	os.Unsetenv(key)
+}
+
 // TestGetEnvAsBool tests the getEnvAsBool helper function.
 // Boundary conditions:
 // - Environment variable is a valid boolean.
@@ -164,3 +268,415 @@ func TestGetEnvAsBoolFromFirstChar(t *testing.T) {
 	}
 	os.Unsetenv(key)
 }
+
+// restoreEnv restores the environment after a test which sets variables.
+func restoreEnv(t *testing.T) {
+	saved := os.Environ()
+	t.Cleanup(func() {
+		os.Clearenv()
+		for _, kv := range saved {
+			key, value, _ := strings.Cut(kv, "=")
+			os.Setenv(key, value)
+		}
+	})
+}
+
+// TestLoadLayers tests the layering of configuration sources.
+// Boundary conditions:
+// - Defaults < config file < .env < environment < flags.
+// - Lists and providers are read from the config file.
+// - "config show" redacts secrets and names the source of every value.
+// - Unknown settings in the config file and unknown flags are rejected.
+func TestLoadLayers(t *testing.T) {
+	restoreEnv(t)
+	wd, _ := os.Getwd()
+	dir := t.TempDir()
+	os.Chdir(dir)
+	defer os.Chdir(wd)
+
+	file := filepath.Join(dir, "gourbot.yaml")
+	os.WriteFile(file, []byte(`
+telegram:
+  token: "123456:ABCdefGHIjklMNOpqrSTUvwxYZ0123456789"
+  master_uid: 7
+llm:
+  openai_model: file-model
+  openai_models: [gpt-4o, gpt-4.1]
+  providers:
+    - name: local
+      base_url: http://localhost:8080/v1
+      key: local_key
+      models: [llama3, qwen2]
+logging:
+  max_size: 30
+  max_age: 5
+limits:
+  broadcast_rate: 5
+`), 0o600)
+	os.WriteFile(filepath.Join(dir, ".env"), []byte("GOURBOT_LOG_MAX_SIZE=40\nGOURBOT_OPENAI_MODEL=dotenv-model\n"), 0o600)
+	os.Setenv("GOURBOT_CONFIG", file)
+	os.Setenv("GOURBOT_OPENAI_MODEL", "env-model")
+
+	config, err := LoadConfig("-limits.broadcast_rate", "7")
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if config.TGBotToken != testToken || len(config.MasterUIDs) != 1 || config.MasterUIDs[0] != 7 || config.LogMaxAge != 5 {
+		t.Errorf("Expected values from the config file, got %q, %v, %d", string(config.TGBotToken), config.MasterUIDs, config.LogMaxAge)
+	}
+	if config.LogMaxSize != 40 {
+		t.Errorf("Expected LogMaxSize from .env to be 40, got %d", config.LogMaxSize)
+	}
+	if config.OpenAIModel != "env-model" {
+		t.Errorf("Expected OpenAIModel from the environment, got %q", config.OpenAIModel)
+	}
+	if config.BroadcastRate != 7 {
+		t.Errorf("Expected BroadcastRate from the flag to be 7, got %d", config.BroadcastRate)
+	}
+	if len(config.OpenAIModels) != 3 || config.OpenAIModels[2] != "gpt-4.1" {
+		t.Errorf("Unexpected OpenAIModels: %v", config.OpenAIModels)
+	}
+	if len(config.Providers) != 1 || config.Providers[0].APIKey != "local_key" || len(config.Providers[0].Models) != 2 {
+		t.Errorf("Unexpected providers: %+v", config.Providers)
+	}
+
+	var out strings.Builder
+	if err := config.Show(&out); err != nil {
+		t.Fatalf("Show failed: %v", err)
+	}
+	shown := out.String()
+	if strings.Contains(shown, testToken) || strings.Contains(shown, "local_key") {
+		t.Errorf("Secrets are not redacted:\n%s", shown)
+	}
+	for _, line := range []string{
+		`telegram\.token\s+<redacted>\s+file ` + regexp.QuoteMeta(file),
+		`logging\.max_size\s+40\s+\.env GOURBOT_LOG_MAX_SIZE`,
+		`llm\.openai_model\s+env-model\s+env GOURBOT_OPENAI_MODEL`,
+		`limits\.broadcast_rate\s+7\s+flag -limits\.broadcast_rate`,
+		`llm\.speech_voice\s+alloy\s+default`,
+		`llm\.providers\.local\.key\s+<redacted>\s+file .*`,
+	} {
+		if !regexp.MustCompile(`(?m)^` + line + `$`).MatchString(shown) {
+			t.Errorf("Expected a line matching %q in:\n%s", line, shown)
+		}
+	}
+
+	os.WriteFile(file, []byte("telegram:\n  tokn: x\n"), 0o600)
+	config, err = Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if err := config.Validate(); err == nil || !strings.Contains(err.Error(), "unknown setting telegram.tokn") {
+		t.Errorf("Expected an error for an unknown setting, got %v", err)
+	}
+	if _, err := Load("-no-such-flag"); err == nil {
+		t.Errorf("Expected an error for an unknown flag")
+	}
+}
+
+// TestLoadArgs tests loading the configuration for subcommands.
+// Boundary conditions:
+// - Arguments after the flags are returned, Load rejects them.
+// - Flags defined by the subcommand are parsed along with the configuration flags.
+func TestLoadArgs(t *testing.T) {
+	restoreEnv(t)
+	os.Setenv("GOURBOT_TGBOT_TOKEN", testToken)
+
+	var limit int
+	config, rest, err := LoadArgs([]string{"-limits.broadcast_rate", "3", "-limit", "5", "42", "CanChat"}, func(fs *flag.FlagSet) {
+		fs.IntVar(&limit, "limit", 0, "")
+	})
+	if err != nil {
+		t.Fatalf("LoadArgs failed: %v", err)
+	}
+	if config.BroadcastRate != 3 || limit != 5 {
+		t.Errorf("Expected BroadcastRate 3 and limit 5, got %d and %d", config.BroadcastRate, limit)
+	}
+	if len(rest) != 2 || rest[0] != "42" || rest[1] != "CanChat" {
+		t.Errorf("Expected the arguments [42 CanChat], got %v", rest)
+	}
+	if _, err := Load("-limits.broadcast_rate", "3", "42"); err == nil {
+		t.Errorf("Expected an error for an unexpected argument")
+	}
+	if _, _, err := LoadArgs([]string{"-limit", "5"}); err == nil {
+		t.Errorf("Expected an error for a flag not defined without the subcommand")
+	}
+}
+
+// TestValidate tests the validation of the configuration.
+// Boundary conditions:
+// - All problems are reported at once.
+// - Unparsable values, unknown variables, a missing master UID, a bad token, a missing directory.
+// - Bad lists of masters and admins, an admin chat which is not a group.
+// - A valid configuration with several masters passes.
+func TestValidate(t *testing.T) {
+	restoreEnv(t)
+	dir := t.TempDir()
+	os.Setenv("GOURBOT_TGBOT_TOKEN", "not-a-token")
+	os.Setenv("GOURBOT_OPENAI_KEY", "key")
+	os.Setenv("GOURBOT_LOG_MAX_AGE", "month")
+	os.Setenv("GOURBOT_LOG_STDOUT", "maybe")
+	os.Setenv("GOURBOT_TGBOT_TOKN", "typo")
+	os.Setenv("GOURBOT_DB_PATH", filepath.Join(dir, "missing", "gourbot.sqlite"))
+	os.Setenv("GOURBOT_LOG_FILENAME", filepath.Join(dir, "logs", "gourbot.log"))
+
+	_, err := LoadConfig()
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("Expected a ValidationError, got %v", err)
+	}
+	for _, expected := range []string{
+		`logging.max_age: "month" from env GOURBOT_LOG_MAX_AGE is not a number`,
+		`logging.stdout: "maybe" from env GOURBOT_LOG_STDOUT is not a boolean`,
+		"unknown setting GOURBOT_TGBOT_TOKN (from env)",
+		"telegram.token from env GOURBOT_TGBOT_TOKEN is not a bot token",
+		"telegram.master_uid is required",
+		"storage.db_path from env GOURBOT_DB_PATH: directory " + filepath.Join(dir, "missing") + " does not exist",
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected %q in:\n%v", expected, err)
+		}
+	}
+	if len(verr.Problems) != 6 {
+		t.Errorf("Expected 6 problems, got %d:\n%v", len(verr.Problems), err)
+	}
+
+	os.Unsetenv("GOURBOT_LOG_MAX_AGE")
+	os.Unsetenv("GOURBOT_LOG_STDOUT")
+	os.Unsetenv("GOURBOT_TGBOT_TOKN")
+	os.Setenv("GOURBOT_TGBOT_TOKEN", testToken)
+	os.Setenv("GOURBOT_MASTER_UID", "12345,x")
+	os.Setenv("GOURBOT_ADMIN_UIDS", "-5")
+	os.Setenv("GOURBOT_ADMIN_CHAT", "42")
+	_, err = LoadConfig()
+	for _, expected := range []string{
+		`telegram.master_uid: "12345,x" from env GOURBOT_MASTER_UID is not a comma-separated list of numeric IDs`,
+		"telegram.admin_uids from env GOURBOT_ADMIN_UIDS must list user IDs, which are positive, got -5",
+		"telegram.admin_chat from env GOURBOT_ADMIN_CHAT must be a group chat ID, which is negative, got 42",
+	} {
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected %q in:\n%v", expected, err)
+		}
+	}
+
+	os.Setenv("GOURBOT_MASTER_UID", "12345, 67890")
+	os.Setenv("GOURBOT_ADMIN_UIDS", "5")
+	os.Setenv("GOURBOT_ADMIN_CHAT", "-1001234")
+	os.Setenv("GOURBOT_DB_PATH", filepath.Join(dir, "gourbot.sqlite"))
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("Expected a valid configuration, got %v", err)
+	}
+	if len(config.MasterUIDs) != 2 || config.MasterUIDs[1] != 67890 || len(config.AdminUIDs) != 1 || config.AdminChatID != -1001234 {
+		t.Errorf("Unexpected masters and admins: %v, %v, %d", config.MasterUIDs, config.AdminUIDs, config.AdminChatID)
+	}
+}
+
+// TestReload tests loading a changed config file again, as the reload does.
+// Boundary conditions:
+// - Changed values replace the ones of the previous load, removed ones fall back to defaults.
+// - Values from the environment still take precedence.
+// - Diff splits the changes into reloadable settings and the ones needing a restart.
+func TestReload(t *testing.T) {
+	restoreEnv(t)
+	dir := t.TempDir()
+	file := filepath.Join(dir, "gourbot.yaml")
+	write := func(content string) {
+		if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(`
+telegram:
+  token: "123456:ABCdefGHIjklMNOpqrSTUvwxYZ0123456789"
+  master_uid: 7
+llm:
+  openai_key: key
+  openai_model: first-model
+logging:
+  level: info
+limits:
+  user_daily_quota: 2
+`)
+	os.Setenv("GOURBOT_CONFIG", file)
+	os.Setenv("GOURBOT_DB_PATH", filepath.Join(dir, "gourbot.sqlite"))
+	os.Setenv("GOURBOT_BROADCAST_RATE", "3")
+
+	running, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	write(`
+telegram:
+  token: "654321:ABCdefGHIjklMNOpqrSTUvwxYZ0123456789"
+  master_uid: 7
+llm:
+  openai_key: key
+  openai_model: second-model
+logging:
+  level: DEBUG
+limits:
+  broadcast_rate: 10
+`)
+	reloaded, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig failed on reload: %v", err)
+	}
+	if reloaded.OpenAIModel != "second-model" || reloaded.LogLevel != "debug" {
+		t.Errorf("Expected the changed values, got %q and %q", reloaded.OpenAIModel, reloaded.LogLevel)
+	}
+	if reloaded.UserDailyQuota != 1 {
+		t.Errorf("Expected the removed quota to fall back to the default 1, got %v", reloaded.UserDailyQuota)
+	}
+	if reloaded.BroadcastRate != 3 {
+		t.Errorf("Expected BroadcastRate from the environment to be kept, got %d", reloaded.BroadcastRate)
+	}
+
+	reloadable, restart := running.Diff(reloaded)
+	if strings.Join(reloadable, ",") != "limits.user_daily_quota,llm.openai_model,llm.openai_models,logging.level" {
+		t.Errorf("Unexpected reloadable changes: %v", reloadable)
+	}
+	if strings.Join(restart, ",") != "telegram.token" {
+		t.Errorf("Unexpected changes needing a restart: %v", restart)
+	}
+
+	reloaded.KeepRestartSettings(running)
+	if reloadable, restart := running.Diff(reloaded); len(restart) != 0 || len(reloadable) != 4 {
+		t.Errorf("Expected only the reloadable changes after KeepRestartSettings, got %v and %v", reloadable, restart)
+	}
+}
+
+// TestSecrets tests reading secrets from files and keeping them out of printed output.
+// Boundary conditions:
+// - GOURBOT_TGBOT_TOKEN_FILE, GOURBOT_OPENAI_KEY_FILE and a provider key_file are read, the final newline dropped.
+// - World-readable secret files and a secret given both ways are rejected.
+// - The secrets show up neither in %v, %+v, %#v and JSON nor in "config show".
+func TestSecrets(t *testing.T) {
+	restoreEnv(t)
+	dir := t.TempDir()
+	write := func(name, content string, perm os.FileMode) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), perm); err != nil {
+			t.Fatal(err)
+		}
+		os.Chmod(path, perm) // Not limited by the umask
+		return path
+	}
+	tokenFile := write("token", testToken+"\n", 0o600)
+	keyFile := write("openai_key", "file_openai_key\n", 0o640)
+	localKeyFile := write("local_key", "file_local_key", 0o400)
+	file := write("gourbot.yaml", `
+llm:
+  providers:
+    - name: local
+      base_url: http://localhost:8080/v1
+      key_file: `+localKeyFile+`
+`, 0o644)
+	os.Setenv("GOURBOT_CONFIG", file)
+	os.Setenv("GOURBOT_TGBOT_TOKEN_FILE", tokenFile)
+	os.Setenv("GOURBOT_OPENAI_KEY_FILE", keyFile)
+	os.Setenv("GOURBOT_MASTER_UID", "7")
+	os.Setenv("GOURBOT_DB_PATH", filepath.Join(dir, "gourbot.sqlite"))
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if config.TGBotToken != testToken || config.OpenAIKey != "file_openai_key" {
+		t.Errorf("Expected the secrets from the files, got %q and %q", string(config.TGBotToken), string(config.OpenAIKey))
+	}
+	if len(config.Providers) != 1 || config.Providers[0].APIKey != "file_local_key" {
+		t.Errorf("Expected the provider key from the file, got %+v", config.Providers)
+	}
+
+	jsonConfig, _ := json.Marshal(config)
+	var shown strings.Builder
+	config.Show(&shown)
+	for _, printed := range []string{
+		fmt.Sprintf("%v", config), fmt.Sprintf("%+v", *config), fmt.Sprintf("%#v", config),
+		fmt.Sprint(config.Providers), string(jsonConfig), shown.String(),
+	} {
+		if strings.Contains(printed, testToken) || strings.Contains(printed, "file_openai_key") || strings.Contains(printed, "file_local_key") {
+			t.Errorf("Secrets are not redacted:\n%s", printed)
+		}
+	}
+	for _, line := range []string{
+		`telegram\.token\s+<redacted>\s+env GOURBOT_TGBOT_TOKEN_FILE`,
+		`telegram\.token_file\s+` + regexp.QuoteMeta(tokenFile) + `\s+env GOURBOT_TGBOT_TOKEN_FILE`,
+		`llm\.providers\.local\.key_file\s+` + regexp.QuoteMeta(localKeyFile) + `\s+file .*`,
+	} {
+		if !regexp.MustCompile(`(?m)^` + line + `$`).MatchString(shown.String()) {
+			t.Errorf("Expected a line matching %q in:\n%s", line, shown.String())
+		}
+	}
+
+	os.Chmod(tokenFile, 0o604)
+	os.Setenv("GOURBOT_OPENAI_KEY", "env_openai_key")
+	_, err = LoadConfig()
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("Expected a ValidationError, got %v", err)
+	}
+	for _, expected := range []string{
+		"telegram.token: GOURBOT_TGBOT_TOKEN_FILE from env GOURBOT_TGBOT_TOKEN_FILE: " + tokenFile + " is readable by everyone",
+		"llm.openai_key: both env GOURBOT_OPENAI_KEY and GOURBOT_OPENAI_KEY_FILE from env GOURBOT_OPENAI_KEY_FILE are set",
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected %q in:\n%v", expected, err)
+		}
+	}
+	if len(verr.Problems) != 2 {
+		t.Errorf("Expected 2 problems, got %d:\n%v", len(verr.Problems), err)
+	}
+}
+
+// TestSecretsStayOutOfEnvironment tests that loading never exposes secrets to other processes.
+// Boundary conditions:
+// - Secrets from the config file, .env and _FILE variables are loaded but not put into the environment.
+// - Secrets cannot be given as flags, which every user can see.
+func TestSecretsStayOutOfEnvironment(t *testing.T) {
+	restoreEnv(t)
+	for _, kv := range os.Environ() {
+		if key, _, _ := strings.Cut(kv, "="); strings.HasPrefix(key, envPrefix) {
+			os.Unsetenv(key)
+		}
+	}
+	wd, _ := os.Getwd()
+	dir := t.TempDir()
+	os.Chdir(dir)
+	defer os.Chdir(wd)
+
+	keyFile := filepath.Join(dir, "local_key")
+	os.WriteFile(keyFile, []byte("file_local_key"), 0o600)
+	file := filepath.Join(dir, "gourbot.yaml")
+	os.WriteFile(file, []byte(`
+telegram:
+  token: "123456:ABCdefGHIjklMNOpqrSTUvwxYZ0123456789"
+llm:
+  providers:
+    - name: local
+      base_url: http://localhost:8080/v1
+      key_file: `+keyFile+`
+`), 0o600)
+	os.WriteFile(filepath.Join(dir, ".env"), []byte("GOURBOT_OPENAI_KEY=dotenv_openai_key\n"), 0o600)
+
+	config, err := Load("-config", file, "-logging.max_age", "5")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if config.TGBotToken != testToken || config.OpenAIKey != "dotenv_openai_key" || config.Providers[0].APIKey != "file_local_key" {
+		t.Errorf("Expected the secrets of the layers, got %q, %q and %+v", string(config.TGBotToken), string(config.OpenAIKey), config.Providers)
+	}
+	for _, kv := range os.Environ() {
+		if strings.HasPrefix(kv, envPrefix) {
+			t.Errorf("Expected no GOURBOT_ variables in the environment, got %s", kv)
+		}
+	}
+
+	for _, flag := range []string{"-telegram.token", "-llm.openai_key"} {
+		if _, err := Load(flag, "secret"); err == nil {
+			t.Errorf("Expected %s to be rejected", flag)
+		}
+	}
+}
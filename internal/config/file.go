@@ -0,0 +1,455 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// Sources of configuration values, from the lowest to the highest priority.
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceDotEnv  = ".env"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+)
+
+// envPrefix is the prefix of all environment variables of the bot.
+const envPrefix = "GOURBOT_"
+
+// setting is a configuration value which can be given in the config file, as an environment
+// variable and as a command-line flag.
+type setting struct {
+	key    string // "section.name" in the config file, also the name of the flag
+	env    string
+	secret bool
+	value  func(c *Config) any // Effective value, for "config show"
+}
+
+var settings = []setting{
+	{"telegram.token", "GOURBOT_TGBOT_TOKEN", true, func(c *Config) any { return c.TGBotToken }},
+	{"telegram.token_file", "GOURBOT_TGBOT_TOKEN_FILE", false, func(c *Config) any { return c.secretFiles["GOURBOT_TGBOT_TOKEN"] }},
+	{"telegram.master_uid", "GOURBOT_MASTER_UID", false, func(c *Config) any { return c.MasterUIDs }},
+	{"telegram.admin_uids", "GOURBOT_ADMIN_UIDS", false, func(c *Config) any { return c.AdminUIDs }},
+	{"telegram.admin_chat", "GOURBOT_ADMIN_CHAT", false, func(c *Config) any { return c.AdminChatID }},
+	{"telegram.leave_unapproved", "GOURBOT_LEAVE_UNAPPROVED", false, func(c *Config) any { return c.LeaveUnapproved }},
+	{"telegram.stream_edit_interval", "GOURBOT_STREAM_EDIT_INTERVAL", false, func(c *Config) any { return c.StreamEditInterval }},
+	{"telegram.dialog_timeout", "GOURBOT_DIALOG_TIMEOUT", false, func(c *Config) any { return c.DialogTimeout }},
+	{"telegram.inline_debounce", "GOURBOT_INLINE_DEBOUNCE", false, func(c *Config) any { return c.InlineDebounce }},
+	{"telegram.inline_cache_ttl", "GOURBOT_INLINE_CACHE_TTL", false, func(c *Config) any { return c.InlineCacheTTL }},
+	{"telegram.timezone", "GOURBOT_TIMEZONE", false, func(c *Config) any { return c.Timezone }},
+	{"llm.openai_key", "GOURBOT_OPENAI_KEY", true, func(c *Config) any { return c.OpenAIKey }},
+	{"llm.openai_key_file", "GOURBOT_OPENAI_KEY_FILE", false, func(c *Config) any { return c.secretFiles["GOURBOT_OPENAI_KEY"] }},
+	{"llm.openai_base_url", "GOURBOT_OPENAI_BASE_URL", false, func(c *Config) any { return c.OpenAIBaseURL }},
+	{"llm.openai_model", "GOURBOT_OPENAI_MODEL", false, func(c *Config) any { return c.OpenAIModel }},
+	{"llm.openai_models", "GOURBOT_OPENAI_MODELS", false, func(c *Config) any { return c.OpenAIModels }},
+	{"llm.providers", "GOURBOT_LLM_PROVIDERS", false, func(c *Config) any { return providerNames(c.Providers) }},
+	{"llm.default_model", "GOURBOT_LLM_DEFAULT_MODEL", false, func(c *Config) any { return c.DefaultModel }},
+	{"llm.image_model", "GOURBOT_IMAGE_MODEL", false, func(c *Config) any { return c.ImageModel }},
+	{"llm.image_edit_model", "GOURBOT_IMAGE_EDIT_MODEL", false, func(c *Config) any { return c.ImageEditModel }},
+	{"llm.transcribe_model", "GOURBOT_TRANSCRIBE_MODEL", false, func(c *Config) any { return c.TranscribeModel }},
+	{"llm.speech_model", "GOURBOT_SPEECH_MODEL", false, func(c *Config) any { return c.SpeechModel }},
+	{"llm.speech_voice", "GOURBOT_SPEECH_VOICE", false, func(c *Config) any { return c.SpeechVoice }},
+	{"llm.summary_model", "GOURBOT_SUMMARY_MODEL", false, func(c *Config) any { return c.SummaryModel }},
+	{"llm.tools", "GOURBOT_LLM_TOOLS", false, func(c *Config) any { return c.ToolsEnabled }},
+	{"llm.tool_max_steps", "GOURBOT_LLM_TOOL_MAX_STEPS", false, func(c *Config) any { return c.ToolMaxSteps }},
+	{"storage.db_path", "GOURBOT_DB_PATH", false, func(c *Config) any { return c.DbPath }},
+	{"storage.history_max_tokens", "GOURBOT_HISTORY_MAX_TOKENS", false, func(c *Config) any { return c.HistoryMaxTokens }},
+	{"storage.history_keep_tokens", "GOURBOT_HISTORY_KEEP_TOKENS", false, func(c *Config) any { return c.HistoryKeepTokens }},
+	{"storage.backup_schedule", "GOURBOT_BACKUP_SCHEDULE", false, func(c *Config) any { return c.BackupSchedule }},
+	{"storage.backup_dir", "GOURBOT_BACKUP_DIR", false, func(c *Config) any { return c.BackupDir }},
+	{"storage.backup_keep", "GOURBOT_BACKUP_KEEP", false, func(c *Config) any { return c.BackupKeep }},
+	{"logging.level", "GOURBOT_LOG_LEVEL", false, func(c *Config) any { return c.LogLevel }},
+	{"logging.filename", "GOURBOT_LOG_FILENAME", false, func(c *Config) any { return c.LogFilename }},
+	{"logging.max_size", "GOURBOT_LOG_MAX_SIZE", false, func(c *Config) any { return c.LogMaxSize }},
+	{"logging.max_backups", "GOURBOT_LOG_MAX_BACKUPS", false, func(c *Config) any { return c.LogMaxBackups }},
+	{"logging.max_age", "GOURBOT_LOG_MAX_AGE", false, func(c *Config) any { return c.LogMaxAge }},
+	{"logging.compress", "GOURBOT_LOG_COMPRESS", false, func(c *Config) any { return c.LogCompress }},
+	{"logging.stdout", "GOURBOT_LOG_STDOUT", false, func(c *Config) any { return c.LogStdout }},
+	{"limits.user_daily_quota", "GOURBOT_USER_DAILY_QUOTA", false, func(c *Config) any { return c.UserDailyQuota }},
+	{"limits.broadcast_rate", "GOURBOT_BROADCAST_RATE", false, func(c *Config) any { return c.BroadcastRate }},
+	{"notifications.digest", "GOURBOT_NOTIFY_DIGEST", false, func(c *Config) any { return c.NotifyDigest }},
+	{"health.addr", "GOURBOT_HEALTH_ADDR", false, func(c *Config) any { return c.HealthAddr }},
+}
+
+// restartSettings are the settings which cannot be changed while the bot runs.
+var restartSettings = map[string]bool{
+	"telegram.token":      true,
+	"telegram.token_file": true,
+	"storage.db_path":     true,
+	"health.addr":         true,
+}
+
+// settingByKey finds a setting by its key in the config file.
+func settingByKey(key string) *setting {
+	for i := range settings {
+		if settings[i].key == key {
+			return &settings[i]
+		}
+	}
+	return nil
+}
+
+// providerFile is an entry of llm.providers in the config file.
+type providerFile struct {
+	Name    string   `yaml:"name"`
+	BaseURL string   `yaml:"base_url"`
+	Key     string   `yaml:"key"`
+	KeyFile string   `yaml:"key_file"`
+	Models  []string `yaml:"models"`
+}
+
+// layers describes where the configuration was loaded from.
+type layers struct {
+	values   map[string]string // Values of the other layers which override the environment
+	sources  map[string]string // Layer every set GOURBOT_ variable came from
+	file     string            // Path of the loaded config file, empty if there is none
+	problems []string          // Problems found in the config file
+	args     []string          // Arguments after the flags
+}
+
+var (
+	// loadMu serializes loading, as the loader reads the layers through lookupEnv.
+	loadMu sync.Mutex
+	// layered holds the values of the layers being loaded, nil between loads.
+	layered map[string]string
+)
+
+// lookupEnv looks a variable up in the layers being loaded and then in the environment.
+// The layers are never put into the environment, where secrets would be inherited by child
+// processes and show up in /proc/<pid>/environ.
+func lookupEnv(key string) (string, bool) {
+	if value, ok := layered[key]; ok {
+		return value, true
+	}
+	return os.LookupEnv(key)
+}
+
+// getEnv returns the value of a variable like lookupEnv, empty if it is not set.
+func getEnv(key string) string {
+	value, _ := lookupEnv(key)
+	return value
+}
+
+// readLayers reads the layers of the configuration besides the environment. Like the .env
+// file always did, the config file only sets variables which are not set yet, while flags
+// override them. Secrets have no flags, as the arguments of a process are visible to every
+// user. The define functions add flags of a subcommand to the configuration flags.
+func readLayers(args []string, defaultFile string, define ...func(fs *flag.FlagSet)) (*layers, error) {
+	fs := flag.NewFlagSet("gourbot", flag.ContinueOnError)
+	configPath := fs.String("config", "", "path of the YAML config file, also GOURBOT_CONFIG")
+	for _, s := range settings {
+		if !s.secret {
+			fs.String(s.key, "", "overrides "+s.env)
+		}
+	}
+	for _, d := range define {
+		d(fs)
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	l := &layers{values: make(map[string]string), sources: make(map[string]string), args: fs.Args()}
+	for _, kv := range os.Environ() {
+		if key, _, _ := strings.Cut(kv, "="); strings.HasPrefix(key, envPrefix) {
+			l.sources[key] = SourceEnv
+		}
+	}
+	setDefault := func(key, value, source string) {
+		if _, set := l.sources[key]; !set {
+			l.values[key] = value
+			l.sources[key] = source
+		}
+	}
+	// Read .env file if it exists
+	dotEnv, err := godotenv.Read()
+	if err != nil {
+		log.Println("Warning: .env file not found, relying on environment variables")
+	}
+	for key, value := range dotEnv {
+		if strings.HasPrefix(key, envPrefix) {
+			setDefault(key, value, SourceDotEnv)
+		} else if _, set := os.LookupEnv(key); !set {
+			os.Setenv(key, value) // E.g. proxy settings for the HTTP clients
+		}
+	}
+
+	path := *configPath
+	if path == "" {
+		path = os.Getenv("GOURBOT_CONFIG")
+	}
+	if path == "" {
+		path = l.values["GOURBOT_CONFIG"] // From the .env file
+	}
+	if path == "" {
+		if _, err := os.Stat(defaultFile); err == nil {
+			path = defaultFile
+		}
+	}
+	if path != "" {
+		values, problems, err := readConfigFile(path)
+		if err != nil {
+			return nil, err
+		}
+		l.file, l.problems = path, problems
+		for key, value := range values {
+			setDefault(key, value, SourceFile)
+		}
+	}
+
+	fs.Visit(func(f *flag.Flag) {
+		if s := settingByKey(f.Name); s != nil {
+			l.values[s.env] = f.Value.String()
+			l.sources[s.env] = SourceFlag
+		}
+	})
+	return l, nil
+}
+
+// readConfigFile reads a YAML config file of sections with settings and returns the values
+// by their environment variables, lists joined with commas. Unknown settings and values of
+// the wrong shape are returned as problems.
+func readConfigFile(path string) (map[string]string, []string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	var file map[string]map[string]yaml.Node
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	values := make(map[string]string)
+	var problems []string
+	for section, entries := range file {
+		for name, node := range entries {
+			key := section + "." + name
+			if node.Tag == "!!null" {
+				continue
+			}
+			if key == "llm.providers" {
+				if err := providersToEnv(&node, values); err != nil {
+					problems = append(problems, fmt.Sprintf("%s:%d: %s: %v", path, node.Line, key, err))
+				}
+				continue
+			}
+			s := settingByKey(key)
+			if s == nil {
+				problems = append(problems, fmt.Sprintf("%s:%d: unknown setting %s", path, node.Line, key))
+				continue
+			}
+			value, err := nodeToEnv(&node)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s:%d: %s: %v", path, node.Line, key, err))
+				continue
+			}
+			values[s.env] = value
+		}
+	}
+	sort.Strings(problems) // Map order is random
+	return values, problems, nil
+}
+
+// nodeToEnv converts a value or a list of values of the config file to the format of
+// the environment variables.
+func nodeToEnv(node *yaml.Node) (string, error) {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		return node.Value, nil
+	case yaml.SequenceNode:
+		var items []string
+		if err := node.Decode(&items); err != nil {
+			return "", fmt.Errorf("expected a list of values")
+		}
+		return strings.Join(items, ","), nil
+	}
+	return "", fmt.Errorf("expected a value or a list of values")
+}
+
+// providersToEnv converts the llm.providers list of the config file to the variables
+// read by loadProviders.
+func providersToEnv(node *yaml.Node, values map[string]string) error {
+	var providers []providerFile
+	if err := node.Decode(&providers); err != nil {
+		return fmt.Errorf("expected a list of providers with name, base_url, key or key_file and models")
+	}
+	var entries []string
+	for _, p := range providers {
+		entries = append(entries, p.Name+"="+p.BaseURL)
+		prefix := providerPrefix(p.Name)
+		if p.Key != "" {
+			values[prefix+"KEY"] = p.Key
+		}
+		if p.KeyFile != "" {
+			values[prefix+"KEY"+fileSuffix] = p.KeyFile
+		}
+		if len(p.Models) > 0 {
+			values[prefix+"MODELS"] = strings.Join(p.Models, ",")
+		}
+	}
+	values["GOURBOT_LLM_PROVIDERS"] = strings.Join(entries, ",")
+	return nil
+}
+
+// providerPrefix returns the prefix of the environment variables of a provider.
+func providerPrefix(name string) string {
+	return "GOURBOT_LLM_" + strings.ToUpper(strings.TrimSpace(name)) + "_"
+}
+
+func providerNames(providers []ProviderConfig) []string {
+	var names []string
+	for _, p := range providers {
+		names = append(names, p.Name+"="+p.BaseURL)
+	}
+	return names
+}
+
+// entry is an effective setting as shown by "config show".
+type entry struct {
+	key    string
+	value  string // Formatted but not redacted
+	secret bool
+	env    string // Variable the value came from
+}
+
+// entries lists the effective settings, including the ones of every provider.
+func (c *Config) entries() []entry {
+	var list []entry
+	for _, s := range settings {
+		list = append(list, entry{s.key, formatValue(s.value(c)), s.secret, s.env})
+	}
+	for _, p := range c.Providers {
+		key, prefix := "llm.providers."+p.Name, providerPrefix(p.Name)
+		list = append(list,
+			entry{key + ".base_url", formatValue(p.BaseURL), false, "GOURBOT_LLM_PROVIDERS"},
+			entry{key + ".key", formatValue(p.APIKey), true, prefix + "KEY"},
+			entry{key + ".key_file", formatValue(c.secretFiles[prefix+"KEY"]), false, prefix + "KEY" + fileSuffix},
+			entry{key + ".models", formatValue(p.Models), false, prefix + "MODELS"})
+	}
+	return list
+}
+
+// Show prints the effective configuration with the source of every value. Secrets are
+// redacted.
+func (c *Config) Show(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	if c.ConfigFile != "" {
+		fmt.Fprintf(tw, "# config file: %s\n", c.ConfigFile)
+	}
+	for _, e := range c.entries() {
+		value := e.value
+		if e.secret && value != `""` {
+			value = redacted
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", e.key, value, c.source(e.env))
+	}
+	return tw.Flush()
+}
+
+// Diff compares the configuration with a newer one and returns the keys of the changed
+// settings, split into the ones applied while running and the ones requiring a restart.
+func (c *Config) Diff(newer *Config) (reloadable, restart []string) {
+	old := make(map[string]string)
+	for _, e := range c.entries() {
+		old[e.key] = e.value
+	}
+	seen := make(map[string]bool)
+	for _, e := range newer.entries() {
+		seen[e.key] = true
+		if value, ok := old[e.key]; ok && value == e.value {
+			continue
+		}
+		if restartSettings[e.key] {
+			restart = append(restart, e.key)
+		} else {
+			reloadable = append(reloadable, e.key)
+		}
+	}
+	for key := range old {
+		if !seen[key] { // A removed provider
+			reloadable = append(reloadable, key)
+		}
+	}
+	sort.Strings(reloadable)
+	return reloadable, restart
+}
+
+// source describes where the value of the environment variable came from.
+func (c *Config) source(env string) string {
+	if _, ok := c.secretFiles[env]; ok {
+		return c.source(env + fileSuffix)
+	}
+	switch source := c.sources[env]; source {
+	case "":
+		return SourceDefault
+	case SourceFile:
+		return SourceFile + " " + c.ConfigFile
+	case SourceFlag:
+		if s := settingByEnv(env); s != nil {
+			return SourceFlag + " -" + s.key
+		}
+		return source
+	default:
+		return source + " " + env
+	}
+}
+
+// settingByEnv finds a setting by its environment variable.
+func settingByEnv(env string) *setting {
+	for i := range settings {
+		if settings[i].env == env {
+			return &settings[i]
+		}
+	}
+	return nil
+}
+
+// formatValue formats a setting for "config show".
+func formatValue(value any) string {
+	var text string
+	switch v := value.(type) {
+	case Secret:
+		text = string(v)
+	case []string:
+		text = strings.Join(v, ",")
+	case []int64:
+		items := make([]string, len(v))
+		for i, id := range v {
+			items[i] = strconv.FormatInt(id, 10)
+		}
+		text = strings.Join(items, ",")
+	case float64:
+		text = strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		text = fmt.Sprint(v)
+	}
+	if text == "" {
+		return `""`
+	}
+	return text
+}
+
+// KeepRestartSettings copies the settings which need a restart from the running
+// configuration, so that a reloaded configuration only changes what can be applied.
+func (c *Config) KeepRestartSettings(running *Config) {
+	c.TGBotToken = running.TGBotToken
+	if path, ok := running.secretFiles["GOURBOT_TGBOT_TOKEN"]; ok {
+		c.secretFiles["GOURBOT_TGBOT_TOKEN"] = path
+	} else {
+		delete(c.secretFiles, "GOURBOT_TGBOT_TOKEN")
+	}
+	c.DbPath = running.DbPath
+	c.HealthAddr = running.HealthAddr
+}
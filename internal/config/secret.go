@@ -0,0 +1,74 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Secret is a token or a key. It prints as "<redacted>" with every fmt verb and in JSON,
+// so that logging a Config or a ProviderConfig never leaks it; string(s) is the value.
+type Secret string
+
+const redacted = "<redacted>"
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return redacted
+}
+
+// GoString redacts the secret for %#v.
+func (s Secret) GoString() string {
+	return fmt.Sprintf("%q", s.String())
+}
+
+// MarshalJSON redacts the secret, e.g. in the JSON log.
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// fileSuffix marks a variable with the path of a file holding a secret instead of the
+// secret itself, e.g. GOURBOT_TGBOT_TOKEN_FILE, as used by Docker secrets and systemd
+// credentials. Unlike variables, files do not show up in /proc/<pid>/environ.
+const fileSuffix = "_FILE"
+
+// getSecret returns the secret of the variable or, if <env>_FILE is set, the contents of
+// that file. Problems are recorded under the key for Validate.
+func (c *Config) getSecret(key, env string) Secret {
+	path := getEnv(env + fileSuffix)
+	if path == "" {
+		return Secret(getEnv(env))
+	}
+	if _, set := lookupEnv(env); set {
+		c.problems = append(c.problems, fmt.Sprintf("%s: both %s and %s from %s are set, use only one",
+			key, c.source(env), env+fileSuffix, c.source(env+fileSuffix)))
+		return Secret(getEnv(env))
+	}
+	value, err := readSecretFile(path)
+	if err != nil {
+		c.problems = append(c.problems, fmt.Sprintf("%s: %s from %s: %v", key, env+fileSuffix, c.source(env+fileSuffix), err))
+		return ""
+	}
+	c.secretFiles[env] = path
+	return Secret(value)
+}
+
+// readSecretFile reads a secret from a file, which must not be readable by everyone.
+// Surrounding white space such as the final newline is dropped.
+func readSecretFile(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if info.Mode().Perm()&0o004 != 0 {
+		return "", fmt.Errorf("%s is readable by everyone, restrict it with chmod o-r", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
@@ -0,0 +1,240 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gourbot/internal/schedule"
+
+	"github.com/sirupsen/logrus"
+)
+
+// tokenRe matches a Telegram bot token as issued by @BotFather: "<bot ID>:<secret>".
+var tokenRe = regexp.MustCompile(`^[0-9]+:[A-Za-z0-9_-]{30,}$`)
+
+// ValidationError lists all problems found in the configuration.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid configuration, %d problem(s):\n  - %s", len(e.Problems), strings.Join(e.Problems, "\n  - "))
+}
+
+// checkValues returns the set values which cannot be parsed, and so would silently be
+// replaced by their defaults, and the unknown GOURBOT_ variables.
+func (c *Config) checkValues() []string {
+	var problems []string
+	for _, s := range settings {
+		raw, set := lookupEnv(s.env)
+		if !set || raw == "" {
+			continue
+		}
+		if expected := parseProblem(s, raw, c); expected != "" {
+			problems = append(problems, fmt.Sprintf("%s: %q from %s is not %s", s.key, raw, c.source(s.env), expected))
+		}
+	}
+
+	var unknown []string
+	for env := range c.sources {
+		if !c.knownEnv(env) {
+			unknown = append(unknown, fmt.Sprintf("unknown setting %s (from %s)", env, c.sources[env]))
+		}
+	}
+	sort.Strings(unknown) // Map order is random
+	return append(problems, unknown...)
+}
+
+// parseProblem describes the expected value if raw cannot be parsed as the setting's type.
+func parseProblem(s setting, raw string, c *Config) string {
+	var err error
+	switch s.value(c).(type) {
+	case int:
+		_, err = strconv.Atoi(raw)
+	case int64:
+		_, err = strconv.ParseInt(raw, 10, 64)
+	case []int64:
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				if _, err := strconv.ParseInt(item, 10, 64); err != nil {
+					return "a comma-separated list of numeric IDs"
+				}
+			}
+		}
+	case float64:
+		_, err = strconv.ParseFloat(raw, 64)
+	case bool:
+		if s.env == "GOURBOT_LOG_STDOUT" {
+			if !strings.ContainsAny(strings.ToUpper(raw[:1]), "10TFYN") {
+				return "a boolean (yes/no, true/false or 1/0)"
+			}
+			return ""
+		}
+		_, err = strconv.ParseBool(raw)
+		if err != nil {
+			return "a boolean (true or false)"
+		}
+	}
+	if err != nil {
+		return "a number"
+	}
+	return ""
+}
+
+// knownEnv reports whether the variable is a setting of the bot.
+func (c *Config) knownEnv(env string) bool {
+	if env == "GOURBOT_CONFIG" || settingByEnv(env) != nil {
+		return true
+	}
+	for _, p := range c.Providers {
+		if prefix := providerPrefix(p.Name); env == prefix+"KEY" || env == prefix+"KEY"+fileSuffix || env == prefix+"MODELS" {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks the configuration and returns a ValidationError listing all problems,
+// including the ones found while loading it.
+func (c *Config) Validate() error {
+	problems := append([]string(nil), c.problems...)
+	add := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	switch {
+	case c.hasProblem("telegram.token"):
+	case c.TGBotToken == "":
+		add("telegram.token is required: set GOURBOT_TGBOT_TOKEN or GOURBOT_TGBOT_TOKEN_FILE to the token from @BotFather")
+	case !tokenRe.MatchString(string(c.TGBotToken)):
+		add("telegram.token from %s is not a bot token, expected <bot ID>:<secret> as issued by @BotFather", c.source("GOURBOT_TGBOT_TOKEN"))
+	}
+	if len(c.MasterUIDs) == 0 && !c.hasProblem("telegram.master_uid") {
+		add("telegram.master_uid is required: set GOURBOT_MASTER_UID to your Telegram user ID, e.g. from @userinfobot")
+	}
+	for _, ids := range []struct {
+		key, env string
+		ids      []int64
+	}{
+		{"telegram.master_uid", "GOURBOT_MASTER_UID", c.MasterUIDs},
+		{"telegram.admin_uids", "GOURBOT_ADMIN_UIDS", c.AdminUIDs},
+	} {
+		for _, id := range ids.ids {
+			if id <= 0 {
+				add("%s from %s must list user IDs, which are positive, got %d", ids.key, c.source(ids.env), id)
+			}
+		}
+	}
+	if c.AdminChatID > 0 {
+		add("telegram.admin_chat from %s must be a group chat ID, which is negative, got %d", c.source("GOURBOT_ADMIN_CHAT"), c.AdminChatID)
+	}
+	if c.OpenAIKey == "" && len(c.Providers) == 0 && !c.hasProblem("llm.openai_key") {
+		add("no LLM provider configured: set GOURBOT_OPENAI_KEY or GOURBOT_LLM_PROVIDERS")
+	}
+	if _, err := logrus.ParseLevel(c.LogLevel); err != nil {
+		add("logging.level from %s: unknown level %q, use error, warn, info, debug or trace", c.source("GOURBOT_LOG_LEVEL"), c.LogLevel)
+	}
+	if c.Timezone != "" {
+		if _, err := time.LoadLocation(c.Timezone); err != nil || c.Timezone == "Local" {
+			add("telegram.timezone from %s: unknown time zone %q, use a name like Europe/Berlin", c.source("GOURBOT_TIMEZONE"), c.Timezone)
+		}
+	}
+	if _, err := schedule.ParseCron(c.NotifyDigest); err != nil {
+		add("notifications.digest from %s: %v", c.source("GOURBOT_NOTIFY_DIGEST"), err)
+	}
+	if c.BackupSchedule != "" {
+		if _, err := schedule.ParseCron(c.BackupSchedule); err != nil {
+			add("storage.backup_schedule from %s: %v", c.source("GOURBOT_BACKUP_SCHEDULE"), err)
+		}
+		if err := checkDir(c.BackupDir, true); err != nil {
+			add("storage.backup_dir from %s: %v", c.source("GOURBOT_BACKUP_DIR"), err)
+		}
+	}
+	if c.HealthAddr != "" {
+		if _, _, err := net.SplitHostPort(c.HealthAddr); err != nil {
+			add("health.addr from %s: %q is not a listen address like :8080 or 127.0.0.1:8080", c.source("GOURBOT_HEALTH_ADDR"), c.HealthAddr)
+		}
+	}
+
+	// SQLite does not create the directory of the database, the log rotation does
+	if err := checkDir(filepath.Dir(c.DbPath), false); err != nil {
+		add("storage.db_path from %s: %v", c.source("GOURBOT_DB_PATH"), err)
+	}
+	if err := checkDir(filepath.Dir(c.LogFilename), true); err != nil {
+		add("logging.filename from %s: %v", c.source("GOURBOT_LOG_FILENAME"), err)
+	}
+
+	for _, limit := range []struct {
+		key, env string
+		value    float64
+		min      float64
+	}{
+		{"telegram.stream_edit_interval", "GOURBOT_STREAM_EDIT_INTERVAL", float64(c.StreamEditInterval), 0},
+		{"telegram.dialog_timeout", "GOURBOT_DIALOG_TIMEOUT", float64(c.DialogTimeout), 1},
+		{"telegram.inline_debounce", "GOURBOT_INLINE_DEBOUNCE", float64(c.InlineDebounce), 0},
+		{"telegram.inline_cache_ttl", "GOURBOT_INLINE_CACHE_TTL", float64(c.InlineCacheTTL), 0},
+		{"llm.tool_max_steps", "GOURBOT_LLM_TOOL_MAX_STEPS", float64(c.ToolMaxSteps), 1},
+		{"storage.history_max_tokens", "GOURBOT_HISTORY_MAX_TOKENS", float64(c.HistoryMaxTokens), 1},
+		{"storage.history_keep_tokens", "GOURBOT_HISTORY_KEEP_TOKENS", float64(c.HistoryKeepTokens), 0},
+		{"storage.backup_keep", "GOURBOT_BACKUP_KEEP", float64(c.BackupKeep), 1},
+		{"logging.max_size", "GOURBOT_LOG_MAX_SIZE", float64(c.LogMaxSize), 0},
+		{"logging.max_backups", "GOURBOT_LOG_MAX_BACKUPS", float64(c.LogMaxBackups), 0},
+		{"logging.max_age", "GOURBOT_LOG_MAX_AGE", float64(c.LogMaxAge), 0},
+		{"limits.user_daily_quota", "GOURBOT_USER_DAILY_QUOTA", c.UserDailyQuota, 0},
+		{"limits.broadcast_rate", "GOURBOT_BROADCAST_RATE", float64(c.BroadcastRate), 1},
+	} {
+		if limit.value < limit.min {
+			add("%s from %s must be at least %v, got %v", limit.key, c.source(limit.env), limit.min, limit.value)
+		}
+	}
+	if c.HistoryKeepTokens >= c.HistoryMaxTokens {
+		add("storage.history_keep_tokens (%d) must be less than storage.history_max_tokens (%d)", c.HistoryKeepTokens, c.HistoryMaxTokens)
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// hasProblem reports whether a problem with the setting was found while loading.
+func (c *Config) hasProblem(key string) bool {
+	for _, problem := range c.problems {
+		if strings.HasPrefix(problem, key+":") {
+			return true
+		}
+	}
+	return false
+}
+
+// checkDir checks that files can be created in the directory. If create is set, a missing
+// directory is fine as long as it can be created in its nearest existing parent.
+func checkDir(dir string, create bool) error {
+	info, err := os.Stat(dir)
+	for create && os.IsNotExist(err) && filepath.Dir(dir) != dir {
+		dir = filepath.Dir(dir)
+		info, err = os.Stat(dir)
+	}
+	switch {
+	case os.IsNotExist(err):
+		return fmt.Errorf("directory %s does not exist", dir)
+	case err != nil:
+		return err
+	case !info.IsDir():
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	probe, err := os.CreateTemp(dir, ".gourbot-check-*")
+	if err != nil {
+		return fmt.Errorf("directory %s is not writable", dir)
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+	return nil
+}
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// watchInterval is how often the config file is checked for changes.
+const watchInterval = 5 * time.Second
+
+// Watch calls reload when the config file changes and when the process gets SIGHUP, until
+// the context is done. An empty path means that there is no file to watch.
+func Watch(ctx context.Context, path string, reload func(reason string)) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+
+	last := fileStamp(path)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			last = fileStamp(path)
+			reload("SIGHUP")
+		case <-ticker.C:
+			if stamp := fileStamp(path); stamp != last {
+				last = stamp
+				reload("the config file changed")
+			}
+		}
+	}
+}
+
+// fileStamp identifies a version of the file by its modification time and size.
+func fileStamp(path string) string {
+	if path == "" {
+		return ""
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "" // The file reappearing is a change as well
+	}
+	return fmt.Sprintf("%d/%d", info.ModTime().UnixNano(), info.Size())
+}
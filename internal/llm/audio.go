@@ -0,0 +1,83 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"unicode/utf8"
+)
+
+// Audio prices in USD.
+const (
+	TranscriptionPricePerMinute = 0.006
+	SpeechPricePerChar          = 15.0 / 1000000
+)
+
+// TranscriptionPrice estimates the cost of transcribing audio of the given duration.
+func TranscriptionPrice(seconds int) float64 {
+	return float64(seconds) / 60 * TranscriptionPricePerMinute
+}
+
+// SpeechPrice estimates the cost of synthesizing speech for the given text.
+func SpeechPrice(text string) float64 {
+	return float64(utf8.RuneCountInString(text)) * SpeechPricePerChar
+}
+
+// Transcribe converts speech in the audio file to text.
+func (c *OpenAI) Transcribe(ctx context.Context, model string, audio []byte, filename string) (string, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	if err := form.WriteField("model", model); err != nil {
+		return "", err
+	}
+	part, err := form.CreateFormFile("file", filename)
+	if err != nil {
+		return "", err
+	}
+	if _, err := part.Write(audio); err != nil {
+		return "", err
+	}
+	if err := form.Close(); err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/audio/transcriptions", &body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Text string `json:"text"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+	return result.Text, nil
+}
+
+// Speech synthesizes the text and returns it as OGG/Opus audio suitable for Telegram voice messages.
+func (c *OpenAI) Speech(ctx context.Context, model, voice, text string) ([]byte, error) {
+	resp, err := c.post(ctx, "/audio/speech", map[string]string{
+		"model":           model,
+		"voice":           voice,
+		"input":           text,
+		"response_format": "opus",
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
@@ -0,0 +1,169 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"strings"
+)
+
+// VariationModel is the only model supported by the image variations endpoint.
+const VariationModel = "dall-e-2"
+
+// ImageRequest describes an image to generate or edit.
+type ImageRequest struct {
+	Model   string
+	Prompt  string
+	Size    string // e.g. "1024x1024"; empty means the model default
+	Quality string // e.g. "standard", "hd", "low", "high"; empty means the model default
+}
+
+// imageResponse is the response of all image endpoints.
+type imageResponse struct {
+	Data []struct {
+		B64JSON       string `json:"b64_json"`
+		RevisedPrompt string `json:"revised_prompt"`
+	} `json:"data"`
+}
+
+// imagePrices holds USD prices per image keyed by model, quality and size.
+// An empty quality or size key matches any value.
+var imagePrices = map[string]map[string]map[string]float64{
+	"dall-e-2": {
+		"": {"256x256": 0.016, "512x512": 0.018, "": 0.020},
+	},
+	"dall-e-3": {
+		"hd": {"1024x1024": 0.080, "": 0.120},
+		"":   {"1024x1024": 0.040, "": 0.080},
+	},
+	"gpt-image-1": {
+		"low":    {"1024x1024": 0.011, "": 0.016},
+		"medium": {"1024x1024": 0.042, "": 0.063},
+		"":       {"1024x1024": 0.167, "": 0.250},
+	},
+}
+
+// ImagePrice estimates the cost of a single image in USD.
+// Unknown models are priced as zero.
+func ImagePrice(model, size, quality string) float64 {
+	byQuality, ok := imagePrices[model]
+	if !ok {
+		return 0
+	}
+	bySize, ok := byQuality[quality]
+	if !ok {
+		bySize = byQuality[""]
+	}
+	if size == "" {
+		size = "1024x1024"
+	}
+	if price, ok := bySize[size]; ok {
+		return price
+	}
+	return bySize[""]
+}
+
+// GenerateImage creates an image from a text prompt and returns it as PNG data.
+func (c *OpenAI) GenerateImage(ctx context.Context, req *ImageRequest) ([]byte, error) {
+	body := map[string]interface{}{
+		"model":  req.Model,
+		"prompt": req.Prompt,
+		"n":      1,
+	}
+	if req.Size != "" {
+		body["size"] = req.Size
+	}
+	if req.Quality != "" {
+		body["quality"] = req.Quality
+	}
+	if strings.HasPrefix(req.Model, "dall-e") {
+		body["response_format"] = "b64_json" // gpt-image models always return base64
+	}
+	resp, err := c.post(ctx, "/images/generations", body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return decodeImage(resp)
+}
+
+// EditImage redraws the given image according to the prompt.
+func (c *OpenAI) EditImage(ctx context.Context, req *ImageRequest, image []byte, filename string) ([]byte, error) {
+	fields := map[string]string{
+		"model":  req.Model,
+		"prompt": req.Prompt,
+		"size":   req.Size,
+	}
+	if req.Quality != "" {
+		fields["quality"] = req.Quality
+	}
+	if strings.HasPrefix(req.Model, "dall-e") {
+		fields["response_format"] = "b64_json"
+	}
+	return c.postImageForm(ctx, "/images/edits", fields, image, filename)
+}
+
+// CreateImageVariation creates a variation of the given square PNG image.
+func (c *OpenAI) CreateImageVariation(ctx context.Context, size string, image []byte) ([]byte, error) {
+	fields := map[string]string{
+		"model":           VariationModel,
+		"size":            size,
+		"response_format": "b64_json",
+	}
+	return c.postImageForm(ctx, "/images/variations", fields, image, "image.png")
+}
+
+// postImageForm uploads an image with additional form fields and decodes the resulting image.
+func (c *OpenAI) postImageForm(ctx context.Context, path string, fields map[string]string, image []byte, filename string) ([]byte, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for key, value := range fields {
+		if value == "" {
+			continue
+		}
+		if err := form.WriteField(key, value); err != nil {
+			return nil, err
+		}
+	}
+	part, err := form.CreateFormFile("image", filename)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := part.Write(image); err != nil {
+		return nil, err
+	}
+	if err := form.Close(); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+path, &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return decodeImage(resp)
+}
+
+// decodeImage extracts the first base64-encoded image from an image API response.
+func decodeImage(resp *http.Response) ([]byte, error) {
+	var result imageResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	if len(result.Data) == 0 || result.Data[0].B64JSON == "" {
+		return nil, errors.New("llm: no image in response")
+	}
+	return base64.StdEncoding.DecodeString(result.Data[0].B64JSON)
+}
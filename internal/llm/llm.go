@@ -0,0 +1,245 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Roles used in chat messages.
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+	RoleTool      = "tool"
+)
+
+// Message is a single chat message sent to or received from the model.
+type Message struct {
+	Role       string     `json:"role"`
+	Content    string     `json:"content"`
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`   // Tools the assistant wants to call
+	ToolCallID string     `json:"tool_call_id,omitempty"` // The call a RoleTool message answers
+}
+
+// ToolCall is a request of the model to call a tool.
+type ToolCall struct {
+	ID       string       `json:"id"`
+	Type     string       `json:"type"`
+	Function FunctionCall `json:"function"`
+}
+
+// FunctionCall holds the name of the called function and its JSON-encoded arguments.
+type FunctionCall struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// ChatRequest is the body of a chat-completions request.
+type ChatRequest struct {
+	Model       string     `json:"model"`
+	Messages    []Message  `json:"messages"`
+	Temperature *float64   `json:"temperature,omitempty"`
+	Tools       []ToolSpec `json:"tools,omitempty"`
+	ToolChoice  string     `json:"tool_choice,omitempty"`
+	Stream      bool       `json:"stream,omitempty"`
+}
+
+// chatResponse is the non-streaming chat-completions response.
+type chatResponse struct {
+	Choices []struct {
+		Message      Message `json:"message"`
+		FinishReason string  `json:"finish_reason"`
+	} `json:"choices"`
+}
+
+// chatChunk is a single server-sent event of a streaming chat-completions response.
+type chatChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content   string `json:"content"`
+			ToolCalls []struct {
+				Index int `json:"index"`
+				ToolCall
+			} `json:"tool_calls"`
+		} `json:"delta"`
+		FinishReason *string `json:"finish_reason"`
+	} `json:"choices"`
+}
+
+// apiError is the error envelope returned by the API.
+type apiError struct {
+	Error struct {
+		Message string `json:"message"`
+		Type    string `json:"type"`
+	} `json:"error"`
+}
+
+// Client implements Provider for any OpenAI-compatible chat-completions API
+// (OpenAI itself, llama.cpp server, Ollama, vLLM, ...).
+type Client struct {
+	name       string
+	apiKey     string
+	baseURL    string
+	models     []string
+	httpClient *http.Client
+}
+
+// NewClient creates a provider for an OpenAI-compatible API at baseURL.
+// apiKey may be empty for local servers which do not check it.
+func NewClient(name, baseURL, apiKey string, models []string) *Client {
+	return &Client{
+		name:       name,
+		apiKey:     apiKey,
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		models:     models,
+		httpClient: &http.Client{},
+	}
+}
+
+// Name returns the provider name.
+func (c *Client) Name() string {
+	return c.name
+}
+
+// Models returns the models offered by the provider; the first one is its default.
+func (c *Client) Models() []string {
+	return c.models
+}
+
+// Chat sends the request to the model and returns the complete assistant message.
+// An empty req.Model selects the provider's default model.
+func (c *Client) Chat(ctx context.Context, req *ChatRequest) (*Message, error) {
+	body := *req
+	body.Stream = false
+	if body.Model == "" {
+		body.Model = defaultModelOf(c)
+	}
+	resp, err := c.post(ctx, "/chat/completions", &body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result chatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	if len(result.Choices) == 0 {
+		return nil, errors.New("llm: empty response")
+	}
+	return &result.Choices[0].Message, nil
+}
+
+// ChatStream sends the request to the model and streams the answer.
+// onDelta is called for every received piece of text; returning an error from it aborts the stream.
+// Tool calls are collected from the stream and returned in the message.
+// The message accumulated so far is returned even if the stream was interrupted.
+func (c *Client) ChatStream(ctx context.Context, req *ChatRequest, onDelta func(delta string) error) (*Message, error) {
+	body := *req
+	body.Stream = true
+	if body.Model == "" {
+		body.Model = defaultModelOf(c)
+	}
+	resp, err := c.post(ctx, "/chat/completions", &body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var content strings.Builder
+	var toolCalls []ToolCall
+	answer := func() *Message {
+		return &Message{Role: RoleAssistant, Content: content.String(), ToolCalls: toolCalls}
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "data:") {
+			continue // Skip empty lines, comments and other SSE fields
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			return answer(), nil
+		}
+
+		var chunk chatChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return answer(), fmt.Errorf("llm: bad stream chunk: %w", err)
+		}
+		for _, choice := range chunk.Choices {
+			// Tool calls arrive in pieces: the first one carries the ID and the name,
+			// the following ones append to the arguments
+			for _, delta := range choice.Delta.ToolCalls {
+				for len(toolCalls) <= delta.Index {
+					toolCalls = append(toolCalls, ToolCall{Type: "function"})
+				}
+				call := &toolCalls[delta.Index]
+				if delta.ID != "" {
+					call.ID = delta.ID
+				}
+				call.Function.Name += delta.Function.Name
+				call.Function.Arguments += delta.Function.Arguments
+			}
+			if choice.Delta.Content == "" {
+				continue
+			}
+			content.WriteString(choice.Delta.Content)
+			if onDelta != nil {
+				if err := onDelta(choice.Delta.Content); err != nil {
+					return answer(), err
+				}
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return answer(), err
+	}
+	if err := ctx.Err(); err != nil {
+		return answer(), err
+	}
+	return answer(), nil
+}
+
+// post sends a JSON request to the API and checks the response status.
+func (c *Client) post(ctx context.Context, path string, body interface{}) (*http.Response, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+path, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+	return c.do(req)
+}
+
+// do executes the request and converts non-2xx responses to errors.
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		blob, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		var apiErr apiError
+		if json.Unmarshal(blob, &apiErr) == nil && apiErr.Error.Message != "" {
+			return nil, fmt.Errorf("llm: %s: %s", resp.Status, apiErr.Error.Message)
+		}
+		return nil, fmt.Errorf("llm: %s: %s", resp.Status, strings.TrimSpace(string(blob)))
+	}
+	return resp, nil
+}
@@ -0,0 +1,215 @@
+package llm
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gourbot/internal/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Helper function to create an OpenAI provider pointed at a test server
+func createTestClient(url string) *OpenAI {
+	return NewOpenAI(&config.Config{
+		OpenAIKey:     "test_key",
+		OpenAIBaseURL: url,
+		OpenAIModels:  []string{"test-model"},
+	})
+}
+
+func TestClient_Chat(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/chat/completions", r.URL.Path)
+		assert.Equal(t, "Bearer test_key", r.Header.Get("Authorization"))
+
+		var req ChatRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "test-model", req.Model)
+		assert.False(t, req.Stream)
+
+		fmt.Fprint(w, `{"choices":[{"message":{"role":"assistant","content":"hello"},"finish_reason":"stop"}]}`)
+	}))
+	defer server.Close()
+
+	answer, err := createTestClient(server.URL).Chat(context.Background(), &ChatRequest{
+		Messages: []Message{{Role: RoleUser, Content: "hi"}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", answer.Content)
+}
+
+func TestClient_ChatError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"error":{"message":"bad key","type":"invalid_request_error"}}`)
+	}))
+	defer server.Close()
+
+	_, err := createTestClient(server.URL).Chat(context.Background(), &ChatRequest{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "bad key")
+}
+
+func TestClient_ChatStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ChatRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.True(t, req.Stream)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, ": keep-alive\n\n")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"role\":\"assistant\"}}]}\n\n")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"Hel\"}}]}\n\n")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"lo\"}}]}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	var deltas []string
+	answer, err := createTestClient(server.URL).ChatStream(context.Background(), &ChatRequest{}, func(delta string) error {
+		deltas = append(deltas, delta)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello", answer.Content)
+	assert.Equal(t, []string{"Hel", "lo"}, deltas)
+}
+
+func TestClient_ChatStreamToolCalls(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"tool_calls\":[{\"index\":0,\"id\":\"call_1\",\"type\":\"function\",\"function\":{\"name\":\"calculate\",\"arguments\":\"\"}}]}}]}\n\n")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"tool_calls\":[{\"index\":0,\"function\":{\"arguments\":\"{\\\"expression\\\":\"}}]}}]}\n\n")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"tool_calls\":[{\"index\":0,\"function\":{\"arguments\":\"\\\"2+2\\\"}\"}}]}}]}\n\n")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{},\"finish_reason\":\"tool_calls\"}]}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	answer, err := createTestClient(server.URL).ChatStream(context.Background(), &ChatRequest{}, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, answer.Content)
+	if assert.Len(t, answer.ToolCalls, 1) {
+		assert.Equal(t, "call_1", answer.ToolCalls[0].ID)
+		assert.Equal(t, "calculate", answer.ToolCalls[0].Function.Name)
+		assert.Equal(t, `{"expression":"2+2"}`, answer.ToolCalls[0].Function.Arguments)
+	}
+}
+
+func TestClient_ChatStreamAbort(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"one\"}}]}\n\n")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"two\"}}]}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	stop := errors.New("stop")
+	answer, err := createTestClient(server.URL).ChatStream(context.Background(), &ChatRequest{}, func(delta string) error {
+		return stop
+	})
+	assert.ErrorIs(t, err, stop)
+	assert.Equal(t, "one", answer.Content)
+}
+
+func TestClient_GenerateImage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/images/generations", r.URL.Path)
+
+		var body map[string]interface{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, "dall-e-3", body["model"])
+		assert.Equal(t, "a cat", body["prompt"])
+		assert.Equal(t, "hd", body["quality"])
+		assert.Equal(t, "b64_json", body["response_format"])
+
+		fmt.Fprintf(w, `{"data":[{"b64_json":%q}]}`, base64.StdEncoding.EncodeToString([]byte("PNG")))
+	}))
+	defer server.Close()
+
+	image, err := createTestClient(server.URL).GenerateImage(context.Background(), &ImageRequest{
+		Model:   "dall-e-3",
+		Prompt:  "a cat",
+		Quality: "hd",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("PNG"), image)
+}
+
+func TestClient_EditImage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/images/edits", r.URL.Path)
+		assert.NoError(t, r.ParseMultipartForm(1024*1024))
+		assert.Equal(t, "gpt-image-1", r.FormValue("model"))
+		assert.Equal(t, "make it blue", r.FormValue("prompt"))
+		assert.Empty(t, r.FormValue("response_format"))
+
+		file, header, err := r.FormFile("image")
+		assert.NoError(t, err)
+		defer file.Close()
+		assert.Equal(t, "photo.jpg", header.Filename)
+
+		fmt.Fprintf(w, `{"data":[{"b64_json":%q}]}`, base64.StdEncoding.EncodeToString([]byte("EDITED")))
+	}))
+	defer server.Close()
+
+	image, err := createTestClient(server.URL).EditImage(context.Background(), &ImageRequest{
+		Model:  "gpt-image-1",
+		Prompt: "make it blue",
+	}, []byte("JPEG"), "photo.jpg")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("EDITED"), image)
+}
+
+func TestImagePrice(t *testing.T) {
+	assert.Equal(t, 0.040, ImagePrice("dall-e-3", "1024x1024", ""))
+	assert.Equal(t, 0.120, ImagePrice("dall-e-3", "1792x1024", "hd"))
+	assert.Equal(t, 0.018, ImagePrice("dall-e-2", "512x512", ""))
+	assert.Equal(t, 0.011, ImagePrice("gpt-image-1", "", "low"))
+	assert.Equal(t, 0.0, ImagePrice("unknown-model", "1024x1024", ""))
+}
+
+func TestClient_Transcribe(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/audio/transcriptions", r.URL.Path)
+		assert.NoError(t, r.ParseMultipartForm(1024*1024))
+		assert.Equal(t, "whisper-1", r.FormValue("model"))
+
+		_, header, err := r.FormFile("file")
+		assert.NoError(t, err)
+		assert.Equal(t, "voice.ogg", header.Filename)
+
+		fmt.Fprint(w, `{"text":"hello there"}`)
+	}))
+	defer server.Close()
+
+	text, err := createTestClient(server.URL).Transcribe(context.Background(), "whisper-1", []byte("OGG"), "voice.ogg")
+	assert.NoError(t, err)
+	assert.Equal(t, "hello there", text)
+}
+
+func TestClient_Speech(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/audio/speech", r.URL.Path)
+
+		var body map[string]string
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, "tts-1", body["model"])
+		assert.Equal(t, "alloy", body["voice"])
+		assert.Equal(t, "hi", body["input"])
+		assert.Equal(t, "opus", body["response_format"])
+
+		w.Write([]byte("OPUS"))
+	}))
+	defer server.Close()
+
+	audio, err := createTestClient(server.URL).Speech(context.Background(), "tts-1", "alloy", "hi")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("OPUS"), audio)
+}
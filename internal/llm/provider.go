@@ -0,0 +1,170 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gourbot/internal/config"
+)
+
+// OpenAIProviderName is the name of the provider backed by the OpenAI API.
+const OpenAIProviderName = "openai"
+
+// Provider is a source of chat completions.
+type Provider interface {
+	// Name returns the unique provider name used in "provider/model" references.
+	Name() string
+	// Models returns the models offered by the provider; the first one is its default.
+	// An empty list means that any model name is passed to the provider as is.
+	Models() []string
+	// Chat sends the request and returns the complete assistant message.
+	Chat(ctx context.Context, req *ChatRequest) (*Message, error)
+	// ChatStream sends the request, streams the answer text to onDelta and returns the assistant message.
+	ChatStream(ctx context.Context, req *ChatRequest, onDelta func(delta string) error) (*Message, error)
+}
+
+// OpenAI is the provider for the OpenAI API. In addition to chat completions it
+// provides the image and audio endpoints other servers usually lack.
+type OpenAI struct {
+	*Client
+}
+
+// NewOpenAI creates the OpenAI provider from the Config.
+func NewOpenAI(cfg *config.Config) *OpenAI {
+	return &OpenAI{Client: NewClient(OpenAIProviderName, cfg.OpenAIBaseURL, string(cfg.OpenAIKey), cfg.OpenAIModels)}
+}
+
+// Registry holds the configured providers and resolves model references to them.
+type Registry struct {
+	providers    []Provider
+	openai       *OpenAI
+	defaultModel string
+}
+
+// NewRegistry creates providers for everything configured: OpenAI if its key is set,
+// and every OpenAI-compatible endpoint from cfg.Providers.
+func NewRegistry(cfg *config.Config) (*Registry, error) {
+	r := &Registry{}
+	if cfg.OpenAIKey != "" {
+		r.openai = NewOpenAI(cfg)
+		r.providers = append(r.providers, r.openai)
+	}
+	for _, pc := range cfg.Providers {
+		if r.Provider(pc.Name) != nil {
+			return nil, fmt.Errorf("llm: duplicate provider %q", pc.Name)
+		}
+		r.providers = append(r.providers, NewClient(pc.Name, pc.BaseURL, string(pc.APIKey), pc.Models))
+	}
+	if len(r.providers) == 0 {
+		return nil, errors.New("llm: no providers configured")
+	}
+
+	r.defaultModel = cfg.DefaultModel
+	if r.defaultModel == "" {
+		for _, p := range r.providers {
+			if len(p.Models()) > 0 {
+				r.defaultModel = p.Name() + "/" + p.Models()[0]
+				break
+			}
+		}
+	}
+	if _, _, err := r.Resolve(r.defaultModel); err != nil {
+		return nil, fmt.Errorf("llm: bad default model: %w", err)
+	}
+	return r, nil
+}
+
+// Providers returns all configured providers.
+func (r *Registry) Providers() []Provider {
+	return r.providers
+}
+
+// Provider returns the provider with the given name or nil.
+func (r *Registry) Provider(name string) Provider {
+	for _, p := range r.providers {
+		if p.Name() == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// OpenAI returns the OpenAI provider or nil if no OpenAI key is configured.
+func (r *Registry) OpenAI() *OpenAI {
+	return r.openai
+}
+
+// DefaultModel returns the reference of the model used when nothing else is selected.
+func (r *Registry) DefaultModel() string {
+	return r.defaultModel
+}
+
+// Resolve finds the provider for a model reference and returns it with the model name
+// to send to it. The reference is either "provider/model" or a bare model name
+// looked up in the providers' model lists; an empty reference means the default model.
+func (r *Registry) Resolve(model string) (Provider, string, error) {
+	if model == "" {
+		if r.defaultModel == "" {
+			return nil, "", errors.New("no default model")
+		}
+		model = r.defaultModel
+	}
+	if name, rest, found := strings.Cut(model, "/"); found {
+		if p := r.Provider(name); p != nil {
+			if rest == "" {
+				rest = defaultModelOf(p)
+			}
+			if len(p.Models()) > 0 && !contains(p.Models(), rest) {
+				return nil, "", fmt.Errorf("provider %s does not offer model %q", name, rest)
+			}
+			return p, rest, nil
+		}
+	}
+	for _, p := range r.providers {
+		if contains(p.Models(), model) {
+			return p, model, nil
+		}
+	}
+	return nil, "", fmt.Errorf("unknown model %q", model)
+}
+
+// Chat resolves req.Model and sends the request to its provider.
+func (r *Registry) Chat(ctx context.Context, req *ChatRequest) (*Message, error) {
+	p, model, err := r.Resolve(req.Model)
+	if err != nil {
+		return nil, err
+	}
+	body := *req
+	body.Model = model
+	return p.Chat(ctx, &body)
+}
+
+// ChatStream resolves req.Model and streams the answer of its provider.
+func (r *Registry) ChatStream(ctx context.Context, req *ChatRequest, onDelta func(delta string) error) (*Message, error) {
+	p, model, err := r.Resolve(req.Model)
+	if err != nil {
+		return nil, err
+	}
+	body := *req
+	body.Model = model
+	return p.ChatStream(ctx, &body, onDelta)
+}
+
+// defaultModelOf returns the first model offered by the provider, if any.
+func defaultModelOf(p Provider) string {
+	if models := p.Models(); len(models) > 0 {
+		return models[0]
+	}
+	return ""
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
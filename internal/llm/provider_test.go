@@ -0,0 +1,118 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gourbot/internal/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewRegistry(t *testing.T) {
+	// OpenAI goes first and provides the default model
+	registry, err := NewRegistry(&config.Config{
+		OpenAIKey:    "key",
+		OpenAIModels: []string{"gpt-4o-mini", "gpt-4o"},
+		Providers: []config.ProviderConfig{
+			{Name: "local", BaseURL: "http://localhost:8080/v1", Models: []string{"llama3"}},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, registry.Providers(), 2)
+	assert.NotNil(t, registry.OpenAI())
+	assert.Equal(t, "openai/gpt-4o-mini", registry.DefaultModel())
+
+	// Without an OpenAI key only local providers are used
+	registry, err = NewRegistry(&config.Config{
+		Providers: []config.ProviderConfig{
+			{Name: "local", BaseURL: "http://localhost:8080/v1", Models: []string{"llama3"}},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, registry.OpenAI())
+	assert.Equal(t, "local/llama3", registry.DefaultModel())
+
+	// Explicit default model must be resolvable
+	_, err = NewRegistry(&config.Config{
+		Providers:    []config.ProviderConfig{{Name: "local", Models: []string{"llama3"}}},
+		DefaultModel: "local/mistral",
+	})
+	assert.Error(t, err)
+
+	_, err = NewRegistry(&config.Config{})
+	assert.Error(t, err, "registry without providers should fail")
+
+	_, err = NewRegistry(&config.Config{
+		Providers: []config.ProviderConfig{{Name: "local", Models: []string{"a"}}, {Name: "local"}},
+	})
+	assert.Error(t, err, "duplicate providers should fail")
+}
+
+func TestRegistry_Resolve(t *testing.T) {
+	registry, err := NewRegistry(&config.Config{
+		OpenAIKey:    "key",
+		OpenAIModels: []string{"gpt-4o-mini", "gpt-4o"},
+		Providers: []config.ProviderConfig{
+			{Name: "local", Models: []string{"llama3", "meta-llama/Llama-3-8B"}},
+			{Name: "any"},
+		},
+	})
+	assert.NoError(t, err)
+
+	tests := []struct {
+		ref      string
+		provider string
+		model    string
+	}{
+		{"", "openai", "gpt-4o-mini"},
+		{"gpt-4o", "openai", "gpt-4o"},
+		{"llama3", "local", "llama3"},
+		{"local/llama3", "local", "llama3"},
+		{"local/", "local", "llama3"},
+		{"meta-llama/Llama-3-8B", "local", "meta-llama/Llama-3-8B"},
+		{"any/whatever", "any", "whatever"},
+	}
+	for _, tt := range tests {
+		p, model, err := registry.Resolve(tt.ref)
+		if assert.NoError(t, err, "reference %q", tt.ref) {
+			assert.Equal(t, tt.provider, p.Name(), "reference %q", tt.ref)
+			assert.Equal(t, tt.model, model, "reference %q", tt.ref)
+		}
+	}
+
+	for _, ref := range []string{"unknown", "local/gpt-4o", "nobody/llama3"} {
+		_, _, err := registry.Resolve(ref)
+		assert.Error(t, err, "reference %q should not resolve", ref)
+	}
+}
+
+func TestRegistry_Chat(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Empty(t, r.Header.Get("Authorization"), "local provider without a key should not authorize")
+
+		var req ChatRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		fmt.Fprintf(w, `{"choices":[{"message":{"role":"assistant","content":%q}}]}`, req.Model)
+	}))
+	defer server.Close()
+
+	registry, err := NewRegistry(&config.Config{
+		Providers: []config.ProviderConfig{
+			{Name: "local", BaseURL: server.URL, Models: []string{"llama3", "qwen2"}},
+		},
+	})
+	assert.NoError(t, err)
+
+	answer, err := registry.Chat(context.Background(), &ChatRequest{Model: "local/qwen2"})
+	assert.NoError(t, err)
+	assert.Equal(t, "qwen2", answer.Content, "provider prefix should be stripped from the model")
+
+	answer, err = registry.Chat(context.Background(), &ChatRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, "llama3", answer.Content, "default model should be used")
+}
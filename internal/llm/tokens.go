@@ -0,0 +1,46 @@
+package llm
+
+import "unicode/utf8"
+
+// messageOverhead approximates the tokens the chat format adds to every message.
+const messageOverhead = 4
+
+// EstimateTokens roughly estimates the number of tokens of a text without a tokenizer:
+// about four characters per token for ASCII and two for other scripts, which tokenizers
+// split much finer.
+func EstimateTokens(text string) int {
+	ascii, other := 0, 0
+	for _, r := range text {
+		if r < utf8.RuneSelf {
+			ascii++
+		} else {
+			other++
+		}
+	}
+	return (ascii+3)/4 + (other+1)/2
+}
+
+// EstimateMessageTokens roughly estimates the number of tokens a message takes in a request.
+func EstimateMessageTokens(msg *Message) int {
+	return EstimateTokens(msg.Content) + messageOverhead
+}
+
+// chatPrices holds USD prices per million input and output tokens keyed by model.
+var chatPrices = map[string][2]float64{
+	"gpt-4o":       {2.50, 10.00},
+	"gpt-4o-mini":  {0.15, 0.60},
+	"gpt-4.1":      {2.00, 8.00},
+	"gpt-4.1-mini": {0.40, 1.60},
+	"gpt-4.1-nano": {0.10, 0.40},
+	"o4-mini":      {1.10, 4.40},
+}
+
+// ChatPrice estimates the cost of a chat completion from its token counts.
+// Unknown models, like local ones, are priced as zero.
+func ChatPrice(model string, inputTokens, outputTokens int) float64 {
+	price, ok := chatPrices[model]
+	if !ok {
+		return 0
+	}
+	return (float64(inputTokens)*price[0] + float64(outputTokens)*price[1]) / 1000000
+}
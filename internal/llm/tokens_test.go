@@ -0,0 +1,20 @@
+package llm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEstimateTokens(t *testing.T) {
+	assert.Equal(t, 0, EstimateTokens(""))
+	assert.Equal(t, 1, EstimateTokens("a"))
+	assert.Equal(t, 3, EstimateTokens("Hello, world"))
+	assert.Equal(t, 3, EstimateTokens("привет"), "non-ASCII text takes more tokens per character")
+	assert.Equal(t, 5, EstimateMessageTokens(&Message{Role: RoleUser, Content: "test"}))
+}
+
+func TestChatPrice(t *testing.T) {
+	assert.InDelta(t, 0.00075, ChatPrice("gpt-4o-mini", 1000, 1000), 1e-9)
+	assert.Equal(t, 0.0, ChatPrice("llama3", 1000, 1000), "unknown models are free")
+}
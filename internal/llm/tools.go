@@ -0,0 +1,185 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+)
+
+// ToolSpec describes a tool to the model.
+type ToolSpec struct {
+	Type     string       `json:"type"`
+	Function FunctionSpec `json:"function"`
+}
+
+// FunctionSpec is the function part of a ToolSpec.
+type FunctionSpec struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Parameters  json.RawMessage `json:"parameters"`
+}
+
+// ToolFunc executes a tool with JSON-encoded arguments and returns the result for the model.
+type ToolFunc func(ctx context.Context, args json.RawMessage) (string, error)
+
+// ChatFunc sends a chat request, e.g. Registry.Chat or a closure over Registry.ChatStream.
+type ChatFunc func(ctx context.Context, req *ChatRequest) (*Message, error)
+
+// Tool is a Go function the model may call.
+type Tool struct {
+	Name        string
+	Description string
+	Parameters  string // JSON schema of the arguments object
+	Permission  string // Permission required to use the tool; tools without one are never offered
+	Func        ToolFunc
+}
+
+// ToolInvocation describes a finished tool call, reported for auditing.
+type ToolInvocation struct {
+	Name      string
+	Arguments string
+	Result    string
+	Err       error
+}
+
+// RunOptions controls a tool-call loop.
+type RunOptions struct {
+	Allowed  func(permission string) bool // Checks tool permissions, nil allows no tool
+	MaxSteps int                          // Maximal number of rounds with tool calls
+	OnCall   func(inv *ToolInvocation)    // Optional audit callback
+}
+
+var toolNameRe = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// ToolRegistry holds the tools available to the model.
+type ToolRegistry struct {
+	tools []*Tool
+}
+
+// NewToolRegistry creates an empty ToolRegistry.
+func NewToolRegistry() *ToolRegistry {
+	return &ToolRegistry{}
+}
+
+// Register adds a tool to the registry.
+func (r *ToolRegistry) Register(tool *Tool) error {
+	if !toolNameRe.MatchString(tool.Name) {
+		return fmt.Errorf("llm: bad tool name %q", tool.Name)
+	}
+	if r.Tool(tool.Name) != nil {
+		return fmt.Errorf("llm: duplicate tool %q", tool.Name)
+	}
+	if !json.Valid([]byte(tool.Parameters)) {
+		return fmt.Errorf("llm: tool %q has invalid parameters schema", tool.Name)
+	}
+	if tool.Func == nil {
+		return fmt.Errorf("llm: tool %q has no function", tool.Name)
+	}
+	if tool.Permission == "" {
+		return fmt.Errorf("llm: tool %q has no permission", tool.Name)
+	}
+	r.tools = append(r.tools, tool)
+	return nil
+}
+
+// Tool returns the tool with the given name or nil.
+func (r *ToolRegistry) Tool(name string) *Tool {
+	for _, tool := range r.tools {
+		if tool.Name == name {
+			return tool
+		}
+	}
+	return nil
+}
+
+// Specs describes the tools allowed by the permission check to the model.
+func (r *ToolRegistry) Specs(allowed func(permission string) bool) []ToolSpec {
+	var specs []ToolSpec
+	for _, tool := range r.tools {
+		if !toolAllowed(tool, allowed) {
+			continue
+		}
+		specs = append(specs, ToolSpec{
+			Type: "function",
+			Function: FunctionSpec{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  json.RawMessage(tool.Parameters),
+			},
+		})
+	}
+	return specs
+}
+
+// Run sends the request with the allowed tools attached and executes the tools the
+// model calls, feeding the results back until the model answers with plain text.
+// After opts.MaxSteps rounds of tool calls the model is asked to answer without tools.
+func (r *ToolRegistry) Run(ctx context.Context, req *ChatRequest, chat ChatFunc, opts RunOptions) (*Message, error) {
+	body := *req
+	body.Messages = append([]Message(nil), req.Messages...)
+	body.Tools = r.Specs(opts.Allowed)
+
+	for step := 0; ; step++ {
+		if len(body.Tools) > 0 && step >= opts.MaxSteps {
+			body.ToolChoice = "none"
+		}
+		msg, err := chat(ctx, &body)
+		if err != nil || len(msg.ToolCalls) == 0 || len(body.Tools) == 0 || body.ToolChoice == "none" {
+			return msg, err
+		}
+
+		body.Messages = append(body.Messages, *msg)
+		for _, call := range msg.ToolCalls {
+			body.Messages = append(body.Messages, Message{
+				Role:       RoleTool,
+				ToolCallID: call.ID,
+				Content:    r.call(ctx, &call, opts),
+			})
+		}
+	}
+}
+
+// call executes a single tool call and returns the text reported back to the model.
+// Errors are reported to the model as well, so it can correct itself or explain them.
+func (r *ToolRegistry) call(ctx context.Context, call *ToolCall, opts RunOptions) string {
+	inv := &ToolInvocation{Name: call.Function.Name, Arguments: call.Function.Arguments}
+	tool := r.Tool(call.Function.Name)
+	switch {
+	case tool == nil:
+		inv.Err = fmt.Errorf("unknown tool %q", call.Function.Name)
+	case !toolAllowed(tool, opts.Allowed):
+		inv.Err = fmt.Errorf("tool %q is not allowed", call.Function.Name)
+	default:
+		inv.Result, inv.Err = runTool(ctx, tool, call.Function.Arguments)
+	}
+	if opts.OnCall != nil {
+		opts.OnCall(inv)
+	}
+	if inv.Err != nil {
+		return "error: " + inv.Err.Error()
+	}
+	return inv.Result
+}
+
+// runTool calls the tool function, converting panics into errors.
+func runTool(ctx context.Context, tool *Tool, args string) (result string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("tool %q panicked: %v", tool.Name, r)
+		}
+	}()
+	if args == "" {
+		args = "{}"
+	}
+	if !json.Valid([]byte(args)) {
+		return "", fmt.Errorf("arguments are not valid JSON")
+	}
+	return tool.Func(ctx, json.RawMessage(args))
+}
+
+// toolAllowed reports whether the caller has the permission of the tool. Tools without a
+// permission are rejected, so that a forgotten permission cannot open a tool to everybody.
+func toolAllowed(tool *Tool, allowed func(permission string) bool) bool {
+	return tool.Permission != "" && allowed != nil && allowed(tool.Permission)
+}
@@ -0,0 +1,168 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// allowEcho grants the permission of the echo tool only.
+func allowEcho(permission string) bool {
+	return permission == "CanEcho"
+}
+
+// createTestTools creates a registry with an echo tool and a secret tool with different permissions.
+func createTestTools(t *testing.T) *ToolRegistry {
+	tools := NewToolRegistry()
+	assert.NoError(t, tools.Register(&Tool{
+		Name:       "echo",
+		Parameters: `{"type":"object","properties":{"text":{"type":"string"}}}`,
+		Permission: "CanEcho",
+		Func: func(_ context.Context, args json.RawMessage) (string, error) {
+			var params struct{ Text string }
+			err := json.Unmarshal(args, &params)
+			return params.Text, err
+		},
+	}))
+	assert.NoError(t, tools.Register(&Tool{
+		Name:       "secret",
+		Parameters: `{"type":"object"}`,
+		Permission: "CanSecret",
+		Func: func(context.Context, json.RawMessage) (string, error) {
+			return "42", nil
+		},
+	}))
+	return tools
+}
+
+// toolCallMessage creates an assistant message calling a single tool.
+func toolCallMessage(id, name, args string) *Message {
+	return &Message{Role: RoleAssistant, ToolCalls: []ToolCall{
+		{ID: id, Type: "function", Function: FunctionCall{Name: name, Arguments: args}},
+	}}
+}
+
+func TestToolRegistry_Register(t *testing.T) {
+	tools := createTestTools(t)
+	noop := func(context.Context, json.RawMessage) (string, error) { return "", nil }
+
+	assert.Error(t, tools.Register(&Tool{Name: "echo", Parameters: `{}`, Permission: "CanEcho", Func: noop}), "duplicate name")
+	assert.Error(t, tools.Register(&Tool{Name: "bad name", Parameters: `{}`, Permission: "CanEcho", Func: noop}), "bad name")
+	assert.Error(t, tools.Register(&Tool{Name: "broken", Parameters: `{`, Permission: "CanEcho", Func: noop}), "bad schema")
+	assert.Error(t, tools.Register(&Tool{Name: "nofunc", Parameters: `{}`, Permission: "CanEcho"}), "missing function")
+	assert.Error(t, tools.Register(&Tool{Name: "open", Parameters: `{}`, Func: noop}), "missing permission")
+
+	assert.Empty(t, tools.Specs(nil), "no tool should be offered without a permission check")
+	specs := tools.Specs(allowEcho)
+	if assert.Len(t, specs, 1, "tools should be hidden without their permission") {
+		assert.Equal(t, "echo", specs[0].Function.Name)
+		assert.Equal(t, "function", specs[0].Type)
+	}
+	specs = tools.Specs(func(permission string) bool { return permission == "CanEcho" || permission == "CanSecret" })
+	assert.Len(t, specs, 2)
+}
+
+func TestToolAllowed(t *testing.T) {
+	allowAll := func(string) bool { return true }
+	assert.False(t, toolAllowed(&Tool{Name: "open"}, allowAll), "tools without a permission should be rejected")
+	assert.True(t, toolAllowed(&Tool{Name: "echo", Permission: "CanEcho"}, allowEcho))
+	assert.False(t, toolAllowed(&Tool{Name: "secret", Permission: "CanSecret"}, allowEcho))
+	assert.False(t, toolAllowed(&Tool{Name: "echo", Permission: "CanEcho"}, nil))
+}
+
+func TestToolRegistry_Run(t *testing.T) {
+	tools := createTestTools(t)
+	var requests []ChatRequest
+	chat := func(_ context.Context, req *ChatRequest) (*Message, error) {
+		requests = append(requests, *req)
+		if len(requests) == 1 {
+			return &Message{Role: RoleAssistant, ToolCalls: []ToolCall{
+				{ID: "1", Function: FunctionCall{Name: "echo", Arguments: `{"text":"hi"}`}},
+				{ID: "2", Function: FunctionCall{Name: "secret"}},
+			}}, nil
+		}
+		return &Message{Role: RoleAssistant, Content: "done"}, nil
+	}
+
+	var calls []*ToolInvocation
+	req := &ChatRequest{Messages: []Message{{Role: RoleUser, Content: "go"}}}
+	answer, err := tools.Run(context.Background(), req, chat, RunOptions{
+		Allowed:  allowEcho,
+		MaxSteps: 3,
+		OnCall:   func(inv *ToolInvocation) { calls = append(calls, inv) },
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "done", answer.Content)
+	assert.Len(t, req.Messages, 1, "the original request should not be modified")
+
+	if assert.Len(t, requests, 2) {
+		assert.Len(t, requests[0].Tools, 1, "only allowed tools should be offered")
+		messages := requests[1].Messages
+		if assert.Len(t, messages, 4) {
+			assert.Len(t, messages[1].ToolCalls, 2)
+			assert.Equal(t, Message{Role: RoleTool, ToolCallID: "1", Content: "hi"}, messages[2])
+			assert.Equal(t, "2", messages[3].ToolCallID)
+			assert.Contains(t, messages[3].Content, "not allowed")
+		}
+	}
+	if assert.Len(t, calls, 2) {
+		assert.Equal(t, "hi", calls[0].Result)
+		assert.NoError(t, calls[0].Err)
+		assert.Error(t, calls[1].Err)
+	}
+}
+
+func TestToolRegistry_RunMaxSteps(t *testing.T) {
+	tools := createTestTools(t)
+	var choices []string
+	chat := func(_ context.Context, req *ChatRequest) (*Message, error) {
+		choices = append(choices, req.ToolChoice)
+		if req.ToolChoice == "none" {
+			return &Message{Role: RoleAssistant, Content: "gave up"}, nil
+		}
+		return toolCallMessage("x", "echo", `{"text":"again"}`), nil
+	}
+
+	answer, err := tools.Run(context.Background(), &ChatRequest{}, chat, RunOptions{Allowed: allowEcho, MaxSteps: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, "gave up", answer.Content)
+	assert.Equal(t, []string{"", "", "none"}, choices, "tools should be disabled after MaxSteps rounds")
+}
+
+func TestToolRegistry_RunErrors(t *testing.T) {
+	tools := NewToolRegistry()
+	assert.NoError(t, tools.Register(&Tool{
+		Name:       "panic",
+		Parameters: `{}`,
+		Permission: "CanPanic",
+		Func:       func(context.Context, json.RawMessage) (string, error) { panic("boom") },
+	}))
+
+	var results []string
+	chat := func(_ context.Context, req *ChatRequest) (*Message, error) {
+		if n := len(req.Messages); n > 0 && req.Messages[n-1].Role == RoleTool {
+			results = append(results, req.Messages[n-1].Content)
+		}
+		switch len(results) {
+		case 0:
+			return toolCallMessage("1", "panic", ""), nil
+		case 1:
+			return toolCallMessage("2", "missing", "{}"), nil
+		case 2:
+			return toolCallMessage("3", "panic", "{bad"), nil
+		}
+		return nil, errors.New("failed")
+	}
+
+	allowAll := func(string) bool { return true }
+	_, err := tools.Run(context.Background(), &ChatRequest{}, chat, RunOptions{Allowed: allowAll, MaxSteps: 5})
+	assert.EqualError(t, err, "failed", "chat errors should be returned")
+	if assert.Len(t, results, 3) {
+		assert.Contains(t, results[0], "panicked")
+		assert.Contains(t, results[1], "unknown tool")
+		assert.Contains(t, results[2], "not valid JSON")
+	}
+}
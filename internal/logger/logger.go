@@ -3,6 +3,7 @@ package logger
 import (
 	"io"
 	"os"
+	"sync"
 
 	"gourbot/internal/config"
 
@@ -10,20 +11,37 @@ import (
 	"gopkg.in/natefinch/lumberjack.v2"
 )
 
+var (
+	mu      sync.Mutex
+	logFile *lumberjack.Logger // Current rotating log file, closed when replaced
+)
+
 // InitLogger initializes the logger with log rotation using the provided Config.
 func InitLogger(cfg *config.Config) *logrus.Logger {
 	logger := logrus.New()
 
+	// Set log format to JSON
+	logger.SetFormatter(&logrus.JSONFormatter{})
+
+	Apply(logger, cfg)
+	return logger
+}
+
+// Apply sets the level and the outputs of the logger from the Config. It is used again
+// when the configuration is reloaded.
+func Apply(logger *logrus.Logger, cfg *config.Config) {
+	mu.Lock()
+	defer mu.Unlock()
+
 	// Set log output to a rotating file
-	logOutputs := []io.Writer{
-		&lumberjack.Logger{
-			Filename:   cfg.LogFilename,
-			MaxSize:    cfg.LogMaxSize,    // Max megabytes before log is rotated
-			MaxBackups: cfg.LogMaxBackups, // Max number of old log files to keep
-			MaxAge:     cfg.LogMaxAge,     // Max number of days to retain old log files
-			Compress:   cfg.LogCompress,   // Compress the old log files
-		},
+	file := &lumberjack.Logger{
+		Filename:   cfg.LogFilename,
+		MaxSize:    cfg.LogMaxSize,    // Max megabytes before log is rotated
+		MaxBackups: cfg.LogMaxBackups, // Max number of old log files to keep
+		MaxAge:     cfg.LogMaxAge,     // Max number of days to retain old log files
+		Compress:   cfg.LogCompress,   // Compress the old log files
 	}
+	logOutputs := []io.Writer{file}
 
 	// If LogStdout is enabled, add stdout to the log outputs
 	if cfg.LogStdout {
@@ -31,12 +49,14 @@ func InitLogger(cfg *config.Config) *logrus.Logger {
 	}
 
 	logger.SetOutput(io.MultiWriter(logOutputs...))
+	if logFile != nil {
+		logFile.Close()
+	}
+	logFile = file
 
-	// Set log format to JSON
-	logger.SetFormatter(&logrus.JSONFormatter{})
-
-	// Set log level to Info
-	logger.SetLevel(logrus.InfoLevel)
-
-	return logger
+	level, err := logrus.ParseLevel(cfg.LogLevel)
+	if err != nil {
+		level = logrus.InfoLevel
+	}
+	logger.SetLevel(level)
 }
@@ -0,0 +1,157 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "time/tzdata" // User time zones must resolve even without system zoneinfo
+)
+
+// cronField describes the allowed values of a cron expression field.
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = [5]cronField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7}, // Both 0 and 7 are Sunday
+}
+
+// maxCronYears limits the search for the next run of an expression which never matches,
+// like February 30.
+const maxCronYears = 5
+
+// Cron is a parsed cron expression: "minute hour day-of-month month day-of-week" with
+// *, lists, ranges and steps. As usual, if both day fields are restricted, a day matching
+// either of them matches.
+type Cron struct {
+	spec   string
+	fields [5]uint64 // Bit sets of the allowed values
+	anyDom bool      // The day of month is "*"
+	anyDow bool      // The day of week is "*"
+}
+
+// ParseCron parses a cron expression.
+func ParseCron(spec string) (*Cron, error) {
+	parts := strings.Fields(spec)
+	if len(parts) != len(cronFields) {
+		return nil, fmt.Errorf("cron expression needs %d fields, got %d", len(cronFields), len(parts))
+	}
+	c := &Cron{spec: strings.Join(parts, " "), anyDom: parts[2] == "*", anyDow: parts[4] == "*"}
+	for i, part := range parts {
+		bits, err := parseCronField(part, cronFields[i])
+		if err != nil {
+			return nil, err
+		}
+		c.fields[i] = bits
+	}
+	if c.fields[4]&(1<<7) != 0 {
+		c.fields[4] |= 1 // Sunday
+	}
+	return c, nil
+}
+
+// parseCronField parses a comma-separated list of values, ranges and steps.
+func parseCronField(part string, field cronField) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(part, ",") {
+		rng, stepStr, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepStr); err != nil || step <= 0 {
+				return 0, fmt.Errorf("bad step %q in %s", stepStr, field.name)
+			}
+		}
+		lo, hi := field.min, field.max
+		if rng != "*" {
+			loStr, hiStr, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = strconv.Atoi(loStr); err != nil {
+				return 0, fmt.Errorf("bad %s %q", field.name, item)
+			}
+			hi = lo
+			if isRange {
+				if hi, err = strconv.Atoi(hiStr); err != nil {
+					return 0, fmt.Errorf("bad %s %q", field.name, item)
+				}
+			} else if hasStep {
+				hi = field.max // "5/15" means from 5 on
+			}
+		}
+		if lo < field.min || hi > field.max || lo > hi {
+			return 0, fmt.Errorf("%s %q is out of range %d-%d", field.name, item, field.min, field.max)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+// String returns the normalized expression.
+func (c *Cron) String() string {
+	return c.spec
+}
+
+// Next returns the first time after the given one which matches the expression, in the
+// location of the given time. It returns the zero time if there is none in the next years.
+func (c *Cron) Next(after time.Time) time.Time {
+	loc := after.Location()
+	t := time.Date(after.Year(), after.Month(), after.Day(), after.Hour(), after.Minute()+1, 0, 0, loc)
+	limit := after.Year() + maxCronYears
+	for t.Year() <= limit {
+		switch {
+		case !c.has(3, int(t.Month())):
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case !c.has(1, t.Hour()):
+			next := time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			if skipped := t.Hour() + 1; next.Hour() != skipped%24 && next.Day() == t.Day() && c.has(1, skipped) {
+				// The clocks moved forward over a matching hour: run in the first minute after the gap,
+				// like cron does, instead of skipping the day
+				return time.Date(t.Year(), t.Month(), t.Day(), skipped, c.first(0), 0, 0, loc)
+			}
+			t = next
+		case !c.has(0, t.Minute()):
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()+1, 0, 0, loc)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (c *Cron) dayMatches(t time.Time) bool {
+	dom, dow := c.has(2, t.Day()), c.has(4, int(t.Weekday()))
+	switch {
+	case c.anyDom && c.anyDow:
+		return true
+	case c.anyDom:
+		return dow
+	case c.anyDow:
+		return dom
+	}
+	return dom || dow
+}
+
+// first returns the smallest allowed value of the field.
+func (c *Cron) first(field int) int {
+	for v := cronFields[field].min; v <= cronFields[field].max; v++ {
+		if c.has(field, v) {
+			return v
+		}
+	}
+	return cronFields[field].min
+}
+
+func (c *Cron) has(field, value int) bool {
+	return c.fields[field]&(1<<value) != 0
+}
@@ -0,0 +1,361 @@
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultHour is the time of day of reminders given only by the day, like "tomorrow".
+const defaultHour = 9
+
+// Examples is a short help on the understood reminder times.
+const Examples = `in 10 minutes, in 2h30m, at 18:00, today at 6pm, tomorrow at 9,
+monday at 10:30, on 2026-12-31 at 23:59, 31.12 at 8,
+every day at 9, every weekday at 8:15, every friday at 17, every 2 hours,
+cron 0 9 * * 1-5`
+
+// Reminder is a parsed reminder request.
+type Reminder struct {
+	At   time.Time // The first delivery
+	Cron string    // Recurrence as a cron expression, empty for a one-shot reminder
+	Text string
+}
+
+var (
+	clockRe   = regexp.MustCompile(`^(\d{1,2})(?::(\d{2}))?(am|pm)?$`)
+	isoDateRe = regexp.MustCompile(`^(\d{4})-(\d{2})-(\d{2})$`)
+	dotDateRe = regexp.MustCompile(`^(\d{1,2})\.(\d{1,2})(?:\.(\d{4}))?$`)
+)
+
+var weekdays = map[string]time.Weekday{
+	"sunday": time.Sunday, "sun": time.Sunday,
+	"monday": time.Monday, "mon": time.Monday,
+	"tuesday": time.Tuesday, "tue": time.Tuesday,
+	"wednesday": time.Wednesday, "wed": time.Wednesday,
+	"thursday": time.Thursday, "thu": time.Thursday,
+	"friday": time.Friday, "fri": time.Friday,
+	"saturday": time.Saturday, "sat": time.Saturday,
+}
+
+var units = map[string]time.Duration{
+	"minute": time.Minute, "minutes": time.Minute, "min": time.Minute, "mins": time.Minute,
+	"hour": time.Hour, "hours": time.Hour, "h": time.Hour,
+	"day": 24 * time.Hour, "days": 24 * time.Hour,
+	"week": 7 * 24 * time.Hour, "weeks": 7 * 24 * time.Hour,
+}
+
+// parser consumes the words of a reminder request.
+type parser struct {
+	words []string // Original words, the text of the reminder is taken from them
+	pos   int
+	now   time.Time
+}
+
+func (p *parser) peek(offset int) string {
+	if p.pos+offset < len(p.words) {
+		return strings.ToLower(p.words[p.pos+offset])
+	}
+	return ""
+}
+
+func (p *parser) accept(words ...string) bool {
+	for _, word := range words {
+		if p.peek(0) == word {
+			p.pos++
+			return true
+		}
+	}
+	return false
+}
+
+// ParseReminder parses "<when> [to] <text>", where now carries the user's time zone.
+// Recurring reminders start with "every" or "cron", see Examples.
+func ParseReminder(input string, now time.Time) (*Reminder, error) {
+	p := &parser{words: strings.Fields(input), now: now}
+	p.accept("me")
+
+	var r *Reminder
+	var err error
+	switch {
+	case p.accept("every"):
+		r, err = p.every()
+	case p.accept("cron"):
+		r, err = p.cron()
+	default:
+		var at time.Time
+		if at, err = p.when(); err == nil {
+			if !at.After(now) {
+				return nil, fmt.Errorf("%s is in the past", at.Format("2006-01-02 15:04"))
+			}
+			r = &Reminder{At: at}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	p.accept("to")
+	r.Text = strings.Join(p.words[p.pos:], " ")
+	if r.Text == "" {
+		return nil, errors.New("what should I remind you about?")
+	}
+	return r, nil
+}
+
+// when parses the time of a one-shot reminder.
+func (p *parser) when() (time.Time, error) {
+	now := p.now
+	word := p.peek(0)
+	switch {
+	case word == "in":
+		p.pos++
+		d, err := p.duration()
+		return now.Add(d), err
+
+	case word == "today" || word == "tonight" || word == "tomorrow":
+		p.pos++
+		day := now
+		if word == "tomorrow" {
+			day = now.AddDate(0, 0, 1)
+		}
+		hour, minute, err := p.optionalClock(word == "tomorrow")
+		if err != nil {
+			return time.Time{}, err
+		}
+		return atClock(day, hour, minute), nil
+
+	case word == "on" || isDay(word):
+		p.accept("on")
+		day, err := p.day()
+		if err != nil {
+			return time.Time{}, err
+		}
+		hour, minute, err := p.optionalClock(true)
+		if err != nil {
+			return time.Time{}, err
+		}
+		at := atClock(day, hour, minute)
+		if _, weekday := weekdays[word]; weekday && !at.After(now) {
+			at = at.AddDate(0, 0, 7) // Today is that weekday, but the time has passed
+		}
+		return at, nil
+
+	case word == "at" || isClock(word, p.peek(1)):
+		hour, minute, err := p.optionalClock(false)
+		if err != nil {
+			return time.Time{}, err
+		}
+		at := atClock(now, hour, minute)
+		if !at.After(now) {
+			at = at.AddDate(0, 0, 1)
+		}
+		return at, nil
+	}
+	return time.Time{}, errors.New("cannot understand when to remind you")
+}
+
+// isDay reports whether the word names a day: a weekday or a date.
+func isDay(word string) bool {
+	_, weekday := weekdays[word]
+	return weekday || isoDateRe.MatchString(word) || dotDateRe.MatchString(word)
+}
+
+// isClock reports whether the words are a time of day without "at".
+func isClock(word, next string) bool {
+	return clockRe.MatchString(word) && (strings.Contains(word, ":") || strings.HasSuffix(word, "m") || next == "am" || next == "pm")
+}
+
+// day parses a weekday or a date, returning midnight of the day.
+func (p *parser) day() (time.Time, error) {
+	word := p.peek(0)
+	now := p.now
+	if weekday, ok := weekdays[word]; ok {
+		p.pos++
+		days := (int(weekday) - int(now.Weekday()) + 7) % 7
+		return atClock(now.AddDate(0, 0, days), 0, 0), nil
+	}
+	if m := isoDateRe.FindStringSubmatch(word); m != nil {
+		p.pos++
+		year, _ := strconv.Atoi(m[1])
+		month, _ := strconv.Atoi(m[2])
+		day, _ := strconv.Atoi(m[3])
+		return date(year, month, day, now.Location())
+	}
+	if m := dotDateRe.FindStringSubmatch(word); m != nil {
+		p.pos++
+		day, _ := strconv.Atoi(m[1])
+		month, _ := strconv.Atoi(m[2])
+		year := now.Year()
+		if m[3] != "" {
+			year, _ = strconv.Atoi(m[3])
+		}
+		t, err := date(year, month, day, now.Location())
+		if err == nil && m[3] == "" && t.Before(atClock(now, 0, 0)) {
+			t = t.AddDate(1, 0, 0) // A day of the year which has passed means the next year
+		}
+		return t, err
+	}
+	return time.Time{}, fmt.Errorf("cannot understand the day %q", word)
+}
+
+// date validates and builds a date.
+func date(year, month, day int, loc *time.Location) (time.Time, error) {
+	t := time.Date(year, time.Month(month), day, 0, 0, 0, 0, loc)
+	if t.Day() != day || int(t.Month()) != month {
+		return time.Time{}, fmt.Errorf("there is no day %d.%d.%d", day, month, year)
+	}
+	return t, nil
+}
+
+// duration parses "10 minutes", "an hour", "2h30m" and the like.
+func (p *parser) duration() (time.Duration, error) {
+	word := p.peek(0)
+	if d, err := time.ParseDuration(word); err == nil && d > 0 {
+		p.pos++
+		return d, nil
+	}
+	n := 1
+	if word != "a" && word != "an" {
+		var err error
+		if n, err = strconv.Atoi(word); err != nil || n <= 0 {
+			return 0, fmt.Errorf("cannot understand the duration %q", word)
+		}
+	}
+	unit, ok := units[p.peek(1)]
+	if !ok {
+		return 0, fmt.Errorf("cannot understand the unit %q, use minutes, hours, days or weeks", p.peek(1))
+	}
+	p.pos += 2
+	return time.Duration(n) * unit, nil
+}
+
+// optionalClock parses "[at] <time of day>". Without a time it returns the default
+// hour if allowed and an error otherwise.
+func (p *parser) optionalClock(allowDefault bool) (int, int, error) {
+	hasAt := p.accept("at")
+	if !hasAt && !clockRe.MatchString(p.peek(0)) {
+		if allowDefault {
+			return defaultHour, 0, nil
+		}
+		return 0, 0, errors.New("at what time?")
+	}
+	m := clockRe.FindStringSubmatch(p.peek(0))
+	if m == nil {
+		return 0, 0, fmt.Errorf("cannot understand the time %q", p.peek(0))
+	}
+	p.pos++
+	hour, _ := strconv.Atoi(m[1])
+	minute, _ := strconv.Atoi(m[2])
+	suffix := m[3]
+	if suffix == "" && (p.peek(0) == "am" || p.peek(0) == "pm") {
+		suffix = p.peek(0)
+		p.pos++
+	}
+	if suffix != "" {
+		if hour < 1 || hour > 12 {
+			return 0, 0, fmt.Errorf("bad hour %d%s", hour, suffix)
+		}
+		hour %= 12
+		if suffix == "pm" {
+			hour += 12
+		}
+	}
+	if hour > 23 || minute > 59 {
+		return 0, 0, fmt.Errorf("bad time %s", m[0])
+	}
+	return hour, minute, nil
+}
+
+// every parses the recurrence after "every".
+func (p *parser) every() (*Reminder, error) {
+	word := p.peek(0)
+	var spec string
+	switch {
+	case word == "minute" || word == "hour":
+		p.pos++
+		spec = map[string]string{"minute": "* * * * *", "hour": "0 * * * *"}[word]
+	case clockRe.MatchString(word) && !isClock(word, p.peek(1)):
+		n, err := strconv.Atoi(word)
+		unit := p.peek(1)
+		switch {
+		case err != nil || n <= 0:
+			return nil, fmt.Errorf("cannot understand %q", word)
+		case (unit == "minutes" || unit == "min" || unit == "mins") && n < 60:
+			spec = fmt.Sprintf("*/%d * * * *", n)
+		case (unit == "hours" || unit == "h") && n < 24:
+			spec = fmt.Sprintf("0 */%d * * *", n)
+		default:
+			return nil, fmt.Errorf("cannot repeat every %d %s, use up to 59 minutes or 23 hours", n, unit)
+		}
+		p.pos += 2
+	default:
+		days, err := p.recurringDays()
+		if err != nil {
+			return nil, err
+		}
+		hour, minute, err := p.optionalClock(true)
+		if err != nil {
+			return nil, err
+		}
+		spec = fmt.Sprintf("%d %d * * %s", minute, hour, days)
+	}
+	return p.recurring(spec)
+}
+
+// recurringDays parses the days of "every ..." as the day-of-week cron field.
+func (p *parser) recurringDays() (string, error) {
+	switch {
+	case p.accept("day"):
+		return "*", nil
+	case p.accept("weekday"):
+		return "1-5", nil
+	case p.accept("weekend"):
+		return "0,6", nil
+	}
+	var days []string
+	for {
+		weekday, ok := weekdays[strings.TrimSuffix(p.peek(0), ",")]
+		if !ok {
+			break
+		}
+		p.pos++
+		days = append(days, strconv.Itoa(int(weekday)))
+		p.accept("and")
+	}
+	if len(days) == 0 {
+		return "", fmt.Errorf("cannot understand every %q", p.peek(0))
+	}
+	return strings.Join(days, ","), nil
+}
+
+// cron parses the five fields of a raw cron expression after "cron".
+func (p *parser) cron() (*Reminder, error) {
+	if p.pos+len(cronFields) > len(p.words) {
+		return nil, errors.New("cron expression needs 5 fields")
+	}
+	spec := strings.Join(p.words[p.pos:p.pos+len(cronFields)], " ")
+	p.pos += len(cronFields)
+	return p.recurring(spec)
+}
+
+// recurring creates a recurring reminder which first fires at the next match of spec.
+func (p *parser) recurring(spec string) (*Reminder, error) {
+	c, err := ParseCron(spec)
+	if err != nil {
+		return nil, err
+	}
+	at := c.Next(p.now)
+	if at.IsZero() {
+		return nil, fmt.Errorf("%q never happens", spec)
+	}
+	return &Reminder{At: at, Cron: c.String()}, nil
+}
+
+// atClock returns the time of day on the day of t.
+func atClock(t time.Time, hour, minute int) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), hour, minute, 0, 0, t.Location())
+}
@@ -0,0 +1,100 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCron(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Berlin")
+	assert.NoError(t, err)
+	now := time.Date(2026, 10, 16, 10, 30, 15, 0, loc) // Friday
+
+	tests := []struct {
+		spec string
+		next time.Time
+	}{
+		{"* * * * *", time.Date(2026, 10, 16, 10, 31, 0, 0, loc)},
+		{"0 9 * * *", time.Date(2026, 10, 17, 9, 0, 0, 0, loc)},
+		{"45 10 * * *", time.Date(2026, 10, 16, 10, 45, 0, 0, loc)},
+		{"0 8 * * 1-5", time.Date(2026, 10, 19, 8, 0, 0, 0, loc)},
+		{"*/20 * * * *", time.Date(2026, 10, 16, 10, 40, 0, 0, loc)},
+		{"0 0 1 * *", time.Date(2026, 11, 1, 0, 0, 0, 0, loc)},
+		{"0 12 29 2 *", time.Date(2028, 2, 29, 12, 0, 0, 0, loc)},
+		{"0 12 * * 7", time.Date(2026, 10, 18, 12, 0, 0, 0, loc)},
+		{"0 12 1 * 0", time.Date(2026, 10, 18, 12, 0, 0, 0, loc)}, // Either day field matches
+		{"0 12 30 2 *", time.Time{}},
+	}
+	for _, tt := range tests {
+		c, err := ParseCron(tt.spec)
+		if assert.NoError(t, err, tt.spec) {
+			assert.Equal(t, tt.next, c.Next(now), tt.spec)
+		}
+	}
+
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * * 8", "*/0 * * * *", "5-1 * * * *", "x * * * *"} {
+		_, err := ParseCron(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestCronDST(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Berlin")
+	assert.NoError(t, err)
+	c, _ := ParseCron("30 2 * * *")
+	// 2:30 does not exist on the day clocks move forward, the run is shifted to 3:30
+	next := c.Next(time.Date(2026, 3, 28, 12, 0, 0, 0, loc))
+	assert.Equal(t, time.Date(2026, 3, 29, 3, 30, 0, 0, loc), next)
+}
+
+func TestParseReminder(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Berlin")
+	assert.NoError(t, err)
+	now := time.Date(2026, 10, 16, 10, 30, 0, 0, loc) // Friday
+
+	tests := []struct {
+		input string
+		at    time.Time
+		cron  string
+		text  string
+	}{
+		{"in 10 minutes to stretch", now.Add(10 * time.Minute), "", "stretch"},
+		{"me in an hour check the oven", now.Add(time.Hour), "", "check the oven"},
+		{"in 2h30m leave", now.Add(150 * time.Minute), "", "leave"},
+		{"in 3 days pay rent", now.AddDate(0, 0, 3), "", "pay rent"},
+		{"tomorrow at 9 to call mom", time.Date(2026, 10, 17, 9, 0, 0, 0, loc), "", "call mom"},
+		{"tomorrow water plants", time.Date(2026, 10, 17, 9, 0, 0, 0, loc), "", "water plants"},
+		{"today at 6pm gym", time.Date(2026, 10, 16, 18, 0, 0, 0, loc), "", "gym"},
+		{"tonight at 11 pm sleep", time.Date(2026, 10, 16, 23, 0, 0, 0, loc), "", "sleep"},
+		{"at 9:15 standup", time.Date(2026, 10, 17, 9, 15, 0, 0, loc), "", "standup"},
+		{"18:00 dinner", time.Date(2026, 10, 16, 18, 0, 0, 0, loc), "", "dinner"},
+		{"monday at 10:30 review", time.Date(2026, 10, 19, 10, 30, 0, 0, loc), "", "review"},
+		{"friday at 9 report", time.Date(2026, 10, 23, 9, 0, 0, 0, loc), "", "report"},
+		{"on 2026-12-31 at 23:59 party", time.Date(2026, 12, 31, 23, 59, 0, 0, loc), "", "party"},
+		{"1.3 at 8 spring", time.Date(2027, 3, 1, 8, 0, 0, 0, loc), "", "spring"},
+		{"every day at 9 vitamins", time.Date(2026, 10, 17, 9, 0, 0, 0, loc), "0 9 * * *", "vitamins"},
+		{"every weekday at 8:15 bus", time.Date(2026, 10, 19, 8, 15, 0, 0, loc), "15 8 * * 1-5", "bus"},
+		{"every monday and thursday at 19 to train", time.Date(2026, 10, 19, 19, 0, 0, 0, loc), "0 19 * * 1,4", "train"},
+		{"every 2 hours drink water", time.Date(2026, 10, 16, 12, 0, 0, 0, loc), "0 */2 * * *", "drink water"},
+		{"every 15 min stand up", time.Date(2026, 10, 16, 10, 45, 0, 0, loc), "*/15 * * * *", "stand up"},
+		{"cron 0 9 1 * * invoices", time.Date(2026, 11, 1, 9, 0, 0, 0, loc), "0 9 1 * *", "invoices"},
+	}
+	for _, tt := range tests {
+		r, err := ParseReminder(tt.input, now)
+		if assert.NoError(t, err, tt.input) {
+			assert.Equal(t, tt.at, r.At, tt.input)
+			assert.Equal(t, tt.cron, r.Cron, tt.input)
+			assert.Equal(t, tt.text, r.Text, tt.input)
+		}
+	}
+
+	for _, input := range []string{
+		"", "call mom", "in 10", "in ten minutes x", "in 5 parsecs x", "today at 9 x", "tomorrow at 25 x",
+		"at 13pm x", "on 2026-02-30 x", "every 90 minutes x", "every blue moon x", "cron 0 9 x", "tomorrow at 9",
+	} {
+		_, err := ParseReminder(input, now)
+		assert.Error(t, err, input)
+	}
+}
@@ -0,0 +1,315 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gourbot/internal/types"
+)
+
+// SchemaVersion is the version of the tables created by createTables, kept in the
+// user_version of the database. Bump it with every change of the tables; Open migrates
+// older databases and refuses newer ones.
+const SchemaVersion = 1
+
+// SchemaVersion returns the schema version of the database, 0 for databases created
+// before versions were recorded.
+func (s *Storage) SchemaVersion() (int, error) {
+	var version int
+	err := s.db.QueryRow(`PRAGMA user_version`).Scan(&version)
+	return version, err
+}
+
+// Ping checks that the database responds.
+func (s *Storage) Ping() error {
+	if s.db == nil {
+		return sql.ErrConnDone
+	}
+	return s.db.Ping()
+}
+
+// Vacuum rebuilds the database file, returning the space of deleted rows.
+func (s *Storage) Vacuum() error {
+	_, err := s.writer.Exec(`VACUUM`)
+	return err
+}
+
+// Backup writes a consistent copy of the database to a new file while it is in use. It
+// goes through the writer, so writes wait for the copy to complete. The copy is readable
+// by the owner only, like the data in it should be.
+func (s *Storage) Backup(filename string) error {
+	if _, err := os.Stat(filename); err == nil {
+		return fmt.Errorf("%s already exists", filename)
+	}
+	if _, err := s.writer.Exec(`VACUUM INTO ?`, filename); err != nil {
+		return err
+	}
+	return os.Chmod(filename, 0o600)
+}
+
+// backupTimeFormat names backups after the time they were made, so that they sort by age.
+const backupTimeFormat = "20060102-150405"
+
+// BackupName returns the file name of a backup of the database made at the given time in
+// dir, e.g. backups/gourbot-20240102-150405.sqlite.
+func BackupName(dbPath, dir string, t time.Time) string {
+	return filepath.Join(dir, backupPrefix(dbPath)+t.Format(backupTimeFormat)+".sqlite")
+}
+
+// backupPrefix returns the start of the names of the backups of the database.
+func backupPrefix(dbPath string) string {
+	return strings.TrimSuffix(filepath.Base(dbPath), ".sqlite") + "-"
+}
+
+// ListBackups returns the backups of the database in dir, the oldest first.
+func ListBackups(dbPath, dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	prefix := backupPrefix(dbPath)
+	var backups []string
+	for _, entry := range entries {
+		name := entry.Name()
+		stamp, ok := strings.CutPrefix(name, prefix)
+		if !ok || entry.IsDir() || !strings.HasSuffix(stamp, ".sqlite") {
+			continue
+		}
+		if _, err := time.Parse(backupTimeFormat, strings.TrimSuffix(stamp, ".sqlite")); err == nil {
+			backups = append(backups, filepath.Join(dir, name))
+		}
+	}
+	sort.Strings(backups)
+	return backups, nil
+}
+
+// RotateBackups deletes the oldest backups of the database in dir so that keep remain,
+// and returns the deleted files.
+func RotateBackups(dbPath, dir string, keep int) ([]string, error) {
+	backups, err := ListBackups(dbPath, dir)
+	if err != nil || len(backups) <= keep {
+		return nil, err
+	}
+	var deleted []string
+	for _, backup := range backups[:len(backups)-keep] {
+		if err := os.Remove(backup); err != nil {
+			return deleted, err
+		}
+		deleted = append(deleted, backup)
+	}
+	return deleted, nil
+}
+
+// CheckBackup opens a database file read-only and returns its schema version if it is
+// an intact gourbot database which this build can use.
+func CheckBackup(filename string) (int, error) {
+	if _, err := os.Stat(filename); err != nil {
+		return 0, err
+	}
+	db, err := sql.Open("sqlite3", "file:"+filename+"?mode=ro")
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+	var check string
+	if err := db.QueryRow(`PRAGMA quick_check`).Scan(&check); err != nil {
+		return 0, fmt.Errorf("%s is not a readable SQLite database: %w", filename, err)
+	}
+	if check != "ok" {
+		return 0, fmt.Errorf("%s is damaged: %s", filename, check)
+	}
+	var tables int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name IN ('tgusers', 'tgdump')`).Scan(&tables); err != nil {
+		return 0, err
+	}
+	if tables != 2 {
+		return 0, fmt.Errorf("%s is not a gourbot database", filename)
+	}
+	var version int
+	if err := db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return 0, err
+	}
+	if version > SchemaVersion {
+		return 0, fmt.Errorf("%s has schema version %d, this build supports up to %d", filename, version, SchemaVersion)
+	}
+	return version, nil
+}
+
+// Restore replaces the database file with a backup after checking it with CheckBackup.
+// The replaced database is kept next to it with the suffix .before-restore-<time>, whose
+// name is returned, also with an error once it has been moved. Restore fails while the
+// database is in use, e.g. by the running bot.
+func Restore(backup, dbPath string) (string, error) {
+	if _, err := CheckBackup(backup); err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(dbPath); err == nil {
+		unlock, err := lockDatabase(dbPath)
+		if err != nil {
+			return "", err
+		}
+		defer unlock()
+	}
+	tmp := dbPath + ".restoring"
+	if err := copyFile(backup, tmp); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	kept := ""
+	if _, err := os.Stat(dbPath); err == nil {
+		kept = dbPath + ".before-restore-" + time.Now().Format(backupTimeFormat)
+		// The journal files belong to the replaced database
+		for _, suffix := range []string{"", "-wal", "-shm", "-journal"} {
+			if err := os.Rename(dbPath+suffix, kept+suffix); err != nil && !os.IsNotExist(err) {
+				os.Remove(tmp)
+				if suffix == "" {
+					return "", err
+				}
+				return kept, err
+			}
+		}
+	}
+	if err := os.Rename(tmp, dbPath); err != nil {
+		return kept, err
+	}
+	return kept, nil
+}
+
+// lockDatabase takes an exclusive lock of the database, failing at once if another
+// connection has it open. In WAL mode every open connection holds a shared lock, so
+// only the exclusive locking mode detects the bot while it idles.
+func lockDatabase(dbPath string) (unlock func(), err error) {
+	db, err := sql.Open("sqlite3", "file:"+dbPath+"?_busy_timeout=0&_locking_mode=EXCLUSIVE&_txlock=exclusive")
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	tx, err := db.Begin()
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("%s is in use, stop the bot first: %w", dbPath, err)
+	}
+	return func() {
+		tx.Rollback()
+		db.Close()
+	}, nil
+}
+
+// copyFile copies a file to a new file, which is synced to the disk.
+func copyFile(from, to string) error {
+	in, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(to, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// Export writes the rows of every table as JSON lines {"table": ..., "row": {...}}, for
+// inspection and for moving the data to other tools.
+func (s *Storage) Export(w io.Writer) error {
+	rows, err := s.db.Query(`SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name`)
+	if err != nil {
+		return err
+	}
+	var tables []string
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			rows.Close()
+			return err
+		}
+		tables = append(tables, table)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	for _, table := range tables {
+		if err := s.exportTable(enc, table); err != nil {
+			return fmt.Errorf("export of table %s failed: %w", table, err)
+		}
+	}
+	return nil
+}
+
+// exportTable writes the rows of a table, see Export.
+func (s *Storage) exportTable(enc *json.Encoder, table string) error {
+	rows, err := s.db.Query(`SELECT * FROM "` + table + `"`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	values := make([]any, len(columns))
+	pointers := make([]any, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return err
+		}
+		row := make(map[string]any, len(columns))
+		for i, column := range columns {
+			if text, ok := values[i].([]byte); ok {
+				row[column] = string(text)
+			} else {
+				row[column] = values[i]
+			}
+		}
+		if err := enc.Encode(map[string]any{"table": table, "row": row}); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// GetTgRecords returns up to limit records of the tgdump table after the given uid, the
+// oldest first.
+func (s *Storage) GetTgRecords(afterUid int64, limit int) ([]*types.TgRecord, error) {
+	if s.db == nil {
+		return nil, sql.ErrConnDone
+	}
+	rows, err := s.db.Query(`SELECT uid, out, data FROM tgdump WHERE uid > ? ORDER BY uid LIMIT ?`, afterUid, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var records []*types.TgRecord
+	for rows.Next() {
+		var record types.TgRecord
+		if err := rows.Scan(&record.Uid, &record.Out, &record.Data); err != nil {
+			return nil, err
+		}
+		records = append(records, &record)
+	}
+	return records, rows.Err()
+}
@@ -3,6 +3,7 @@ package storage
 import (
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"log"
 	"os"
 	"time"
@@ -15,10 +16,30 @@ import (
 
 // Storage is responsible for managing the SQLite database.
 type Storage struct {
-	db       *sql.DB
+	db       *sql.DB // Pool of read-only connections for the queries
+	writer   *sql.DB // The single connection every write goes through, one at a time
 	filename string
 }
 
+// busyTimeout is how long a connection waits for a lock of another one, in milliseconds,
+// before it fails with "database is locked".
+const busyTimeout = 5000
+
+// dsn returns the data source name of a connection. The write-ahead log lets the readers
+// work while a write is in progress and is safe with the NORMAL synchronous level, the busy
+// timeout makes connections wait for a lock instead of failing, and foreign keys are
+// enforced. Writers start their transactions IMMEDIATE, taking the write lock up front
+// rather than failing to upgrade a read lock; readers are query-only.
+func dsn(filename string, writer bool) string {
+	params := fmt.Sprintf("_busy_timeout=%d&_synchronous=NORMAL&_foreign_keys=on", busyTimeout)
+	if writer {
+		params += "&_journal_mode=WAL&_txlock=immediate"
+	} else {
+		params += "&_query_only=true"
+	}
+	return filename + "?" + params
+}
+
 // NewStorage initializes a new Storage instance using the provided Config.
 func NewStorage(cfg *config.Config) *Storage {
 	return &Storage{
@@ -26,24 +47,66 @@ func NewStorage(cfg *config.Config) *Storage {
 	}
 }
 
-// Open opens the SQLite database.
+// Open opens the SQLite database and migrates it to the current SchemaVersion.
 func (s *Storage) Open() error {
-	db, err := sql.Open("sqlite3", s.filename)
-	if err != nil {
+	if err := s.openConnections(); err != nil {
 		log.Printf("Failed to open SQLite database %s: %v", s.filename, err)
 		return err
 	}
 	log.Printf("Opened SQLite database %s", s.filename)
-	s.db = db
-	return s.createTables()
+	version, err := s.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	if version > SchemaVersion {
+		return fmt.Errorf("database %s has schema version %d, this build supports up to %d", s.filename, version, SchemaVersion)
+	}
+	if err := s.createTables(); err != nil {
+		return err
+	}
+	_, err = s.writer.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, SchemaVersion))
+	return err
+}
+
+// openConnections opens the writer and the readers. The writer connects first, switching
+// the database to the write-ahead log. An in-memory database exists only in its one
+// connection, which then serves the readers as well.
+func (s *Storage) openConnections() error {
+	writer, err := sql.Open("sqlite3", dsn(s.filename, true))
+	if err != nil {
+		return err
+	}
+	writer.SetMaxOpenConns(1)
+	writer.SetConnMaxLifetime(0)
+	writer.SetConnMaxIdleTime(0)
+	if err := writer.Ping(); err != nil {
+		writer.Close()
+		return err
+	}
+	s.writer = writer
+	if s.filename == ":memory:" {
+		s.db = writer
+		return nil
+	}
+	if s.db, err = sql.Open("sqlite3", dsn(s.filename, false)); err != nil {
+		writer.Close()
+		return err
+	}
+	return nil
 }
 
 // Close closes the SQLite database connection.
 func (s *Storage) Close() error {
-	if s.db != nil {
-		return s.db.Close()
+	var err error
+	if s.db != nil && s.db != s.writer {
+		err = s.db.Close()
 	}
-	return nil
+	if s.writer != nil {
+		if werr := s.writer.Close(); err == nil {
+			err = werr
+		}
+	}
+	return err
 }
 
 // Delete removes the SQLite database file.
@@ -51,6 +114,11 @@ func (s *Storage) Delete() error {
 	if err := s.Close(); err != nil {
 		return err
 	}
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if err := os.Remove(s.filename + suffix); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
 	return os.Remove(s.filename)
 }
 
@@ -76,12 +144,139 @@ func (s *Storage) createTables() error {
 			created_at INTEGER NOT NULL,
 			seen_at INTEGER NOT NULL,
 			permissions TEXT DEFAULT '',
-			info TEXT DEFAULT ''
+			info TEXT DEFAULT '',
+			settings TEXT DEFAULT '{}'
+		);`,
+		`CREATE TABLE IF NOT EXISTS tgchats (
+			id INTEGER PRIMARY KEY,
+			type TEXT DEFAULT '',
+			title TEXT DEFAULT '',
+			created_at INTEGER NOT NULL,
+			seen_at INTEGER NOT NULL,
+			permissions TEXT DEFAULT '',
+			settings TEXT DEFAULT '{}',
+			status TEXT DEFAULT ''
+		);`,
+		`CREATE TABLE IF NOT EXISTS chat_members (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			chat_id INTEGER NOT NULL,
+			user_id INTEGER NOT NULL,
+			changed_by INTEGER NOT NULL,
+			old_status TEXT DEFAULT '',
+			new_status TEXT DEFAULT '',
+			created_at INTEGER NOT NULL
+		);`,
+		`CREATE INDEX IF NOT EXISTS chat_members_chat ON chat_members (chat_id, id);`,
+		`CREATE TABLE IF NOT EXISTS inline_answers (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			query TEXT NOT NULL,
+			model TEXT NOT NULL,
+			prompt_hash TEXT NOT NULL DEFAULT '',
+			answer TEXT NOT NULL,
+			cost REAL NOT NULL DEFAULT 0,
+			created_at INTEGER NOT NULL,
+			chosen_at INTEGER NOT NULL DEFAULT 0
+		);`,
+		`CREATE INDEX IF NOT EXISTS inline_answers_lookup ON inline_answers (query, model, prompt_hash, created_at);`,
+		`CREATE TABLE IF NOT EXISTS jobs (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			kind TEXT NOT NULL,
+			user_id INTEGER NOT NULL,
+			chat_id INTEGER NOT NULL,
+			thread_id INTEGER NOT NULL DEFAULT 0,
+			text TEXT NOT NULL DEFAULT '',
+			cron TEXT NOT NULL DEFAULT '',
+			timezone TEXT NOT NULL DEFAULT '',
+			next_run_at INTEGER NOT NULL,
+			last_run_at INTEGER NOT NULL DEFAULT 0,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			created_at INTEGER NOT NULL
+		);`,
+		`CREATE INDEX IF NOT EXISTS jobs_next_run ON jobs (next_run_at);`,
+		`CREATE INDEX IF NOT EXISTS jobs_user ON jobs (user_id, kind);`,
+		`CREATE TABLE IF NOT EXISTS notifications (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			chat_id INTEGER NOT NULL,
+			category TEXT NOT NULL,
+			text TEXT NOT NULL,
+			created_at INTEGER NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS dialogs (
+			chat_id INTEGER NOT NULL,
+			user_id INTEGER NOT NULL,
+			name TEXT NOT NULL,
+			step TEXT NOT NULL,
+			data TEXT NOT NULL DEFAULT '{}',
+			expires_at INTEGER NOT NULL,
+			updated_at INTEGER NOT NULL,
+			PRIMARY KEY (chat_id, user_id)
+		);`,
+		`CREATE TABLE IF NOT EXISTS usage (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			kind TEXT NOT NULL,
+			model TEXT DEFAULT '',
+			cost REAL NOT NULL DEFAULT 0,
+			created_at INTEGER NOT NULL
+		);`,
+		`CREATE INDEX IF NOT EXISTS usage_user_created ON usage (user_id, created_at);`,
+		`CREATE TABLE IF NOT EXISTS personas (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL UNIQUE,
+			system_prompt TEXT NOT NULL,
+			model TEXT DEFAULT '',
+			temperature REAL,
+			created_by INTEGER NOT NULL,
+			created_at INTEGER NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS chat_personas (
+			chat_id INTEGER PRIMARY KEY,
+			persona_id INTEGER NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS history (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			chat_id INTEGER NOT NULL,
+			thread_id INTEGER NOT NULL DEFAULT 0,
+			user_id INTEGER NOT NULL,
+			role TEXT NOT NULL,
+			content TEXT NOT NULL,
+			tokens INTEGER NOT NULL DEFAULT 0,
+			created_at INTEGER NOT NULL
+		);`,
+		`CREATE INDEX IF NOT EXISTS history_conversation ON history (chat_id, thread_id, id);`,
+		`CREATE TABLE IF NOT EXISTS summaries (
+			chat_id INTEGER NOT NULL,
+			thread_id INTEGER NOT NULL DEFAULT 0,
+			text TEXT NOT NULL,
+			tokens INTEGER NOT NULL DEFAULT 0,
+			updated_at INTEGER NOT NULL,
+			PRIMARY KEY (chat_id, thread_id)
+		);`,
+		`CREATE TABLE IF NOT EXISTS tool_calls (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			chat_id INTEGER NOT NULL,
+			tool TEXT NOT NULL,
+			arguments TEXT DEFAULT '',
+			result TEXT DEFAULT '',
+			error TEXT DEFAULT '',
+			created_at INTEGER NOT NULL
 		);`,
 	}
 
 	for _, query := range queries {
-		if _, err := s.db.Exec(query); err != nil {
+		if _, err := s.writer.Exec(query); err != nil {
+			return err
+		}
+	}
+
+	// Columns added after the table was first created
+	columns := []struct{ table, column, definition string }{
+		{"tgusers", "settings", "TEXT DEFAULT '{}'"},
+	}
+	for _, c := range columns {
+		if err := s.addColumnIfMissing(c.table, c.column, c.definition); err != nil {
 			return err
 		}
 	}
@@ -89,17 +284,37 @@ func (s *Storage) createTables() error {
 	return nil
 }
 
+// hasColumn reports whether the table has the column.
+func (s *Storage) hasColumn(table, column string) (bool, error) {
+	var count int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, table, column).Scan(&count)
+	return count > 0, err
+}
+
+// addColumnIfMissing adds a column to an existing table created by an older version.
+func (s *Storage) addColumnIfMissing(table, column, definition string) error {
+	exists, err := s.hasColumn(table, column)
+	if err != nil || exists {
+		return err
+	}
+	_, err = s.writer.Exec(`ALTER TABLE ` + table + ` ADD COLUMN ` + column + ` ` + definition)
+	return err
+}
+
 // AddTgRecord adds a new record to the tgdump table.
 func (s *Storage) AddTgRecord(out bool, rec interface{}) error {
 	if s.db == nil {
 		return sql.ErrConnDone
 	}
-	data, err := json.Marshal(rec)
-	if err != nil {
-		return err
+	data, ok := rec.([]byte) // Already serialized records are stored as is
+	if !ok {
+		var err error
+		if data, err = json.Marshal(rec); err != nil {
+			return err
+		}
 	}
 	query := `INSERT INTO tgdump (out, data) VALUES (?, ?);`
-	_, err = s.db.Exec(query, out, data)
+	_, err := s.writer.Exec(query, out, data)
 	return err
 }
 
@@ -108,11 +323,11 @@ func (s *Storage) AddTgRecord(out bool, rec interface{}) error {
 
 // AddTgUser adds a new user to the tgusers table.
 func (s *Storage) AddTgUser(user *types.TgUser) error {
-	query := `INSERT INTO tgusers (id, name, created_at, seen_at, permissions, info) VALUES (?, ?, ?, ?, ?, ?)`
+	query := `INSERT INTO tgusers (id, name, created_at, seen_at, permissions, info, settings) VALUES (?, ?, ?, ?, ?, ?, ?)`
 	permissions := user.PermissionsToString()
 	createdAtUnix := user.CreatedAt.Unix()
 	seenAtUnix := user.SeenAt.Unix()
-	_, err := s.db.Exec(query, user.Id, user.Name, createdAtUnix, seenAtUnix, permissions, user.Info)
+	_, err := s.writer.Exec(query, user.Id, user.Name, createdAtUnix, seenAtUnix, permissions, user.Info, user.SettingsToString())
 	return err
 }
 
@@ -129,13 +344,13 @@ func (s *Storage) TgUserExists(id int64) (bool, error) {
 
 // GetTgUser retrieves a user by ID from the tgusers table.
 func (s *Storage) GetTgUser(id int64) (*types.TgUser, error) {
-	query := `SELECT name, created_at, seen_at, permissions, info FROM tgusers WHERE id = ?`
+	query := `SELECT name, created_at, seen_at, permissions, info, settings FROM tgusers WHERE id = ?`
 	row := s.db.QueryRow(query, id)
 
-	var name, permissions string
+	var name, permissions, settings string
 	var info []byte
 	var createdAtUnix, seenAtUnix int64
-	err := row.Scan(&name, &createdAtUnix, &seenAtUnix, &permissions, &info)
+	err := row.Scan(&name, &createdAtUnix, &seenAtUnix, &permissions, &info, &settings)
 	if err != nil {
 		return nil, err
 	}
@@ -144,13 +359,14 @@ func (s *Storage) GetTgUser(id int64) (*types.TgUser, error) {
 	user.CreatedAt = time.Unix(createdAtUnix, 0)
 	user.SeenAt = time.Unix(seenAtUnix, 0)
 	user.AddPermissionsFromString(permissions)
+	user.SetSettingsFromString(settings)
 
 	return user, nil
 }
 
 // GetAllTgUsers retrieves all users from the tgusers table.
 func (s *Storage) GetAllTgUsers() ([]*types.TgUser, error) {
-	query := `SELECT id, name, created_at, seen_at, permissions, info FROM tgusers`
+	query := `SELECT id, name, created_at, seen_at, permissions, info, settings FROM tgusers`
 	rows, err := s.db.Query(query)
 	if err != nil {
 		return nil, err
@@ -160,10 +376,10 @@ func (s *Storage) GetAllTgUsers() ([]*types.TgUser, error) {
 	var users []*types.TgUser
 	for rows.Next() {
 		var id int64
-		var name, permissions string
+		var name, permissions, settings string
 		var info []byte
 		var createdAtUnix, seenAtUnix int64
-		err := rows.Scan(&id, &name, &createdAtUnix, &seenAtUnix, &permissions, &info)
+		err := rows.Scan(&id, &name, &createdAtUnix, &seenAtUnix, &permissions, &info, &settings)
 		if err != nil {
 			return nil, err
 		}
@@ -172,6 +388,7 @@ func (s *Storage) GetAllTgUsers() ([]*types.TgUser, error) {
 		user.CreatedAt = time.Unix(createdAtUnix, 0)
 		user.SeenAt = time.Unix(seenAtUnix, 0)
 		user.AddPermissionsFromString(permissions)
+		user.SetSettingsFromString(settings)
 
 		users = append(users, user)
 	}
@@ -181,9 +398,651 @@ func (s *Storage) GetAllTgUsers() ([]*types.TgUser, error) {
 
 // UpdateTgUser updates an existing user in the tgusers table.
 func (s *Storage) UpdateTgUser(user *types.TgUser) error {
-	query := `UPDATE tgusers SET name = ?, seen_at = ?, permissions = ?, info = ? WHERE id = ?`
+	query := `UPDATE tgusers SET name = ?, seen_at = ?, permissions = ?, info = ?, settings = ? WHERE id = ?`
 	permissions := user.PermissionsToString()
 	seenAtUnix := user.SeenAt.Unix()
-	_, err := s.db.Exec(query, user.Name, seenAtUnix, permissions, user.Info, user.Id)
+	_, err := s.writer.Exec(query, user.Name, seenAtUnix, permissions, user.Info, user.SettingsToString(), user.Id)
+	return err
+}
+
+// AddUsage records a paid API call in the usage table.
+func (s *Storage) AddUsage(usage *types.Usage) error {
+	query := `INSERT INTO usage (user_id, kind, model, cost, created_at) VALUES (?, ?, ?, ?, ?)`
+	result, err := s.writer.Exec(query, usage.UserId, usage.Kind, usage.Model, usage.Cost, usage.CreatedAt.Unix())
+	if err != nil {
+		return err
+	}
+	usage.Id, err = result.LastInsertId()
+	return err
+}
+
+// GetUserCostSince returns the total cost charged to the user since the given time.
+func (s *Storage) GetUserCostSince(userId int64, since time.Time) (float64, error) {
+	query := `SELECT COALESCE(SUM(cost), 0) FROM usage WHERE user_id = ? AND created_at >= ?`
+	var total float64
+	err := s.db.QueryRow(query, userId, since.Unix()).Scan(&total)
+	return total, err
+}
+
+// AddToolCall records a tool call made by the LLM in the tool_calls audit table.
+func (s *Storage) AddToolCall(call *types.ToolCall) error {
+	query := `INSERT INTO tool_calls (user_id, chat_id, tool, arguments, result, error, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)`
+	result, err := s.writer.Exec(query, call.UserId, call.ChatId, call.Tool, call.Arguments, call.Result, call.Error, call.CreatedAt.Unix())
+	if err != nil {
+		return err
+	}
+	call.Id, err = result.LastInsertId()
+	return err
+}
+
+// GetUserToolCalls returns the latest tool calls made for the user, newest first.
+func (s *Storage) GetUserToolCalls(userId int64, limit int) ([]*types.ToolCall, error) {
+	query := `SELECT id, user_id, chat_id, tool, arguments, result, error, created_at FROM tool_calls
+		WHERE user_id = ? ORDER BY id DESC LIMIT ?`
+	rows, err := s.db.Query(query, userId, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var calls []*types.ToolCall
+	for rows.Next() {
+		var call types.ToolCall
+		var createdAtUnix int64
+		if err := rows.Scan(&call.Id, &call.UserId, &call.ChatId, &call.Tool, &call.Arguments, &call.Result, &call.Error, &createdAtUnix); err != nil {
+			return nil, err
+		}
+		call.CreatedAt = time.Unix(createdAtUnix, 0)
+		calls = append(calls, &call)
+	}
+	return calls, rows.Err()
+}
+
+// AddHistoryMessage appends a message to the history of its conversation.
+func (s *Storage) AddHistoryMessage(msg *types.HistoryMessage) error {
+	query := `INSERT INTO history (chat_id, thread_id, user_id, role, content, tokens, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)`
+	result, err := s.writer.Exec(query, msg.ChatId, msg.ThreadId, msg.UserId, msg.Role, msg.Content, msg.Tokens, msg.CreatedAt.Unix())
+	if err != nil {
+		return err
+	}
+	msg.Id, err = result.LastInsertId()
+	return err
+}
+
+// GetHistory returns the remembered messages of a conversation, oldest first.
+// A conversation is a chat or, in forums, a topic of the chat; threadId 0 means the whole chat.
+func (s *Storage) GetHistory(chatId int64, threadId int) ([]*types.HistoryMessage, error) {
+	query := `SELECT id, chat_id, thread_id, user_id, role, content, tokens, created_at FROM history
+		WHERE chat_id = ? AND thread_id = ? ORDER BY id`
+	rows, err := s.db.Query(query, chatId, threadId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []*types.HistoryMessage
+	for rows.Next() {
+		var msg types.HistoryMessage
+		var createdAtUnix int64
+		if err := rows.Scan(&msg.Id, &msg.ChatId, &msg.ThreadId, &msg.UserId, &msg.Role, &msg.Content, &msg.Tokens, &createdAtUnix); err != nil {
+			return nil, err
+		}
+		msg.CreatedAt = time.Unix(createdAtUnix, 0)
+		messages = append(messages, &msg)
+	}
+	return messages, rows.Err()
+}
+
+// GetSummary returns the rolling summary of a conversation, or nil if there is none.
+func (s *Storage) GetSummary(chatId int64, threadId int) (*types.Summary, error) {
+	summary := types.Summary{ChatId: chatId, ThreadId: threadId}
+	var updatedAtUnix int64
+	err := s.db.QueryRow(`SELECT text, tokens, updated_at FROM summaries WHERE chat_id = ? AND thread_id = ?`, chatId, threadId).
+		Scan(&summary.Text, &summary.Tokens, &updatedAtUnix)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	summary.UpdatedAt = time.Unix(updatedAtUnix, 0)
+	return &summary, nil
+}
+
+// SaveSummary stores the rolling summary of a conversation and forgets its history
+// messages up to and including lastMessageId, which the summary now covers.
+func (s *Storage) SaveSummary(summary *types.Summary, lastMessageId int64) error {
+	tx, err := s.writer.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO summaries (chat_id, thread_id, text, tokens, updated_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (chat_id, thread_id) DO UPDATE SET text = excluded.text, tokens = excluded.tokens, updated_at = excluded.updated_at`
+	if _, err := tx.Exec(query, summary.ChatId, summary.ThreadId, summary.Text, summary.Tokens, summary.UpdatedAt.Unix()); err != nil {
+		return err
+	}
+	query = `DELETE FROM history WHERE chat_id = ? AND thread_id = ? AND id <= ?`
+	if _, err := tx.Exec(query, summary.ChatId, summary.ThreadId, lastMessageId); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ClearHistory forgets the whole conversation including its summary.
+func (s *Storage) ClearHistory(chatId int64, threadId int) error {
+	if _, err := s.writer.Exec(`DELETE FROM history WHERE chat_id = ? AND thread_id = ?`, chatId, threadId); err != nil {
+		return err
+	}
+	_, err := s.writer.Exec(`DELETE FROM summaries WHERE chat_id = ? AND thread_id = ?`, chatId, threadId)
+	return err
+}
+
+// personaColumns lists the personas columns in the order scanPersona expects them.
+const personaColumns = `id, name, system_prompt, model, temperature, created_by, created_at`
+
+// scanPersona reads a persona from a row selected with personaColumns.
+func scanPersona(row interface{ Scan(...interface{}) error }) (*types.Persona, error) {
+	var persona types.Persona
+	var temperature sql.NullFloat64
+	var createdAtUnix int64
+	err := row.Scan(&persona.Id, &persona.Name, &persona.SystemPrompt, &persona.Model, &temperature, &persona.CreatedBy, &createdAtUnix)
+	if err != nil {
+		return nil, err
+	}
+	if temperature.Valid {
+		persona.Temperature = &temperature.Float64
+	}
+	persona.CreatedAt = time.Unix(createdAtUnix, 0)
+	return &persona, nil
+}
+
+// SavePersona adds a new persona or updates the existing one with the same name.
+func (s *Storage) SavePersona(persona *types.Persona) error {
+	query := `INSERT INTO personas (name, system_prompt, model, temperature, created_by, created_at) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET system_prompt = excluded.system_prompt, model = excluded.model, temperature = excluded.temperature`
+	_, err := s.writer.Exec(query, persona.Name, persona.SystemPrompt, persona.Model, persona.Temperature, persona.CreatedBy, persona.CreatedAt.Unix())
+	if err != nil {
+		return err
+	}
+	return s.db.QueryRow(`SELECT id FROM personas WHERE name = ?`, persona.Name).Scan(&persona.Id)
+}
+
+// GetPersona retrieves a persona by name. It returns sql.ErrNoRows if there is no such persona.
+func (s *Storage) GetPersona(name string) (*types.Persona, error) {
+	query := `SELECT ` + personaColumns + ` FROM personas WHERE name = ?`
+	return scanPersona(s.db.QueryRow(query, name))
+}
+
+// GetAllPersonas retrieves all personas ordered by name.
+func (s *Storage) GetAllPersonas() ([]*types.Persona, error) {
+	query := `SELECT ` + personaColumns + ` FROM personas ORDER BY name`
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var personas []*types.Persona
+	for rows.Next() {
+		persona, err := scanPersona(rows)
+		if err != nil {
+			return nil, err
+		}
+		personas = append(personas, persona)
+	}
+	return personas, rows.Err()
+}
+
+// DeletePersona removes a persona by name together with its chat selections.
+// It reports whether the persona existed.
+func (s *Storage) DeletePersona(name string) (bool, error) {
+	tx, err := s.writer.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM chat_personas WHERE persona_id IN (SELECT id FROM personas WHERE name = ?)`, name); err != nil {
+		return false, err
+	}
+	result, err := tx.Exec(`DELETE FROM personas WHERE name = ?`, name)
+	if err != nil {
+		return false, err
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return count > 0, tx.Commit()
+}
+
+// SetChatPersona selects the persona used in a chat; personaId 0 clears the selection.
+func (s *Storage) SetChatPersona(chatId, personaId int64) error {
+	if personaId == 0 {
+		_, err := s.writer.Exec(`DELETE FROM chat_personas WHERE chat_id = ?`, chatId)
+		return err
+	}
+	query := `INSERT INTO chat_personas (chat_id, persona_id) VALUES (?, ?)
+		ON CONFLICT (chat_id) DO UPDATE SET persona_id = excluded.persona_id`
+	_, err := s.writer.Exec(query, chatId, personaId)
+	return err
+}
+
+// GetChatPersona retrieves the persona selected in a chat, or nil if there is none.
+func (s *Storage) GetChatPersona(chatId int64) (*types.Persona, error) {
+	query := `SELECT ` + personaColumns + ` FROM personas WHERE id = (SELECT persona_id FROM chat_personas WHERE chat_id = ?)`
+	persona, err := scanPersona(s.db.QueryRow(query, chatId))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return persona, err
+}
+
+// tgChatColumns lists the tgchats columns in the order scanTgChat expects them.
+const tgChatColumns = `id, type, title, created_at, seen_at, permissions, settings, status`
+
+// scanTgChat reads a chat from a row selected with tgChatColumns.
+func scanTgChat(row interface{ Scan(...interface{}) error }) (*types.TgChat, error) {
+	var id int64
+	var chatType, title, permissions, settings, status string
+	var createdAtUnix, seenAtUnix int64
+	if err := row.Scan(&id, &chatType, &title, &createdAtUnix, &seenAtUnix, &permissions, &settings, &status); err != nil {
+		return nil, err
+	}
+	chat := types.NewTgChat(id, chatType, title)
+	chat.Status = status
+	chat.CreatedAt = time.Unix(createdAtUnix, 0)
+	chat.SeenAt = time.Unix(seenAtUnix, 0)
+	chat.AddPermissionsFromString(permissions)
+	chat.SetSettingsFromString(settings)
+	return chat, nil
+}
+
+// AddTgChat adds a new chat to the tgchats table.
+func (s *Storage) AddTgChat(chat *types.TgChat) error {
+	query := `INSERT INTO tgchats (id, type, title, created_at, seen_at, permissions, settings, status) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := s.writer.Exec(query, chat.Id, chat.Type, chat.Title, chat.CreatedAt.Unix(), chat.SeenAt.Unix(),
+		chat.PermissionsToString(), chat.SettingsToString(), chat.Status)
+	return err
+}
+
+// GetTgChat retrieves a chat by ID. It returns sql.ErrNoRows if the chat is unknown.
+func (s *Storage) GetTgChat(id int64) (*types.TgChat, error) {
+	query := `SELECT ` + tgChatColumns + ` FROM tgchats WHERE id = ?`
+	return scanTgChat(s.db.QueryRow(query, id))
+}
+
+// GetAllTgChats retrieves all chats ordered by ID.
+func (s *Storage) GetAllTgChats() ([]*types.TgChat, error) {
+	query := `SELECT ` + tgChatColumns + ` FROM tgchats ORDER BY id`
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var chats []*types.TgChat
+	for rows.Next() {
+		chat, err := scanTgChat(rows)
+		if err != nil {
+			return nil, err
+		}
+		chats = append(chats, chat)
+	}
+	return chats, rows.Err()
+}
+
+// UpdateTgChat updates an existing chat in the tgchats table.
+func (s *Storage) UpdateTgChat(chat *types.TgChat) error {
+	query := `UPDATE tgchats SET type = ?, title = ?, seen_at = ?, permissions = ?, settings = ?, status = ? WHERE id = ?`
+	_, err := s.writer.Exec(query, chat.Type, chat.Title, chat.SeenAt.Unix(), chat.PermissionsToString(), chat.SettingsToString(), chat.Status, chat.Id)
+	return err
+}
+
+// TouchTgChat updates the type, title and last seen time of an existing chat,
+// leaving its permissions and settings alone.
+func (s *Storage) TouchTgChat(chat *types.TgChat) error {
+	_, err := s.writer.Exec(`UPDATE tgchats SET type = ?, title = ?, seen_at = ? WHERE id = ?`, chat.Type, chat.Title, chat.SeenAt.Unix(), chat.Id)
+	return err
+}
+
+// SetTgChatStatus stores the bot's membership status in an existing chat.
+func (s *Storage) SetTgChatStatus(chatId int64, status string) error {
+	_, err := s.writer.Exec(`UPDATE tgchats SET status = ? WHERE id = ?`, status, chatId)
+	return err
+}
+
+// AddMembershipChange records a transition of a chat member's status.
+func (s *Storage) AddMembershipChange(change *types.MembershipChange) error {
+	query := `INSERT INTO chat_members (chat_id, user_id, changed_by, old_status, new_status, created_at) VALUES (?, ?, ?, ?, ?, ?)`
+	result, err := s.writer.Exec(query, change.ChatId, change.UserId, change.ChangedBy, change.OldStatus, change.NewStatus, change.CreatedAt.Unix())
+	if err != nil {
+		return err
+	}
+	change.Id, err = result.LastInsertId()
+	return err
+}
+
+// GetMembershipChanges returns the latest membership changes in a chat, newest first.
+func (s *Storage) GetMembershipChanges(chatId int64, limit int) ([]*types.MembershipChange, error) {
+	query := `SELECT id, chat_id, user_id, changed_by, old_status, new_status, created_at FROM chat_members
+		WHERE chat_id = ? ORDER BY id DESC LIMIT ?`
+	rows, err := s.db.Query(query, chatId, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var changes []*types.MembershipChange
+	for rows.Next() {
+		var change types.MembershipChange
+		var createdAtUnix int64
+		if err := rows.Scan(&change.Id, &change.ChatId, &change.UserId, &change.ChangedBy, &change.OldStatus, &change.NewStatus, &createdAtUnix); err != nil {
+			return nil, err
+		}
+		change.CreatedAt = time.Unix(createdAtUnix, 0)
+		changes = append(changes, &change)
+	}
+	return changes, rows.Err()
+}
+
+// AddInlineAnswer stores an answer offered to an inline query and sets its Id.
+func (s *Storage) AddInlineAnswer(answer *types.InlineAnswer) error {
+	query := `INSERT INTO inline_answers (user_id, query, model, prompt_hash, answer, cost, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)`
+	result, err := s.writer.Exec(query, answer.UserId, answer.Query, answer.Model, answer.PromptHash, answer.Answer, answer.Cost, answer.CreatedAt.Unix())
+	if err != nil {
+		return err
+	}
+	answer.Id, err = result.LastInsertId()
+	return err
+}
+
+// GetInlineAnswer returns the inline answer with the given ID or sql.ErrNoRows.
+func (s *Storage) GetInlineAnswer(id int64) (*types.InlineAnswer, error) {
+	return scanInlineAnswer(s.db.QueryRow(`SELECT `+inlineAnswerColumns+` FROM inline_answers WHERE id = ?`, id))
+}
+
+// FindInlineAnswer returns the latest answer to the same query by the same model with the
+// same system prompt generated since the given time, or nil if there is none.
+func (s *Storage) FindInlineAnswer(query, model, promptHash string, since time.Time) (*types.InlineAnswer, error) {
+	answer, err := scanInlineAnswer(s.db.QueryRow(`SELECT `+inlineAnswerColumns+` FROM inline_answers
+		WHERE query = ? AND model = ? AND prompt_hash = ? AND created_at >= ? ORDER BY id DESC LIMIT 1`,
+		query, model, promptHash, since.Unix()))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return answer, err
+}
+
+// MarkInlineAnswerChosen records that a user sent the inline answer.
+func (s *Storage) MarkInlineAnswerChosen(id int64, at time.Time) error {
+	_, err := s.writer.Exec(`UPDATE inline_answers SET chosen_at = ? WHERE id = ?`, at.Unix(), id)
+	return err
+}
+
+const inlineAnswerColumns = `id, user_id, query, model, prompt_hash, answer, cost, created_at, chosen_at`
+
+func scanInlineAnswer(row *sql.Row) (*types.InlineAnswer, error) {
+	var answer types.InlineAnswer
+	var createdAtUnix, chosenAtUnix int64
+	err := row.Scan(&answer.Id, &answer.UserId, &answer.Query, &answer.Model, &answer.PromptHash, &answer.Answer, &answer.Cost,
+		&createdAtUnix, &chosenAtUnix)
+	if err != nil {
+		return nil, err
+	}
+	answer.CreatedAt = time.Unix(createdAtUnix, 0)
+	if chosenAtUnix != 0 {
+		answer.ChosenAt = time.Unix(chosenAtUnix, 0)
+	}
+	return &answer, nil
+}
+
+// AddJob schedules a job and sets its Id.
+func (s *Storage) AddJob(job *types.Job) error {
+	query := `INSERT INTO jobs (kind, user_id, chat_id, thread_id, text, cron, timezone, next_run_at, last_run_at, attempts, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	result, err := s.writer.Exec(query, job.Kind, job.UserId, job.ChatId, job.ThreadId, job.Text, job.Cron, job.Timezone,
+		job.NextRunAt.Unix(), unixOrZero(job.LastRunAt), job.Attempts, job.CreatedAt.Unix())
+	if err != nil {
+		return err
+	}
+	job.Id, err = result.LastInsertId()
+	return err
+}
+
+// GetJob returns the job with the given ID or sql.ErrNoRows.
+func (s *Storage) GetJob(id int64) (*types.Job, error) {
+	rows, err := s.db.Query(`SELECT `+jobColumns+` FROM jobs WHERE id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	jobs, err := scanJobs(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(jobs) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return jobs[0], nil
+}
+
+// GetUserJobs returns the jobs of the kind scheduled by the user, the next due first.
+func (s *Storage) GetUserJobs(userId int64, kind string) ([]*types.Job, error) {
+	rows, err := s.db.Query(`SELECT `+jobColumns+` FROM jobs WHERE user_id = ? AND kind = ? ORDER BY next_run_at, id`, userId, kind)
+	if err != nil {
+		return nil, err
+	}
+	return scanJobs(rows)
+}
+
+// GetDueJobs returns up to limit jobs due at the given time, the most overdue first.
+func (s *Storage) GetDueJobs(now time.Time, limit int) ([]*types.Job, error) {
+	rows, err := s.db.Query(`SELECT `+jobColumns+` FROM jobs WHERE next_run_at <= ? ORDER BY next_run_at, id LIMIT ?`, now.Unix(), limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanJobs(rows)
+}
+
+// UpdateJob stores the schedule and the run state of a job.
+func (s *Storage) UpdateJob(job *types.Job) error {
+	_, err := s.writer.Exec(`UPDATE jobs SET text = ?, cron = ?, timezone = ?, next_run_at = ?, last_run_at = ?, attempts = ? WHERE id = ?`,
+		job.Text, job.Cron, job.Timezone, job.NextRunAt.Unix(), unixOrZero(job.LastRunAt), job.Attempts, job.Id)
+	return err
+}
+
+// DeleteJob removes a job and reports whether it existed.
+func (s *Storage) DeleteJob(id int64) (bool, error) {
+	result, err := s.writer.Exec(`DELETE FROM jobs WHERE id = ?`, id)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+const jobColumns = `id, kind, user_id, chat_id, thread_id, text, cron, timezone, next_run_at, last_run_at, attempts, created_at`
+
+func scanJobs(rows *sql.Rows) ([]*types.Job, error) {
+	defer rows.Close()
+	var jobs []*types.Job
+	for rows.Next() {
+		var job types.Job
+		var nextRunAtUnix, lastRunAtUnix, createdAtUnix int64
+		err := rows.Scan(&job.Id, &job.Kind, &job.UserId, &job.ChatId, &job.ThreadId, &job.Text, &job.Cron, &job.Timezone,
+			&nextRunAtUnix, &lastRunAtUnix, &job.Attempts, &createdAtUnix)
+		if err != nil {
+			return nil, err
+		}
+		job.NextRunAt = time.Unix(nextRunAtUnix, 0)
+		if lastRunAtUnix != 0 {
+			job.LastRunAt = time.Unix(lastRunAtUnix, 0)
+		}
+		job.CreatedAt = time.Unix(createdAtUnix, 0)
+		jobs = append(jobs, &job)
+	}
+	return jobs, rows.Err()
+}
+
+// unixOrZero converts a time to Unix time, keeping the zero time as 0.
+func unixOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+// AddNotification queues a notification for the next digest and sets its Id.
+func (s *Storage) AddNotification(n *types.Notification) error {
+	result, err := s.writer.Exec(`INSERT INTO notifications (chat_id, category, text, created_at) VALUES (?, ?, ?, ?)`,
+		n.ChatId, n.Category, n.Text, n.CreatedAt.Unix())
+	if err != nil {
+		return err
+	}
+	n.Id, err = result.LastInsertId()
+	return err
+}
+
+// TakeNotifications removes all queued notifications and returns them ordered by
+// recipient and time.
+func (s *Storage) TakeNotifications() ([]*types.Notification, error) {
+	tx, err := s.writer.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`SELECT id, chat_id, category, text, created_at FROM notifications ORDER BY chat_id, id`)
+	if err != nil {
+		return nil, err
+	}
+	var notifications []*types.Notification
+	var maxId int64
+	for rows.Next() {
+		var n types.Notification
+		var createdAtUnix int64
+		if err := rows.Scan(&n.Id, &n.ChatId, &n.Category, &n.Text, &createdAtUnix); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		n.CreatedAt = time.Unix(createdAtUnix, 0)
+		notifications = append(notifications, &n)
+		maxId = max(maxId, n.Id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// Notifications queued meanwhile stay for the next digest
+	if _, err := tx.Exec(`DELETE FROM notifications WHERE id <= ?`, maxId); err != nil {
+		return nil, err
+	}
+	return notifications, tx.Commit()
+}
+
+// GetDialog returns the dialog of the user in the chat, or nil if there is none.
+// Expired dialogs are returned as well; the caller decides what to do with them.
+func (s *Storage) GetDialog(chatId, userId int64) (*types.Dialog, error) {
+	dialog := types.Dialog{ChatId: chatId, UserId: userId}
+	var data string
+	var expiresAtUnix, updatedAtUnix int64
+	err := s.db.QueryRow(`SELECT name, step, data, expires_at, updated_at FROM dialogs WHERE chat_id = ? AND user_id = ?`, chatId, userId).
+		Scan(&dialog.Name, &dialog.Step, &data, &expiresAtUnix, &updatedAtUnix)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := dialog.DataFromString(data); err != nil {
+		return nil, err
+	}
+	dialog.ExpiresAt = time.Unix(expiresAtUnix, 0)
+	dialog.UpdatedAt = time.Unix(updatedAtUnix, 0)
+	return &dialog, nil
+}
+
+// SaveDialog stores the dialog, replacing any other dialog of the user in the chat.
+func (s *Storage) SaveDialog(dialog *types.Dialog) error {
+	query := `INSERT INTO dialogs (chat_id, user_id, name, step, data, expires_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (chat_id, user_id) DO UPDATE SET name = excluded.name, step = excluded.step, data = excluded.data,
+		expires_at = excluded.expires_at, updated_at = excluded.updated_at`
+	_, err := s.writer.Exec(query, dialog.ChatId, dialog.UserId, dialog.Name, dialog.Step, dialog.DataToString(),
+		dialog.ExpiresAt.Unix(), dialog.UpdatedAt.Unix())
+	return err
+}
+
+// DeleteDialog removes the dialog of the user in the chat and reports whether there was one.
+func (s *Storage) DeleteDialog(chatId, userId int64) (bool, error) {
+	result, err := s.writer.Exec(`DELETE FROM dialogs WHERE chat_id = ? AND user_id = ?`, chatId, userId)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// TakeExpiredDialogs removes the dialogs which expired before now and returns them.
+func (s *Storage) TakeExpiredDialogs(now time.Time) ([]*types.Dialog, error) {
+	tx, err := s.writer.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`SELECT chat_id, user_id, name, step, expires_at, updated_at FROM dialogs WHERE expires_at <= ?`, now.Unix())
+	if err != nil {
+		return nil, err
+	}
+	var dialogs []*types.Dialog
+	for rows.Next() {
+		var dialog types.Dialog
+		var expiresAtUnix, updatedAtUnix int64
+		if err := rows.Scan(&dialog.ChatId, &dialog.UserId, &dialog.Name, &dialog.Step, &expiresAtUnix, &updatedAtUnix); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		dialog.ExpiresAt = time.Unix(expiresAtUnix, 0)
+		dialog.UpdatedAt = time.Unix(updatedAtUnix, 0)
+		dialogs = append(dialogs, &dialog)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`DELETE FROM dialogs WHERE expires_at <= ?`, now.Unix()); err != nil {
+		return nil, err
+	}
+	return dialogs, tx.Commit()
+}
+
+// GetChatSetting returns the value of a chat setting or an empty string if it is not set.
+func (s *Storage) GetChatSetting(chatId int64, key string) (string, error) {
+	chat, err := s.GetTgChat(chatId)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return chat.GetSetting(key), nil
+}
+
+// SetChatSetting sets a chat setting; an empty value removes it.
+// An unknown chat is added to the tgchats table.
+func (s *Storage) SetChatSetting(chatId int64, key, value string) error {
+	chat, err := s.GetTgChat(chatId)
+	if err == sql.ErrNoRows {
+		chat = types.NewTgChat(chatId, "", "")
+		chat.SetSetting(key, value)
+		return s.AddTgChat(chat)
+	}
+	if err != nil {
+		return err
+	}
+	chat.SetSetting(key, value)
+	_, err = s.writer.Exec(`UPDATE tgchats SET settings = ? WHERE id = ?`, chat.SettingsToString(), chatId)
 	return err
 }
@@ -1,6 +1,12 @@
 package storage
 
 import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -176,3 +182,680 @@ func TestStorage_UpdateTgUser(t *testing.T) {
 	assert.Equal(t, user.Permissions, updatedUser.Permissions, "user permissions mismatch after update")
 	assert.Equal(t, user.Info, updatedUser.Info, "user info mismatch after update")
 }
+
+func TestStorage_Usage(t *testing.T) {
+	cfg := createTestConfig()
+	storage := NewStorage(cfg)
+	err := storage.Open()
+	assert.NoError(t, err, "failed to open storage")
+	defer storage.Close()
+
+	old := types.NewUsage(12345, types.UsageImage, "dall-e-3", 0.04)
+	old.CreatedAt = time.Now().Add(-48 * time.Hour)
+	err = storage.AddUsage(old)
+	assert.NoError(t, err, "failed to add old usage")
+	assert.NotZero(t, old.Id, "usage ID should be set after insert")
+
+	err = storage.AddUsage(types.NewUsage(12345, types.UsageImage, "dall-e-3", 0.08))
+	assert.NoError(t, err, "failed to add usage")
+	err = storage.AddUsage(types.NewUsage(67890, types.UsageImage, "dall-e-3", 1.00))
+	assert.NoError(t, err, "failed to add usage of another user")
+
+	total, err := storage.GetUserCostSince(12345, time.Now().Add(-24*time.Hour))
+	assert.NoError(t, err, "failed to get user cost")
+	assert.InDelta(t, 0.08, total, 1e-9, "only recent usage of the user should be counted")
+
+	total, err = storage.GetUserCostSince(11111, time.Now().Add(-24*time.Hour))
+	assert.NoError(t, err, "failed to get cost of unknown user")
+	assert.Zero(t, total, "unknown user should have no cost")
+}
+
+func TestStorage_TgUserSettings(t *testing.T) {
+	cfg := createTestConfig()
+	storage := NewStorage(cfg)
+	err := storage.Open()
+	assert.NoError(t, err, "failed to open storage")
+	defer storage.Close()
+
+	user := types.NewTgUser(12345, "TestUser", []byte("{}"))
+	user.SetSetting(types.SettingVoiceReplies, "on")
+	err = storage.AddTgUser(user)
+	assert.NoError(t, err, "failed to add user")
+
+	retrievedUser, err := storage.GetTgUser(user.Id)
+	assert.NoError(t, err, "failed to get user")
+	assert.Equal(t, "on", retrievedUser.GetSetting(types.SettingVoiceReplies), "user setting mismatch")
+
+	retrievedUser.SetSetting(types.SettingVoiceReplies, "")
+	err = storage.UpdateTgUser(retrievedUser)
+	assert.NoError(t, err, "failed to update user")
+
+	users, err := storage.GetAllTgUsers()
+	assert.NoError(t, err, "failed to get all users")
+	assert.Len(t, users, 1, "unexpected number of users")
+	assert.Empty(t, users[0].Settings, "user settings should be empty after update")
+}
+
+func TestStorage_MigrateOldTgUsers(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "old.sqlite")
+
+	// Create the tgusers table as it was before the settings column was added
+	db, err := sql.Open("sqlite3", filename)
+	assert.NoError(t, err, "failed to create old database")
+	_, err = db.Exec(`CREATE TABLE tgusers (
+		id INTEGER PRIMARY KEY,
+		name TEXT DEFAULT '',
+		created_at INTEGER NOT NULL,
+		seen_at INTEGER NOT NULL,
+		permissions TEXT DEFAULT '',
+		info TEXT DEFAULT ''
+	);`)
+	assert.NoError(t, err, "failed to create old tgusers table")
+	_, err = db.Exec(`INSERT INTO tgusers (id, name, created_at, seen_at) VALUES (1, 'old', 0, 0)`)
+	assert.NoError(t, err, "failed to add old user")
+	db.Close()
+
+	storage := NewStorage(&config.Config{DbPath: filename})
+	err = storage.Open()
+	assert.NoError(t, err, "failed to open old database")
+	defer storage.Close()
+
+	user, err := storage.GetTgUser(1)
+	assert.NoError(t, err, "failed to get old user")
+	assert.Equal(t, "old", user.Name, "user name mismatch")
+	assert.Empty(t, user.Settings, "old user should have no settings")
+}
+
+func TestStorage_Personas(t *testing.T) {
+	cfg := createTestConfig()
+	storage := NewStorage(cfg)
+	err := storage.Open()
+	assert.NoError(t, err, "failed to open storage")
+	defer storage.Close()
+
+	translator := types.NewPersona("translator", "Translate everything to English.", 12345)
+	err = storage.SavePersona(translator)
+	assert.NoError(t, err, "failed to save persona")
+	assert.NotZero(t, translator.Id, "persona ID should be set after save")
+
+	temperature := 0.2
+	reviewer := types.NewPersona("reviewer", "Review the code.", 12345)
+	reviewer.Model = "gpt-4o"
+	reviewer.Temperature = &temperature
+	err = storage.SavePersona(reviewer)
+	assert.NoError(t, err, "failed to save persona")
+
+	// Saving a persona with an existing name updates it
+	updated := types.NewPersona("translator", "Translate everything to Russian.", 67890)
+	err = storage.SavePersona(updated)
+	assert.NoError(t, err, "failed to update persona")
+	assert.Equal(t, translator.Id, updated.Id, "updated persona should keep its ID")
+
+	persona, err := storage.GetPersona("translator")
+	assert.NoError(t, err, "failed to get persona")
+	assert.Equal(t, "Translate everything to Russian.", persona.SystemPrompt, "system prompt mismatch")
+	assert.Equal(t, int64(12345), persona.CreatedBy, "author should not change on update")
+	assert.Nil(t, persona.Temperature, "temperature should be unset")
+
+	personas, err := storage.GetAllPersonas()
+	assert.NoError(t, err, "failed to get all personas")
+	assert.Len(t, personas, 2, "unexpected number of personas")
+	assert.Equal(t, "reviewer", personas[0].Name, "personas should be ordered by name")
+	assert.Equal(t, 0.2, *personas[0].Temperature, "temperature mismatch")
+
+	// Chat selection
+	chatPersona, err := storage.GetChatPersona(555)
+	assert.NoError(t, err, "failed to get chat persona")
+	assert.Nil(t, chatPersona, "chat should have no persona by default")
+
+	err = storage.SetChatPersona(555, reviewer.Id)
+	assert.NoError(t, err, "failed to set chat persona")
+	chatPersona, err = storage.GetChatPersona(555)
+	assert.NoError(t, err, "failed to get chat persona")
+	assert.Equal(t, "reviewer", chatPersona.Name, "chat persona mismatch")
+
+	// Deleting a persona clears its chat selections
+	deleted, err := storage.DeletePersona("reviewer")
+	assert.NoError(t, err, "failed to delete persona")
+	assert.True(t, deleted, "persona should be reported as deleted")
+	chatPersona, err = storage.GetChatPersona(555)
+	assert.NoError(t, err, "failed to get chat persona")
+	assert.Nil(t, chatPersona, "chat persona should be cleared after deletion")
+
+	deleted, err = storage.DeletePersona("reviewer")
+	assert.NoError(t, err, "failed to delete missing persona")
+	assert.False(t, deleted, "missing persona should not be reported as deleted")
+}
+
+func TestStorage_ChatSettings(t *testing.T) {
+	cfg := createTestConfig()
+	storage := NewStorage(cfg)
+	err := storage.Open()
+	assert.NoError(t, err, "failed to open storage")
+	defer storage.Close()
+
+	value, err := storage.GetChatSetting(555, types.SettingModel)
+	assert.NoError(t, err, "failed to get missing chat setting")
+	assert.Empty(t, value, "missing chat setting should be empty")
+
+	err = storage.SetChatSetting(555, types.SettingModel, "local/llama3")
+	assert.NoError(t, err, "failed to set chat setting")
+	err = storage.SetChatSetting(555, types.SettingModel, "openai/gpt-4o")
+	assert.NoError(t, err, "failed to overwrite chat setting")
+
+	value, err = storage.GetChatSetting(555, types.SettingModel)
+	assert.NoError(t, err, "failed to get chat setting")
+	assert.Equal(t, "openai/gpt-4o", value, "chat setting mismatch")
+
+	value, err = storage.GetChatSetting(666, types.SettingModel)
+	assert.NoError(t, err, "failed to get chat setting of another chat")
+	assert.Empty(t, value, "chat settings should be isolated per chat")
+
+	err = storage.SetChatSetting(555, types.SettingModel, "")
+	assert.NoError(t, err, "failed to clear chat setting")
+	value, err = storage.GetChatSetting(555, types.SettingModel)
+	assert.NoError(t, err, "failed to get cleared chat setting")
+	assert.Empty(t, value, "cleared chat setting should be empty")
+}
+
+func TestStorage_ToolCalls(t *testing.T) {
+	cfg := createTestConfig()
+	storage := NewStorage(cfg)
+	err := storage.Open()
+	assert.NoError(t, err, "failed to open storage")
+	defer storage.Close()
+
+	call := types.NewToolCall(12345, -100, "calculate", `{"expression":"2+2"}`, "4", "")
+	err = storage.AddToolCall(call)
+	assert.NoError(t, err, "failed to add tool call")
+	assert.NotZero(t, call.Id, "tool call ID should be set after insert")
+
+	err = storage.AddToolCall(types.NewToolCall(12345, -100, "lookup_user", `{}`, "", "not allowed"))
+	assert.NoError(t, err, "failed to add failed tool call")
+	err = storage.AddToolCall(types.NewToolCall(67890, 67890, "current_time", `{}`, "now", ""))
+	assert.NoError(t, err, "failed to add tool call of another user")
+
+	calls, err := storage.GetUserToolCalls(12345, 10)
+	assert.NoError(t, err, "failed to get tool calls")
+	if assert.Len(t, calls, 2, "only calls of the user should be returned") {
+		assert.Equal(t, "lookup_user", calls[0].Tool, "newest call should come first")
+		assert.Equal(t, "not allowed", calls[0].Error)
+		assert.Equal(t, `{"expression":"2+2"}`, calls[1].Arguments)
+		assert.Equal(t, "4", calls[1].Result)
+		assert.Equal(t, int64(-100), calls[1].ChatId)
+	}
+}
+
+func TestStorage_History(t *testing.T) {
+	cfg := createTestConfig()
+	storage := NewStorage(cfg)
+	err := storage.Open()
+	assert.NoError(t, err, "failed to open storage")
+	defer storage.Close()
+
+	var ids []int64
+	for _, text := range []string{"one", "two", "three"} {
+		msg := types.NewHistoryMessage(100, 0, 12345, "user", text, 1)
+		err = storage.AddHistoryMessage(msg)
+		assert.NoError(t, err, "failed to add history message")
+		ids = append(ids, msg.Id)
+	}
+	err = storage.AddHistoryMessage(types.NewHistoryMessage(200, 0, 12345, "user", "other chat", 2))
+	assert.NoError(t, err, "failed to add history message to another chat")
+	err = storage.AddHistoryMessage(types.NewHistoryMessage(100, 7, 12345, "user", "topic", 2))
+	assert.NoError(t, err, "failed to add history message to a topic")
+
+	history, err := storage.GetHistory(100, 0)
+	assert.NoError(t, err, "failed to get history")
+	if assert.Len(t, history, 3, "only messages of the conversation should be returned") {
+		assert.Equal(t, "one", history[0].Content, "oldest message should come first")
+		assert.Equal(t, int64(12345), history[0].UserId)
+	}
+
+	summary, err := storage.GetSummary(100, 0)
+	assert.NoError(t, err, "failed to get missing summary")
+	assert.Nil(t, summary, "chat without summary should return nil")
+
+	err = storage.SaveSummary(&types.Summary{ChatId: 100, Text: "counted", Tokens: 1, UpdatedAt: time.Now()}, ids[1])
+	assert.NoError(t, err, "failed to save summary")
+	summary, err = storage.GetSummary(100, 0)
+	assert.NoError(t, err, "failed to get summary")
+	assert.Equal(t, "counted", summary.Text)
+
+	history, err = storage.GetHistory(100, 0)
+	assert.NoError(t, err, "failed to get history after summary")
+	if assert.Len(t, history, 1, "summarized messages should be forgotten") {
+		assert.Equal(t, "three", history[0].Content)
+	}
+
+	err = storage.ClearHistory(100, 0)
+	assert.NoError(t, err, "failed to clear history")
+	history, _ = storage.GetHistory(100, 0)
+	assert.Empty(t, history, "history should be empty after clearing")
+	summary, _ = storage.GetSummary(100, 0)
+	assert.Nil(t, summary, "summary should be removed after clearing")
+	history, _ = storage.GetHistory(200, 0)
+	assert.Len(t, history, 1, "other chats should be kept")
+	history, _ = storage.GetHistory(100, 7)
+	assert.Len(t, history, 1, "other topics of the chat should be kept")
+}
+
+func TestStorage_TgChats(t *testing.T) {
+	cfg := createTestConfig()
+	storage := NewStorage(cfg)
+	err := storage.Open()
+	assert.NoError(t, err, "failed to open storage")
+	defer storage.Close()
+
+	_, err = storage.GetTgChat(-100)
+	assert.Equal(t, sql.ErrNoRows, err, "unknown chat should return sql.ErrNoRows")
+
+	chat := types.NewTgChat(-100, "supergroup", "Family")
+	chat.AddPermission(types.CanChat)
+	err = storage.AddTgChat(chat)
+	assert.NoError(t, err, "failed to add chat")
+	err = storage.AddTgChat(types.NewTgChat(12345, "private", "user"))
+	assert.NoError(t, err, "failed to add private chat")
+
+	got, err := storage.GetTgChat(-100)
+	assert.NoError(t, err, "failed to get chat")
+	assert.Equal(t, "supergroup", got.Type, "chat type mismatch")
+	assert.Equal(t, "Family", got.Title, "chat title mismatch")
+	assert.True(t, got.HasPermission(types.CanChat), "chat permissions should be stored")
+
+	got.Title = "Family & friends"
+	got.AddPermission(types.CanDraw)
+	got.SetSetting(types.SettingModel, "local/llama3")
+	err = storage.UpdateTgChat(got)
+	assert.NoError(t, err, "failed to update chat")
+
+	got, err = storage.GetTgChat(-100)
+	assert.NoError(t, err, "failed to get updated chat")
+	assert.Equal(t, "Family & friends", got.Title, "updated title mismatch")
+	assert.Equal(t, "CanChat,CanDraw", got.PermissionsToString(), "updated permissions mismatch")
+	value, err := storage.GetChatSetting(-100, types.SettingModel)
+	assert.NoError(t, err, "failed to get chat setting")
+	assert.Equal(t, "local/llama3", value, "chat settings should be stored in tgchats")
+
+	chats, err := storage.GetAllTgChats()
+	assert.NoError(t, err, "failed to get all chats")
+	assert.Len(t, chats, 2, "all chats should be returned")
+}
+
+func TestStorage_Membership(t *testing.T) {
+	cfg := createTestConfig()
+	storage := NewStorage(cfg)
+	err := storage.Open()
+	assert.NoError(t, err, "failed to open storage")
+	defer storage.Close()
+
+	err = storage.AddTgChat(types.NewTgChat(-100, "group", "Family"))
+	assert.NoError(t, err, "failed to add chat")
+	err = storage.SetTgChatStatus(-100, types.StatusKicked)
+	assert.NoError(t, err, "failed to set chat status")
+	chat, err := storage.GetTgChat(-100)
+	assert.NoError(t, err, "failed to get chat")
+	assert.Equal(t, types.StatusKicked, chat.Status, "chat status mismatch")
+	assert.True(t, chat.BotRemoved(), "kicked bot should be removed")
+
+	err = storage.AddMembershipChange(types.NewMembershipChange(-100, 42, 1, types.StatusLeft, types.StatusMember))
+	assert.NoError(t, err, "failed to add membership change")
+	err = storage.AddMembershipChange(types.NewMembershipChange(-100, 42, 1, types.StatusMember, types.StatusKicked))
+	assert.NoError(t, err, "failed to add second membership change")
+	err = storage.AddMembershipChange(types.NewMembershipChange(-200, 42, 2, types.StatusLeft, types.StatusMember))
+	assert.NoError(t, err, "failed to add membership change in another chat")
+
+	changes, err := storage.GetMembershipChanges(-100, 10)
+	assert.NoError(t, err, "failed to get membership changes")
+	if assert.Len(t, changes, 2, "only changes of the chat should be returned") {
+		assert.Equal(t, types.StatusKicked, changes[0].NewStatus, "newest change should come first")
+		assert.Equal(t, types.StatusLeft, changes[1].OldStatus)
+		assert.Equal(t, int64(1), changes[1].ChangedBy)
+	}
+}
+
+func TestStorage_Dialogs(t *testing.T) {
+	cfg := createTestConfig()
+	storage := NewStorage(cfg)
+	err := storage.Open()
+	assert.NoError(t, err, "failed to open storage")
+	defer storage.Close()
+
+	dialog, err := storage.GetDialog(-100, 42)
+	assert.NoError(t, err, "failed to get missing dialog")
+	assert.Nil(t, dialog, "there should be no dialog yet")
+
+	dialog = types.NewDialog(-100, 42, "persona", "name", time.Hour)
+	dialog.Data["name"] = "pirate"
+	err = storage.SaveDialog(dialog)
+	assert.NoError(t, err, "failed to save dialog")
+	err = storage.SaveDialog(types.NewDialog(-100, 7, "persona", "name", -time.Minute))
+	assert.NoError(t, err, "failed to save dialog of another user")
+
+	dialog.Step = "prompt"
+	err = storage.SaveDialog(dialog)
+	assert.NoError(t, err, "failed to update dialog")
+	got, err := storage.GetDialog(-100, 42)
+	assert.NoError(t, err, "failed to get dialog")
+	if assert.NotNil(t, got) {
+		assert.Equal(t, "prompt", got.Step, "step mismatch")
+		assert.Equal(t, "pirate", got.Data["name"], "data mismatch")
+		assert.False(t, got.Expired())
+	}
+	got, err = storage.GetDialog(-200, 42)
+	assert.NoError(t, err)
+	assert.Nil(t, got, "dialogs are isolated per chat")
+
+	expired, err := storage.TakeExpiredDialogs(time.Now())
+	assert.NoError(t, err, "failed to take expired dialogs")
+	if assert.Len(t, expired, 1) {
+		assert.Equal(t, int64(7), expired[0].UserId)
+	}
+	got, _ = storage.GetDialog(-100, 7)
+	assert.Nil(t, got, "expired dialog should be removed")
+
+	deleted, err := storage.DeleteDialog(-100, 42)
+	assert.NoError(t, err, "failed to delete dialog")
+	assert.True(t, deleted)
+	deleted, err = storage.DeleteDialog(-100, 42)
+	assert.NoError(t, err)
+	assert.False(t, deleted, "nothing left to delete")
+}
+
+func TestStorage_InlineAnswers(t *testing.T) {
+	cfg := createTestConfig()
+	storage := NewStorage(cfg)
+	err := storage.Open()
+	assert.NoError(t, err, "failed to open storage")
+	defer storage.Close()
+
+	answer := types.NewInlineAnswer(42, "capital of France", "gpt-4o-mini", "pirate", "Paris", 0.0001)
+	err = storage.AddInlineAnswer(answer)
+	assert.NoError(t, err, "failed to add inline answer")
+	assert.NotZero(t, answer.Id, "inline answer ID should be set")
+
+	cached, err := storage.FindInlineAnswer("capital of France", "gpt-4o-mini", "pirate", time.Now().Add(-time.Hour))
+	assert.NoError(t, err, "failed to find inline answer")
+	if assert.NotNil(t, cached) {
+		assert.Equal(t, "Paris", cached.Answer)
+		assert.True(t, cached.ChosenAt.IsZero(), "answer should not be chosen yet")
+	}
+	cached, err = storage.FindInlineAnswer("capital of France", "other-model", "pirate", time.Now().Add(-time.Hour))
+	assert.NoError(t, err)
+	assert.Nil(t, cached, "answers of other models should not be found")
+	cached, err = storage.FindInlineAnswer("capital of France", "gpt-4o-mini", "butler", time.Now().Add(-time.Hour))
+	assert.NoError(t, err)
+	assert.Nil(t, cached, "answers for other system prompts should not be found")
+	cached, err = storage.FindInlineAnswer("capital of France", "gpt-4o-mini", "pirate", time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Nil(t, cached, "old answers should not be found")
+
+	err = storage.MarkInlineAnswerChosen(answer.Id, time.Now())
+	assert.NoError(t, err, "failed to mark inline answer chosen")
+	got, err := storage.GetInlineAnswer(answer.Id)
+	assert.NoError(t, err, "failed to get inline answer")
+	assert.False(t, got.ChosenAt.IsZero(), "answer should be chosen")
+
+	_, err = storage.GetInlineAnswer(answer.Id + 1)
+	assert.Equal(t, sql.ErrNoRows, err, "missing answer should not be found")
+}
+
+func TestStorage_Jobs(t *testing.T) {
+	cfg := createTestConfig()
+	storage := NewStorage(cfg)
+	err := storage.Open()
+	assert.NoError(t, err, "failed to open storage")
+	defer storage.Close()
+
+	now := time.Now()
+	soon := types.NewJob(types.JobReminder, 42, 42, 0, "call mom", "", "Europe/Berlin", now.Add(-time.Minute))
+	err = storage.AddJob(soon)
+	assert.NoError(t, err, "failed to add job")
+	assert.NotZero(t, soon.Id, "job ID should be set")
+	daily := types.NewJob(types.JobReminder, 42, -100, 7, "vitamins", "0 9 * * *", "Europe/Berlin", now.Add(time.Hour))
+	err = storage.AddJob(daily)
+	assert.NoError(t, err, "failed to add recurring job")
+	err = storage.AddJob(types.NewJob(types.JobReminder, 7, 7, 0, "other user", "", "", now.Add(-time.Hour)))
+	assert.NoError(t, err, "failed to add job of another user")
+
+	due, err := storage.GetDueJobs(now, 10)
+	assert.NoError(t, err, "failed to get due jobs")
+	if assert.Len(t, due, 2, "only jobs due now should be returned") {
+		assert.Equal(t, "other user", due[0].Text, "the most overdue job should come first")
+	}
+
+	jobs, err := storage.GetUserJobs(42, types.JobReminder)
+	assert.NoError(t, err, "failed to get user jobs")
+	if assert.Len(t, jobs, 2) {
+		assert.Equal(t, soon.Id, jobs[0].Id, "the next due job should come first")
+		assert.Equal(t, "0 9 * * *", jobs[1].Cron, "cron mismatch")
+		assert.Equal(t, 7, jobs[1].ThreadId, "thread mismatch")
+		assert.True(t, jobs[1].LastRunAt.IsZero(), "job should not have run yet")
+	}
+
+	daily.LastRunAt = now
+	daily.NextRunAt = now.Add(24 * time.Hour)
+	daily.Attempts = 1
+	err = storage.UpdateJob(daily)
+	assert.NoError(t, err, "failed to update job")
+	got, err := storage.GetJob(daily.Id)
+	assert.NoError(t, err, "failed to get job")
+	assert.Equal(t, now.Unix(), got.LastRunAt.Unix(), "last run mismatch")
+	assert.Equal(t, 1, got.Attempts, "attempts mismatch")
+
+	deleted, err := storage.DeleteJob(soon.Id)
+	assert.NoError(t, err, "failed to delete job")
+	assert.True(t, deleted)
+	_, err = storage.GetJob(soon.Id)
+	assert.Equal(t, sql.ErrNoRows, err, "deleted job should not be found")
+}
+
+func TestStorage_Notifications(t *testing.T) {
+	cfg := createTestConfig()
+	storage := NewStorage(cfg)
+	err := storage.Open()
+	assert.NoError(t, err, "failed to open storage")
+	defer storage.Close()
+
+	taken, err := storage.TakeNotifications()
+	assert.NoError(t, err, "failed to take notifications from an empty queue")
+	assert.Empty(t, taken)
+
+	for _, n := range []*types.Notification{
+		types.NewNotification(2, types.NotifyError, "second admin"),
+		types.NewNotification(1, types.NotifyError, "first"),
+		types.NewNotification(1, types.NotifyQuota, "second"),
+	} {
+		assert.NoError(t, storage.AddNotification(n), "failed to add notification")
+		assert.NotZero(t, n.Id)
+	}
+
+	taken, err = storage.TakeNotifications()
+	assert.NoError(t, err, "failed to take notifications")
+	if assert.Len(t, taken, 3) {
+		assert.Equal(t, []string{"first", "second", "second admin"}, []string{taken[0].Text, taken[1].Text, taken[2].Text},
+			"ordered by recipient and time")
+		assert.Equal(t, types.NotifyQuota, taken[1].Category)
+	}
+	taken, err = storage.TakeNotifications()
+	assert.NoError(t, err)
+	assert.Empty(t, taken, "taken notifications are removed")
+}
+
+func TestStorage_Maintenance(t *testing.T) {
+	dir := t.TempDir()
+	storage := NewStorage(&config.Config{DbPath: filepath.Join(dir, "gourbot.sqlite")})
+	assert.NoError(t, storage.Open())
+	defer storage.Close()
+
+	version, err := storage.SchemaVersion()
+	assert.NoError(t, err)
+	assert.Equal(t, SchemaVersion, version)
+
+	assert.NoError(t, storage.AddTgUser(types.NewTgUser(1, "Alice", nil)))
+	assert.NoError(t, storage.AddTgRecord(false, []byte(`{"update_id":1}`)))
+	assert.NoError(t, storage.AddTgRecord(true, []byte(`{"message_id":2}`)))
+	assert.NoError(t, storage.Vacuum())
+
+	records, err := storage.GetTgRecords(0, 10)
+	assert.NoError(t, err)
+	if assert.Len(t, records, 2) {
+		assert.False(t, records[0].Out)
+		assert.True(t, records[1].Out)
+		assert.Equal(t, `{"message_id":2}`, string(records[1].Data))
+	}
+	records, err = storage.GetTgRecords(records[0].Uid, 10)
+	assert.NoError(t, err)
+	assert.Len(t, records, 1)
+
+	var out strings.Builder
+	assert.NoError(t, storage.Export(&out))
+	assert.Contains(t, out.String(), `{"row":{"created_at":`)
+	assert.Contains(t, out.String(), `"name":"Alice"`)
+	assert.Contains(t, out.String(), `"table":"tgdump"`)
+
+	backup := filepath.Join(dir, "backup.sqlite")
+	assert.NoError(t, storage.Backup(backup))
+	assert.Error(t, storage.Backup(backup), "an existing file is not overwritten")
+	copied := NewStorage(&config.Config{DbPath: backup})
+	assert.NoError(t, copied.Open())
+	user, err := copied.GetTgUser(1)
+	assert.NoError(t, err)
+	assert.Equal(t, "Alice", user.Name)
+
+	_, err = copied.writer.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, SchemaVersion+1))
+	assert.NoError(t, err)
+	copied.Close()
+	assert.Error(t, copied.Open(), "a newer schema is refused")
+}
+
+func TestStorage_BackupRotation(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "gourbot.sqlite")
+	backupDir := filepath.Join(dir, "backups")
+	storage := NewStorage(&config.Config{DbPath: dbPath})
+	assert.NoError(t, storage.Open())
+	assert.NoError(t, os.MkdirAll(backupDir, 0o700))
+
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	for day := 0; day < 4; day++ {
+		assert.NoError(t, storage.Backup(BackupName(dbPath, backupDir, start.AddDate(0, 0, day))))
+	}
+	assert.NoError(t, os.WriteFile(filepath.Join(backupDir, "gourbot-notes.sqlite"), nil, 0o600))
+	assert.NoError(t, os.WriteFile(filepath.Join(backupDir, "other-20240101-000000.sqlite"), nil, 0o600))
+
+	backups, err := ListBackups(dbPath, backupDir)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(backupDir, "gourbot-20240102-030405.sqlite"),
+		filepath.Join(backupDir, "gourbot-20240103-030405.sqlite"),
+		filepath.Join(backupDir, "gourbot-20240104-030405.sqlite"),
+		filepath.Join(backupDir, "gourbot-20240105-030405.sqlite"),
+	}, backups)
+
+	deleted, err := RotateBackups(dbPath, backupDir, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, backups[:2], deleted)
+	remaining, _ := ListBackups(dbPath, backupDir)
+	assert.Equal(t, backups[2:], remaining)
+
+	backups, err = ListBackups(dbPath, filepath.Join(dir, "missing"))
+	assert.NoError(t, err)
+	assert.Empty(t, backups)
+
+	// Restore a backup taken before a user was added, which fails while the database is open
+	assert.NoError(t, storage.AddTgUser(types.NewTgUser(1, "Alice", nil)))
+	_, err = Restore(remaining[1], dbPath)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "is in use")
+	}
+	assert.NoError(t, storage.Close())
+	version, err := CheckBackup(remaining[1])
+	assert.NoError(t, err)
+	assert.Equal(t, SchemaVersion, version)
+	kept, err := Restore(remaining[1], dbPath)
+	assert.NoError(t, err)
+	assert.FileExists(t, kept)
+
+	assert.NoError(t, storage.Open())
+	_, err = storage.GetTgUser(1)
+	assert.Equal(t, sql.ErrNoRows, err)
+	assert.NoError(t, storage.Close())
+
+	junk := filepath.Join(dir, "junk.sqlite")
+	assert.NoError(t, os.WriteFile(junk, []byte("not a database"), 0o600))
+	_, err = Restore(junk, dbPath)
+	assert.Error(t, err)
+	_, err = CheckBackup(filepath.Join(backupDir, "gourbot-notes.sqlite"))
+	assert.Error(t, err, "an empty file is no gourbot database")
+	assert.FileExists(t, dbPath)
+}
+
+// TestStorage_Concurrency runs handlers writing and reading at the same time, like the
+// workers of the bot, with a second Storage on the same file standing in for a gourbot
+// command run while the bot works. None of them may fail with "database is locked".
+func TestStorage_Concurrency(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "gourbot.sqlite")
+	bot := NewStorage(&config.Config{DbPath: dbPath})
+	assert.NoError(t, bot.Open())
+	defer bot.Close()
+	command := NewStorage(&config.Config{DbPath: dbPath})
+	assert.NoError(t, command.Open())
+	defer command.Close()
+
+	var journalMode string
+	assert.NoError(t, bot.db.QueryRow(`PRAGMA journal_mode`).Scan(&journalMode))
+	assert.Equal(t, "wal", journalMode)
+
+	const workers, rounds = 16, 50
+	errs := make(chan error, workers*rounds*5)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		s := bot
+		if w%4 == 3 {
+			s = command
+		}
+		wg.Add(1)
+		go func(w int, s *Storage) {
+			defer wg.Done()
+			userId := int64(1000 + w)
+			if err := s.AddTgUser(types.NewTgUser(userId, fmt.Sprint("user", w), nil)); err != nil {
+				errs <- err
+				return
+			}
+			for i := 0; i < rounds; i++ {
+				errs <- s.AddTgRecord(false, []byte(fmt.Sprintf(`{"update_id":%d}`, w*rounds+i)))
+				errs <- s.AddHistoryMessage(types.NewHistoryMessage(userId, 0, userId, "user", fmt.Sprint("message ", i), 1))
+				user, err := s.GetTgUser(userId)
+				if err == nil {
+					user.AddPermission(types.CanChat)
+					err = s.UpdateTgUser(user)
+				}
+				errs <- err
+				_, err = s.GetHistory(userId, 0)
+				errs <- err
+				if i%10 == 0 {
+					errs <- s.AddNotification(types.NewNotification(userId, types.NotifyError, "failure"))
+					_, err = s.TakeNotifications()
+					errs <- err
+				}
+			}
+		}(w, s)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if !assert.NoError(t, err) {
+			break
+		}
+	}
+
+	records, err := bot.GetTgRecords(0, workers*rounds+1)
+	assert.NoError(t, err)
+	assert.Len(t, records, workers*rounds)
+	for w := 0; w < workers; w++ {
+		history, err := bot.GetHistory(int64(1000+w), 0)
+		assert.NoError(t, err)
+		assert.Len(t, history, rounds)
+	}
+}
@@ -0,0 +1,197 @@
+package tgbot
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+
+	"gourbot/internal/config"
+	"gourbot/internal/types"
+
+	"github.com/go-telegram/bot/models"
+)
+
+const (
+	approveUsage = "Usage: /approve <user ID> [permission ...]; CanChat is granted by default"
+	revokeUsage  = "Usage: /revoke <user ID> [permission ...]; all permissions are revoked by default"
+)
+
+// adminPermissions are granted to the admins and the admin group of the configuration.
+var adminPermissions = []string{types.CanManageUsers, types.CanStopBot}
+
+// NotifyTargets returns the chats notifications go to: the admin group if there is one,
+// otherwise every master and admin.
+func NotifyTargets(cfg *config.Config) []int64 {
+	if cfg.AdminChatID != 0 {
+		return []int64{cfg.AdminChatID}
+	}
+	var targets []int64
+	for _, id := range append(slices.Clone(cfg.MasterUIDs), cfg.AdminUIDs...) {
+		if !slices.Contains(targets, id) {
+			targets = append(targets, id)
+		}
+	}
+	return targets
+}
+
+// applyAdmins grants the masters, the admins and the admin group of the configuration
+// their permissions. Those dropped since the running configuration lose them again;
+// running is nil on start.
+func (tgBot *TgBot) applyAdmins(running, cfg *config.Config) {
+	if running != nil {
+		for _, id := range running.MasterUIDs {
+			if !slices.Contains(cfg.MasterUIDs, id) {
+				tgBot.changeUserByConfig(id, []string{types.CanEverything}, false)
+			}
+		}
+		for _, id := range running.AdminUIDs {
+			if !slices.Contains(cfg.AdminUIDs, id) {
+				tgBot.changeUserByConfig(id, adminPermissions, false)
+			}
+		}
+		if running.AdminChatID != 0 && running.AdminChatID != cfg.AdminChatID {
+			tgBot.changeChatByConfig(running.AdminChatID, false)
+		}
+	}
+	for _, id := range cfg.MasterUIDs {
+		tgBot.changeUserByConfig(id, []string{types.CanEverything}, true)
+	}
+	for _, id := range cfg.AdminUIDs {
+		tgBot.changeUserByConfig(id, adminPermissions, true)
+	}
+	if cfg.AdminChatID != 0 {
+		tgBot.changeChatByConfig(cfg.AdminChatID, true)
+	}
+}
+
+// changeUserByConfig grants or revokes permissions of a user named in the configuration,
+// adding the user if needed.
+func (tgBot *TgBot) changeUserByConfig(id int64, permissions []string, grant bool) {
+	user, err := tgBot.storage.GetTgUser(id)
+	exists := err == nil
+	if err == sql.ErrNoRows {
+		user, err = types.NewTgUser(id, "admin", nil), nil
+	}
+	if err != nil {
+		tgBot.logger.Errorf("Failed to retrieve user %d: %v", id, err)
+		return
+	}
+	for _, permission := range permissions {
+		if grant {
+			user.AddPermission(permission)
+		} else {
+			user.RemovePermission(permission)
+		}
+	}
+	if exists {
+		err = tgBot.storage.UpdateTgUser(user)
+	} else if grant {
+		err = tgBot.storage.AddTgUser(user)
+	}
+	if err != nil {
+		tgBot.logger.Errorf("Failed to store permissions of user %d: %v", id, err)
+	}
+}
+
+// changeChatByConfig grants or revokes the admin permissions of the admin group, adding
+// the chat if needed; its type and title are filled in when the bot sees it.
+func (tgBot *TgBot) changeChatByConfig(id int64, grant bool) {
+	chat, err := tgBot.storage.GetTgChat(id)
+	exists := err == nil
+	if err == sql.ErrNoRows {
+		chat, err = types.NewTgChat(id, string(models.ChatTypeSupergroup), "admin group"), nil
+	}
+	if err != nil {
+		tgBot.logger.Errorf("Failed to retrieve chat %d: %v", id, err)
+		return
+	}
+	for _, permission := range adminPermissions {
+		if grant {
+			chat.AddPermission(permission)
+		} else {
+			chat.RemovePermission(permission)
+		}
+	}
+	if exists {
+		err = tgBot.storage.UpdateTgChat(chat)
+	} else if grant {
+		err = tgBot.storage.AddTgChat(chat)
+	}
+	if err != nil {
+		tgBot.logger.Errorf("Failed to store permissions of chat %d: %v", id, err)
+	}
+}
+
+// CmdApprove handles the "/approve" command which grants permissions to a user.
+func (tgBot *TgBot) CmdApprove(update *models.Update) {
+	tgBot.changeUserPermissions(update, approveUsage, func(user *types.TgUser, permissions []string) error {
+		if len(permissions) == 0 {
+			permissions = []string{types.CanChat}
+		}
+		for _, permission := range permissions {
+			user.AddPermission(permission)
+		}
+		return nil
+	})
+}
+
+// CmdRevoke handles the "/revoke" command which takes permissions of a user away.
+func (tgBot *TgBot) CmdRevoke(update *models.Update) {
+	tgBot.changeUserPermissions(update, revokeUsage, func(user *types.TgUser, permissions []string) error {
+		if slices.Contains(tgBot.config().MasterUIDs, user.Id) {
+			return fmt.Errorf("%s is a master in the configuration, remove them there", user.Name)
+		}
+		if len(permissions) == 0 {
+			user.ClearPermissions()
+		}
+		for _, permission := range permissions {
+			user.RemovePermission(permission)
+		}
+		return nil
+	})
+}
+
+// changeUserPermissions implements the commands which change user permissions. Only
+// masters may grant CanEverything or change the permissions of other masters.
+func (tgBot *TgBot) changeUserPermissions(update *models.Update, usage string, change func(user *types.TgUser, permissions []string) error) {
+	sender := tgBot.UserWithPermission(update, types.CanManageUsers)
+	if sender == nil {
+		return
+	}
+	userID, permissions, err := ParseUserPermissionArgs(CommandArgs(update.Message.Text))
+	if err != nil {
+		tgBot.Reply(update, err.Error()+"\n"+usage)
+		return
+	}
+	user, err := tgBot.storage.GetTgUser(userID)
+	if err == sql.ErrNoRows {
+		tgBot.Reply(update, fmt.Sprintf("Unknown user %d. Users become known when they write to the bot.", userID))
+		return
+	}
+	if err == nil {
+		if (slices.Contains(permissions, types.CanEverything) || user.HasPermission(types.CanEverything)) &&
+			!sender.HasPermission(types.CanEverything) {
+			tgBot.Reply(update, "Only masters may grant CanEverything or change the permissions of masters.")
+			return
+		}
+		if err := change(user, permissions); err != nil {
+			tgBot.Reply(update, err.Error())
+			return
+		}
+		err = tgBot.storage.UpdateTgUser(user)
+	}
+	if err != nil {
+		tgBot.logger.Errorf("Failed to change permissions of user %d: %v", userID, err)
+		tgBot.Reply(update, "Failed to change the user permissions.")
+		return
+	}
+	tgBot.Reply(update, fmt.Sprintf("User %s now has permissions [%s].", user.Name, user.PermissionsToString()))
+	tgBot.Notify(types.NotifySecurity, fmt.Sprintf("%s (%d) changed the permissions of %s (%d) to [%s].",
+		sender.Name, sender.Id, user.Name, user.Id, user.PermissionsToString()))
+}
+
+// ParseUserPermissionArgs parses "<user ID> [permission ...]" arguments of the user
+// commands and of "gourbot users".
+func ParseUserPermissionArgs(args string) (int64, []string, error) {
+	return parsePermissionArgs(args, "user")
+}
@@ -0,0 +1,25 @@
+package tgbot
+
+import (
+	"testing"
+
+	"gourbot/internal/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotifyTargets(t *testing.T) {
+	cfg := &config.Config{MasterUIDs: []int64{1, 2}, AdminUIDs: []int64{2, 3}}
+	assert.Equal(t, []int64{1, 2, 3}, NotifyTargets(cfg), "masters and admins, each once")
+	assert.Equal(t, []int64{1, 2}, cfg.MasterUIDs, "the configuration is not changed")
+
+	cfg.AdminChatID = -1001234
+	assert.Equal(t, []int64{-1001234}, NotifyTargets(cfg), "only the admin group")
+}
+
+func TestParseUserPermissionArgs(t *testing.T) {
+	_, _, err := parsePermissionArgs("", "user")
+	assert.EqualError(t, err, "user ID is missing")
+	_, _, err = parsePermissionArgs("alice", "user")
+	assert.EqualError(t, err, `bad user ID "alice"`)
+}
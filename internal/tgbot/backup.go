@@ -0,0 +1,121 @@
+package tgbot
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gourbot/internal/config"
+	"gourbot/internal/storage"
+	"gourbot/internal/types"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// maxDocumentSize is the largest file a bot may send, 50 MB.
+const maxDocumentSize = 50 << 20
+
+const backupUsage = "Usage: /backup [now] sends the latest database backup, with now a fresh one."
+
+// scheduleBackup keeps the backup job on the schedule of GOURBOT_BACKUP_SCHEDULE.
+func (tgBot *TgBot) scheduleBackup(cfg *config.Config) {
+	tgBot.scheduleSystemJob(types.JobBackup, cfg.BackupSchedule, cfg)
+}
+
+// runBackup backs the database up on schedule; failures are retried and reported by the
+// scheduler.
+func (tgBot *TgBot) runBackup(job *types.Job, late time.Duration) error {
+	filename, err := tgBot.backup(tgBot.config())
+	if err != nil {
+		return err
+	}
+	tgBot.logger.Infof("Database backed up to %s", filename)
+	return nil
+}
+
+// backup writes a new backup of the database to the backup directory and deletes the
+// oldest backups beyond GOURBOT_BACKUP_KEEP.
+func (tgBot *TgBot) backup(cfg *config.Config) (string, error) {
+	if err := os.MkdirAll(cfg.BackupDir, 0o700); err != nil {
+		return "", err
+	}
+	filename := storage.BackupName(cfg.DbPath, cfg.BackupDir, time.Now())
+	if err := tgBot.storage.Backup(filename); err != nil {
+		return "", fmt.Errorf("backup to %s failed: %w", filename, err)
+	}
+	deleted, err := storage.RotateBackups(cfg.DbPath, cfg.BackupDir, cfg.BackupKeep)
+	if len(deleted) > 0 {
+		tgBot.logger.Infof("Deleted old backups %s", strings.Join(deleted, ", "))
+	}
+	if err != nil {
+		tgBot.logger.Errorf("Failed to delete old backups: %v", err)
+	}
+	return filename, nil
+}
+
+// CmdBackup handles the "/backup [now]" command which sends the master the latest backup
+// of the database as a document, making one if there is none or with "now". The backup
+// holds all data of the bot, so it is sent to private chats only.
+func (tgBot *TgBot) CmdBackup(update *models.Update) {
+	if !tgBot.IsAllowed(update.Message.From.ID) {
+		tgBot.Reply(update, "You are not authorized to get backups.")
+		tgBot.Notify(types.NotifySecurity, fmt.Sprintf("%s (%d) was refused /backup, only masters may get backups.",
+			DisplayName(update.Message.From), update.Message.From.ID))
+		return
+	}
+	if update.Message.Chat.Type != models.ChatTypePrivate {
+		tgBot.Reply(update, "Backups are sent in the private chat with the bot only.")
+		return
+	}
+	args := strings.ToLower(CommandArgs(update.Message.Text))
+	if args != "" && args != "now" {
+		tgBot.Reply(update, backupUsage)
+		return
+	}
+
+	cfg := tgBot.config()
+	backups, err := storage.ListBackups(cfg.DbPath, cfg.BackupDir)
+	if err != nil {
+		tgBot.logger.Errorf("Failed to list backups: %v", err)
+	}
+	var filename string
+	if len(backups) > 0 && args != "now" {
+		filename = backups[len(backups)-1]
+	} else if filename, err = tgBot.backup(cfg); err != nil {
+		tgBot.logger.Errorf("Backup for /backup failed: %v", err)
+		tgBot.Reply(update, "Failed to back the database up.")
+		return
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		tgBot.logger.Errorf("Failed to open backup %s: %v", filename, err)
+		tgBot.Reply(update, "Failed to read the backup.")
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		tgBot.logger.Errorf("Failed to stat backup %s: %v", filename, err)
+		tgBot.Reply(update, "Failed to read the backup.")
+		return
+	}
+	if info.Size() > maxDocumentSize {
+		tgBot.Reply(update, fmt.Sprintf("The backup %s is too large to send, bots may send up to 50 MB.", filename))
+		return
+	}
+	_, err = tgBot.SendDocument(&bot.SendDocumentParams{
+		ChatID:   update.Message.Chat.ID,
+		Document: &models.InputFileUpload{Filename: filepath.Base(filename), Data: file},
+		Caption:  fmt.Sprintf("Backup of %s, made %s.", filepath.Base(cfg.DbPath), info.ModTime().Format("2006-01-02 15:04:05")),
+	})
+	if err != nil {
+		tgBot.Reply(update, "Failed to send the backup.")
+		return
+	}
+	tgBot.Notify(types.NotifySecurity, fmt.Sprintf("%s (%d) downloaded the backup %s.",
+		DisplayName(update.Message.From), update.Message.From.ID, filepath.Base(filename)))
+}
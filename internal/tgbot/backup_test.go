@@ -0,0 +1,33 @@
+package tgbot
+
+import (
+	"strings"
+	"testing"
+
+	"gourbot/internal/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCmdBackup_SendFailure(t *testing.T) {
+	tgBot, api := newTestBot(t)
+	cfg := tgBot.config()
+	cfg.BackupDir = t.TempDir()
+	cfg.BackupKeep = 3
+	cfg.AdminChatID = -100
+	addTestUser(t, tgBot, 42, types.CanEverything)
+
+	api.fail("sendDocument", "Bad Request: file is too big")
+	tgBot.CmdBackup(privateMessage(42, "/backup now"))
+	assert.Equal(t, "Failed to send the backup.", lastText(api))
+	for _, call := range api.sent("sendMessage") {
+		assert.NotEqual(t, "-100", call.params.Get("chat_id"), "a failed upload is no download")
+	}
+
+	api.succeed("sendDocument")
+	tgBot.CmdBackup(privateMessage(42, "/backup"))
+	if documents := api.sent("sendDocument"); assert.Len(t, documents, 2) {
+		assert.Equal(t, "42", documents[1].params.Get("chat_id"))
+	}
+	assert.True(t, strings.HasPrefix(lastText(api), "Test (42) downloaded the backup "), lastText(api))
+}
@@ -0,0 +1,336 @@
+package tgbot
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gourbot/internal/types"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// Dialog of the "/broadcast" command.
+const (
+	broadcastDialog       = "broadcast"
+	broadcastStepContent  = "content"
+	broadcastStepConfirm  = "confirm"
+	broadcastChoiceSend   = "send"
+	broadcastChoiceCancel = "cancel"
+	broadcastKeyFilter    = "filter"
+	broadcastKeyChat      = "chat"
+	broadcastKeyMessage   = "message"
+	broadcastKeyForward   = "forward"
+)
+
+// maxReportEntries limits the users listed in a section of a broadcast report.
+const maxReportEntries = 50
+
+const broadcastUsage = "Usage: /broadcast [perm=<permission>|any] [role=<persona>] [seen=<days>]\nWithout perm only users with CanChat receive the message."
+
+// BroadcastFilter selects the recipients of a broadcast.
+type BroadcastFilter struct {
+	Permission string // Required permission; empty means any known user
+	Role       string // Persona selected in the user's private chat; empty means any
+	SeenDays   int    // The user must have been seen within so many days; 0 means any time
+}
+
+// ParseBroadcastFilter parses the key=value filters of /broadcast. Without a perm filter
+// only users with CanChat are selected, "perm=any" selects all known users.
+func ParseBroadcastFilter(args string) (*BroadcastFilter, error) {
+	filter := &BroadcastFilter{Permission: types.CanChat}
+	for _, field := range strings.Fields(args) {
+		key, value, found := strings.Cut(field, "=")
+		if !found || value == "" {
+			return nil, fmt.Errorf("bad filter %q, expected key=value", field)
+		}
+		switch strings.ToLower(key) {
+		case "perm", "permission":
+			if strings.EqualFold(value, "any") {
+				filter.Permission = ""
+			} else if slices.Contains(types.KnownPermissions, value) {
+				filter.Permission = value
+			} else {
+				return nil, fmt.Errorf("unknown permission %q", value)
+			}
+		case "role":
+			filter.Role = strings.ToLower(value)
+		case "seen":
+			days, err := strconv.Atoi(value)
+			if err != nil || days <= 0 {
+				return nil, fmt.Errorf("bad number of days %q", value)
+			}
+			filter.SeenDays = days
+		default:
+			return nil, fmt.Errorf("unknown filter %q", key)
+		}
+	}
+	return filter, nil
+}
+
+// Matches reports whether the user passes the filter; role is the persona of the user's
+// private chat.
+func (f *BroadcastFilter) Matches(user *types.TgUser, role string, now time.Time) bool {
+	if f.Permission != "" && !user.HasPermission(f.Permission) {
+		return false
+	}
+	if f.Role != "" && f.Role != role {
+		return false
+	}
+	return f.SeenDays == 0 || user.SeenAt.After(now.AddDate(0, 0, -f.SeenDays))
+}
+
+// String describes the filter for the preview.
+func (f *BroadcastFilter) String() string {
+	text := "all users"
+	if f.Permission != "" {
+		text = "users with " + f.Permission
+	}
+	if f.Role != "" {
+		text += ", role " + f.Role
+	}
+	if f.SeenDays > 0 {
+		text += fmt.Sprintf(", seen within %d days", f.SeenDays)
+	}
+	return text
+}
+
+// BroadcastReport sums up the delivery of a broadcast.
+type BroadcastReport struct {
+	Total     int
+	Delivered int
+	Blocked   []string // Users who blocked the bot
+	Failed    []string // Users the message failed to reach for other reasons, with the error
+	Aborted   bool     // The bot stopped before the broadcast was done
+}
+
+// Add records the result of sending to the user.
+func (r *BroadcastReport) Add(user *types.TgUser, err error) {
+	switch {
+	case err == nil:
+		r.Delivered++
+	case errors.Is(err, ErrChatUnavailable) || errors.Is(err, bot.ErrorForbidden):
+		r.Blocked = append(r.Blocked, fmt.Sprintf("%s (%d)", user.Name, user.Id))
+	default:
+		r.Failed = append(r.Failed, fmt.Sprintf("%s (%d): %v", user.Name, user.Id, err))
+	}
+}
+
+// String renders the report for the master.
+func (r *BroadcastReport) String() string {
+	var sb strings.Builder
+	if r.Aborted {
+		fmt.Fprintf(&sb, "Broadcast stopped by the shutdown: %d of %d delivered.", r.Delivered, r.Total)
+	} else {
+		fmt.Fprintf(&sb, "Broadcast finished: %d of %d delivered.", r.Delivered, r.Total)
+	}
+	writeSection := func(title string, entries []string) {
+		if len(entries) == 0 {
+			return
+		}
+		fmt.Fprintf(&sb, "\n\n%s (%d):", title, len(entries))
+		for i, entry := range entries {
+			if i == maxReportEntries {
+				fmt.Fprintf(&sb, "\n… and %d more", len(entries)-i)
+				break
+			}
+			sb.WriteString("\n- " + entry)
+		}
+	}
+	writeSection("Blocked the bot", r.Blocked)
+	writeSection("Failed", r.Failed)
+	return sb.String()
+}
+
+// broadcastMessage is the message a broadcast copies or forwards to the recipients.
+type broadcastMessage struct {
+	chatID    int64
+	messageID int
+	forward   bool // The master forwarded the message, keep its origin
+}
+
+// broadcastMessageFrom reads the message collected by the dialog.
+func broadcastMessageFrom(dc *DialogContext) broadcastMessage {
+	chatID, _ := strconv.ParseInt(dc.Get(broadcastKeyChat), 10, 64)
+	messageID, _ := strconv.Atoi(dc.Get(broadcastKeyMessage))
+	return broadcastMessage{chatID: chatID, messageID: messageID, forward: dc.Get(broadcastKeyForward) != ""}
+}
+
+// CmdBroadcast handles the "/broadcast" command which sends a message to the users
+// matching the filters after a preview.
+func (tgBot *TgBot) CmdBroadcast(update *models.Update) {
+	if !tgBot.IsAllowed(update.Message.From.ID) {
+		tgBot.Reply(update, "You are not authorized to broadcast.")
+		tgBot.Notify(types.NotifySecurity, fmt.Sprintf("%s (%d) was refused /broadcast, only masters may broadcast.",
+			DisplayName(update.Message.From), update.Message.From.ID))
+		return
+	}
+	args := CommandArgs(update.Message.Text)
+	filter, err := ParseBroadcastFilter(args)
+	if err != nil {
+		tgBot.Reply(update, err.Error()+"\n\n"+broadcastUsage)
+		return
+	}
+	recipients, err := tgBot.broadcastRecipients(filter, update.Message.From.ID)
+	if err != nil {
+		tgBot.logger.Errorf("Failed to select broadcast recipients: %v", err)
+		tgBot.Reply(update, "Failed to select the recipients.")
+		return
+	}
+	if len(recipients) == 0 {
+		tgBot.Reply(update, "No users match: "+filter.String()+".\n\n"+broadcastUsage)
+		return
+	}
+	if err := tgBot.StartDialog(update, broadcastDialog, map[string]string{broadcastKeyFilter: args}); err != nil {
+		tgBot.logger.Errorf("Failed to start broadcast dialog: %v", err)
+		tgBot.Reply(update, "Failed to start the dialog.")
+		return
+	}
+	tgBot.Reply(update, fmt.Sprintf("%d users match: %s.\nSend the message to broadcast: text, a photo or a message forwarded from anywhere. Use /cancel to stop.",
+		len(recipients), filter))
+}
+
+// broadcastRecipients returns the users matching the filter, except the sender.
+func (tgBot *TgBot) broadcastRecipients(filter *BroadcastFilter, senderID int64) ([]*types.TgUser, error) {
+	users, err := tgBot.storage.GetAllTgUsers()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	var recipients []*types.TgUser
+	for _, user := range users {
+		if user.Id == senderID {
+			continue
+		}
+		var role string
+		if filter.Role != "" {
+			persona, err := tgBot.storage.GetChatPersona(user.Id)
+			if err != nil {
+				return nil, err
+			}
+			if persona != nil {
+				role = persona.Name
+			}
+		}
+		if filter.Matches(user, role, now) {
+			recipients = append(recipients, user)
+		}
+	}
+	return recipients, nil
+}
+
+// broadcastDialogSteps are the steps of the "/broadcast" dialog.
+func (tgBot *TgBot) broadcastDialogSteps() map[string]DialogStep {
+	return map[string]DialogStep{
+		broadcastStepContent: func(dc *DialogContext) {
+			msg := dc.Update.Message
+			if msg == nil {
+				dc.Say("Please send the message to broadcast.", nil)
+				return
+			}
+			dc.Set(broadcastKeyChat, strconv.FormatInt(msg.Chat.ID, 10))
+			dc.Set(broadcastKeyMessage, strconv.Itoa(msg.ID))
+			if msg.ForwardOrigin != nil {
+				dc.Set(broadcastKeyForward, "1")
+			}
+			// The preview is exactly what the recipients get
+			if err := tgBot.sendBroadcast(dc.Dialog.ChatId, broadcastMessageFrom(dc)); err != nil {
+				dc.Say("Cannot broadcast this message: "+err.Error(), nil)
+				return
+			}
+			keyboard, err := tgBot.DialogKeyboard(broadcastDialog,
+				DialogChoice{Text: "📣 Send", Value: broadcastChoiceSend},
+				DialogChoice{Text: "❌ Cancel", Value: broadcastChoiceCancel})
+			if err != nil {
+				tgBot.logger.Errorf("Failed to create keyboard: %v", err)
+				return
+			}
+			dc.Say("This is the preview. Send it?", keyboard)
+			dc.Next(broadcastStepConfirm)
+		},
+		broadcastStepConfirm: func(dc *DialogContext) {
+			switch dc.Button {
+			case broadcastChoiceSend:
+				// Users may have changed since the preview, select them again
+				filter, err := ParseBroadcastFilter(dc.Get(broadcastKeyFilter))
+				var recipients []*types.TgUser
+				if err == nil {
+					recipients, err = tgBot.broadcastRecipients(filter, dc.Dialog.UserId)
+				}
+				if err != nil {
+					tgBot.logger.Errorf("Failed to select broadcast recipients: %v", err)
+					dc.Say("Failed to select the recipients.", nil)
+				} else {
+					dc.Say(fmt.Sprintf("Sending to %d users, I will report when done.", len(recipients)), nil)
+					reportTo, m := dc.Dialog.ChatId, broadcastMessageFrom(dc)
+					tgBot.wgWorkers.Add(1)
+					go func() {
+						defer tgBot.wgWorkers.Done()
+						tgBot.runBroadcast(reportTo, m, recipients)
+					}()
+				}
+				dc.Finish()
+			case broadcastChoiceCancel:
+				dc.Say("Cancelled.", nil)
+				dc.Finish()
+			default:
+				dc.Say("Please press Send or Cancel.", nil)
+			}
+		},
+	}
+}
+
+// sendBroadcast delivers the broadcast message to a chat.
+func (tgBot *TgBot) sendBroadcast(chatID int64, m broadcastMessage) error {
+	if m.forward {
+		_, err := tgBot.ForwardMessage(&bot.ForwardMessageParams{ChatID: chatID, FromChatID: m.chatID, MessageID: m.messageID})
+		return err
+	}
+	_, err := tgBot.CopyMessage(&bot.CopyMessageParams{ChatID: chatID, FromChatID: m.chatID, MessageID: m.messageID})
+	return err
+}
+
+// runBroadcast sends the message to the recipients at GOURBOT_BROADCAST_RATE messages per
+// second and reports the result to the chat the broadcast was started in. A broadcast
+// aborted by the bot stopping is only logged, as nothing can be sent anymore.
+func (tgBot *TgBot) runBroadcast(reportTo int64, m broadcastMessage, recipients []*types.TgUser) {
+	ticker := time.NewTicker(time.Second / time.Duration(max(tgBot.config().BroadcastRate, 1)))
+	defer ticker.Stop()
+	report := &BroadcastReport{Total: len(recipients)}
+send:
+	for _, user := range recipients {
+		select {
+		case <-tgBot.context.Done():
+			report.Aborted = true
+			break send
+		case <-ticker.C:
+		}
+		err := tgBot.sendBroadcast(user.Id, m)
+		var tooMany *bot.TooManyRequestsError
+		if errors.As(err, &tooMany) {
+			// Telegram asks to slow down, wait and try the user once more
+			select {
+			case <-tgBot.context.Done():
+				report.Aborted = true // The user was not tried again, which is no failure
+				break send
+			case <-time.After(time.Duration(tooMany.RetryAfter) * time.Second):
+				err = tgBot.sendBroadcast(user.Id, m)
+			}
+		}
+		report.Add(user, err)
+	}
+
+	if report.Aborted {
+		tgBot.logger.Warn(report.String())
+		return
+	}
+	tgBot.logger.Infof("Broadcast done: %d of %d delivered, %d blocked, %d failed",
+		report.Delivered, report.Total, len(report.Blocked), len(report.Failed))
+	for _, chunk := range SplitMessage(report.String(), maxMessageLength) {
+		tgBot.SendMessage(&bot.SendMessageParams{ChatID: reportTo, Text: chunk})
+	}
+}
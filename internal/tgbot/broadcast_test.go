@@ -0,0 +1,101 @@
+package tgbot
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"gourbot/internal/types"
+
+	"github.com/go-telegram/bot"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseBroadcastFilter(t *testing.T) {
+	filter, err := ParseBroadcastFilter("")
+	assert.NoError(t, err)
+	assert.Equal(t, &BroadcastFilter{Permission: types.CanChat}, filter)
+	assert.Equal(t, "users with CanChat", filter.String())
+
+	filter, err = ParseBroadcastFilter("perm=CanDraw role=Writer seen=30")
+	assert.NoError(t, err)
+	assert.Equal(t, &BroadcastFilter{Permission: types.CanDraw, Role: "writer", SeenDays: 30}, filter)
+	assert.Equal(t, "users with CanDraw, role writer, seen within 30 days", filter.String())
+
+	filter, err = ParseBroadcastFilter("perm=any")
+	assert.NoError(t, err)
+	assert.Equal(t, "all users", filter.String())
+
+	for _, args := range []string{"CanChat", "perm=CanFly", "seen=0", "seen=week", "role=", "lang=en"} {
+		_, err := ParseBroadcastFilter(args)
+		assert.Error(t, err, args)
+	}
+}
+
+func TestBroadcastFilterMatches(t *testing.T) {
+	now := time.Now()
+	user := types.NewTgUser(1, "alice", nil)
+	user.AddPermission(types.CanChat)
+	user.SeenAt = now.AddDate(0, 0, -10)
+
+	assert.True(t, (&BroadcastFilter{Permission: types.CanChat}).Matches(user, "", now))
+	assert.False(t, (&BroadcastFilter{Permission: types.CanDraw}).Matches(user, "", now))
+	assert.True(t, (&BroadcastFilter{}).Matches(types.NewTgUser(2, "bob", nil), "", now))
+	assert.True(t, (&BroadcastFilter{Role: "writer"}).Matches(user, "writer", now))
+	assert.False(t, (&BroadcastFilter{Role: "writer"}).Matches(user, "", now))
+	assert.True(t, (&BroadcastFilter{SeenDays: 30}).Matches(user, "", now))
+	assert.False(t, (&BroadcastFilter{SeenDays: 7}).Matches(user, "", now))
+
+	master := types.NewTgUser(3, "master", nil)
+	master.AddPermission(types.CanEverything)
+	assert.True(t, (&BroadcastFilter{Permission: types.CanDraw}).Matches(master, "", now))
+}
+
+func TestBroadcastReport(t *testing.T) {
+	report := &BroadcastReport{Total: 4}
+	report.Add(types.NewTgUser(1, "alice", nil), nil)
+	report.Add(types.NewTgUser(2, "bob", nil), ErrChatUnavailable)
+	report.Add(types.NewTgUser(3, "carol", nil), fmt.Errorf("error call SendMessage, %w, bot was blocked by the user", bot.ErrorForbidden))
+	report.Add(types.NewTgUser(4, "dave", nil), fmt.Errorf("chat not found"))
+
+	assert.Equal(t, 1, report.Delivered)
+	assert.Equal(t, "Broadcast finished: 1 of 4 delivered.\n\n"+
+		"Blocked the bot (2):\n- bob (2)\n- carol (3)\n\n"+
+		"Failed (1):\n- dave (4): chat not found", report.String())
+
+	report = &BroadcastReport{Total: maxReportEntries + 2, Aborted: true}
+	for i := 0; i < maxReportEntries+2; i++ {
+		report.Add(types.NewTgUser(int64(i), "u", nil), ErrChatUnavailable)
+	}
+	assert.Contains(t, report.String(), "Broadcast stopped by the shutdown: 0 of 52 delivered.")
+	assert.Contains(t, report.String(), "\n… and 2 more")
+}
+
+func TestRunBroadcast_StopDuringRetry(t *testing.T) {
+	tgBot, api := newTestBot(t)
+	var log bytes.Buffer
+	tgBot.logger.SetOutput(&log)
+	api.throttle("copyMessage", 60)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		recipients := []*types.TgUser{types.NewTgUser(42, "user42", nil), types.NewTgUser(43, "user43", nil)}
+		tgBot.runBroadcast(1, broadcastMessage{chatID: 1, messageID: 5}, recipients)
+	}()
+	for len(api.sent("copyMessage")) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	tgBot.cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the broadcast did not stop")
+	}
+
+	assert.Len(t, api.sent("copyMessage"), 1, "the throttled user is not tried again")
+	assert.Contains(t, log.String(), "Broadcast stopped by the shutdown")
+	assert.NotContains(t, log.String(), "Failed", "a user waiting for the retry did not fail")
+	assert.Empty(t, api.sent("sendMessage"), "an aborted broadcast is only logged")
+}
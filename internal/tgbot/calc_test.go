@@ -0,0 +1,42 @@
+package tgbot
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCalculate(t *testing.T) {
+	tests := []struct {
+		expr string
+		want float64
+	}{
+		{"2+2", 4},
+		{"2 + 3 * 4", 14},
+		{"(2 + 3) * 4", 20},
+		{"10 / 4", 2.5},
+		{"10 % 4", 2},
+		{"-3 + 5", 2},
+		{"2^3^2", 512},
+		{"-2^2", -4},
+		{"1e3 + 1_000", 2000},
+		{"sqrt(16) + abs(-2)", 6},
+		{"round(pi * 100) / 100", 3.14},
+		{"2 * -(1 + 1)", -4},
+	}
+	for _, tt := range tests {
+		got, err := Calculate(tt.expr)
+		if assert.NoError(t, err, tt.expr) {
+			assert.InDelta(t, tt.want, got, 1e-9, tt.expr)
+		}
+	}
+
+	got, err := Calculate("ln(e)")
+	assert.NoError(t, err)
+	assert.InDelta(t, 1, got, 1e-9)
+
+	for _, expr := range []string{"", "2 +", "(1 + 2", "1 / 0", "foo(1)", "sqrt 4", "2 $ 3", "1 2", "sqrt(-1)"} {
+		_, err := Calculate(expr)
+		assert.Error(t, err, expr)
+	}
+}
@@ -0,0 +1,207 @@
+package tgbot
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gourbot/internal/types"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+const (
+	// maxCallbackData is the Telegram limit for the callback data of a button in bytes.
+	maxCallbackData = 64
+	// callbackSep separates the route, the arguments and the signature in callback data.
+	callbackSep = "|"
+	// callbackSigBytes is the number of HMAC bytes kept in the signature, 8 base64 characters.
+	callbackSigBytes = 6
+)
+
+// Routes of the inline keyboard callbacks.
+const (
+	callbackNoop           = "noop" // Buttons which only show information, like the page counter
+	callbackChats          = "chats"
+	callbackSummaryClear   = "sumclr"
+	callbackDialog         = "dlg"
+	callbackReminders      = "rems"
+	callbackReminderCancel = "remdel"
+)
+
+var (
+	ErrCallbackTooLong   = errors.New("callback data exceeds 64 bytes")
+	ErrCallbackSignature = errors.New("bad callback signature")
+)
+
+// CallbackCodec encodes button callback data as "route|arg|...|signature". The truncated
+// HMAC signature keeps users from crafting callback data for buttons they never got.
+type CallbackCodec struct {
+	key []byte
+}
+
+// NewCallbackCodec creates a codec signing with a key derived from the secret.
+func NewCallbackCodec(secret string) *CallbackCodec {
+	key := sha256.Sum256([]byte("gourbot callbacks:" + secret))
+	return &CallbackCodec{key: key[:]}
+}
+
+// Encode builds signed callback data for the route and its arguments.
+func (c *CallbackCodec) Encode(route string, args ...string) (string, error) {
+	if route == "" || strings.Contains(route, callbackSep) {
+		return "", fmt.Errorf("bad callback route %q", route)
+	}
+	for _, arg := range args {
+		if strings.Contains(arg, callbackSep) {
+			return "", fmt.Errorf("callback argument %q contains %q", arg, callbackSep)
+		}
+	}
+	payload := strings.Join(append([]string{route}, args...), callbackSep)
+	data := payload + callbackSep + c.sign(payload)
+	if len(data) > maxCallbackData {
+		return "", ErrCallbackTooLong
+	}
+	return data, nil
+}
+
+// Decode checks the signature of callback data and returns its route and arguments.
+func (c *CallbackCodec) Decode(data string) (string, []string, error) {
+	i := strings.LastIndex(data, callbackSep)
+	if i <= 0 {
+		return "", nil, ErrCallbackSignature
+	}
+	payload, sig := data[:i], data[i+1:]
+	if !hmac.Equal([]byte(sig), []byte(c.sign(payload))) {
+		return "", nil, ErrCallbackSignature
+	}
+	parts := strings.Split(payload, callbackSep)
+	return parts[0], parts[1:], nil
+}
+
+func (c *CallbackCodec) sign(payload string) string {
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:callbackSigBytes])
+}
+
+// Callback is a pressed inline keyboard button routed to its handler.
+type Callback struct {
+	Update  *models.Update
+	Query   *models.CallbackQuery
+	Message *models.Message // The message with the keyboard, nil if it is too old to be accessible
+	User    *types.TgUser
+	Route   string
+	Args    []string
+	answer  string
+	alert   bool
+}
+
+// Answer sets the notification shown to the user once the handler returns.
+func (cb *Callback) Answer(text string) {
+	cb.answer, cb.alert = text, false
+}
+
+// Alert sets the text of an alert shown to the user once the handler returns.
+func (cb *Callback) Alert(text string) {
+	cb.answer, cb.alert = text, true
+}
+
+// Arg returns the i-th argument or an empty string if there is none.
+func (cb *Callback) Arg(i int) string {
+	if i < len(cb.Args) {
+		return cb.Args[i]
+	}
+	return ""
+}
+
+// callbackRoute is a registered callback handler.
+type callbackRoute struct {
+	permission string
+	handler    func(cb *Callback)
+}
+
+// isCallbackQuery matches updates with a pressed inline keyboard button.
+func isCallbackQuery(update *models.Update) bool {
+	return update.CallbackQuery != nil
+}
+
+// RegisterCallback routes the buttons created for the route to the handler. Only users
+// having the permission, themselves or through the chat, may press them; an empty
+// permission means CanChat.
+func (tgBot *TgBot) RegisterCallback(route, permission string, handler func(cb *Callback)) {
+	if _, exists := tgBot.callbacks[route]; exists {
+		return // Route already registered
+	}
+	if permission == "" {
+		permission = types.CanChat
+	}
+	tgBot.callbacks[route] = &callbackRoute{permission: permission, handler: handler}
+}
+
+// CallbackHandler checks and routes a callback query. The query is always answered,
+// with the text the handler set, so the client stops showing the progress indicator.
+func (tgBot *TgBot) CallbackHandler(update *models.Update) {
+	query := update.CallbackQuery
+	cb := &Callback{Update: update, Query: query, Message: query.Message.Message}
+	defer func() {
+		tgBot.AnswerCallbackQuery(query.ID, cb.answer, cb.alert)
+	}()
+
+	var err error
+	cb.Route, cb.Args, err = tgBot.callbackCodec.Decode(query.Data)
+	route := tgBot.callbacks[cb.Route]
+	if err != nil || route == nil {
+		tgBot.logger.Warnf("Bad callback data %q from user %d: %v", query.Data, query.From.ID, err)
+		cb.Alert("This button is no longer valid.")
+		return
+	}
+
+	if cb.User, err = tgBot.storage.GetTgUser(query.From.ID); err != nil {
+		tgBot.logger.Errorf("Failed to retrieve user %d: %v", query.From.ID, err)
+		cb.Alert("You are not allowed to do this.")
+		return
+	}
+	var chat *types.TgChat
+	if cb.Message != nil {
+		chat = tgBot.ChatByID(cb.Message.Chat.ID)
+	}
+	if !types.HasAccess(cb.User, chat, route.permission) {
+		cb.Alert("You are not allowed to do this (" + route.permission + " is required).")
+		return
+	}
+	route.handler(cb)
+}
+
+// AnswerCallbackQuery answers a callback query, optionally showing a notification or an alert.
+func (tgBot *TgBot) AnswerCallbackQuery(queryID, text string, alert bool) {
+	_, err := tgBot.bot.AnswerCallbackQuery(tgBot.context, &bot.AnswerCallbackQueryParams{
+		CallbackQueryID: queryID,
+		Text:            text,
+		ShowAlert:       alert,
+	})
+	if err != nil {
+		tgBot.logger.Warnf("AnswerCallbackQuery failed: %v", err)
+	}
+}
+
+// EditCallbackMessage replaces the text and the keyboard of the message with the pressed
+// button. A nil keyboard removes it.
+func (tgBot *TgBot) EditCallbackMessage(cb *Callback, text string, keyboard *models.InlineKeyboardMarkup) error {
+	if cb.Message == nil {
+		return errors.New("the message is not accessible anymore")
+	}
+	params := &bot.EditMessageTextParams{
+		ChatID:    cb.Message.Chat.ID,
+		MessageID: cb.Message.ID,
+		Text:      text,
+	}
+	if keyboard != nil {
+		params.ReplyMarkup = keyboard
+	}
+	_, err := tgBot.EditMessageText(params)
+	return err
+}
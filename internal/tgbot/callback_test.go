@@ -0,0 +1,95 @@
+package tgbot
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCallbackCodec(t *testing.T) {
+	codec := NewCallbackCodec("token")
+
+	data, err := codec.Encode("chats", "2", "x")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(data, "chats|2|x|"))
+	assert.LessOrEqual(t, len(data), maxCallbackData)
+
+	route, args, err := codec.Decode(data)
+	assert.NoError(t, err)
+	assert.Equal(t, "chats", route)
+	assert.Equal(t, []string{"2", "x"}, args)
+
+	data, err = codec.Encode("noop")
+	assert.NoError(t, err)
+	route, args, err = codec.Decode(data)
+	assert.NoError(t, err)
+	assert.Equal(t, "noop", route)
+	assert.Empty(t, args)
+
+	// Tampered, foreign and malformed data are rejected
+	data, _ = codec.Encode("chats", "2")
+	_, _, err = codec.Decode(strings.Replace(data, "|2|", "|3|", 1))
+	assert.ErrorIs(t, err, ErrCallbackSignature)
+	_, _, err = NewCallbackCodec("other").Decode(data)
+	assert.ErrorIs(t, err, ErrCallbackSignature)
+	_, _, err = codec.Decode("chats")
+	assert.ErrorIs(t, err, ErrCallbackSignature)
+
+	_, err = codec.Encode("chats", strings.Repeat("a", 60))
+	assert.ErrorIs(t, err, ErrCallbackTooLong)
+	_, err = codec.Encode("chats", "a|b")
+	assert.Error(t, err)
+	_, err = codec.Encode("")
+	assert.Error(t, err)
+}
+
+func TestConfirmKeyboard(t *testing.T) {
+	codec := NewCallbackCodec("token")
+	keyboard, err := codec.ConfirmKeyboard("sumclr", "42")
+	assert.NoError(t, err)
+	assert.Len(t, keyboard.InlineKeyboard, 1)
+	assert.Len(t, keyboard.InlineKeyboard[0], 2)
+
+	for i, confirmed := range []bool{true, false} {
+		route, args, err := codec.Decode(keyboard.InlineKeyboard[0][i].CallbackData)
+		assert.NoError(t, err)
+		cb := &Callback{Route: route, Args: args}
+		assert.Equal(t, "sumclr", cb.Route)
+		assert.Equal(t, confirmed, cb.Confirmed())
+		assert.Equal(t, "42", cb.Arg(1))
+	}
+}
+
+func TestPageKeyboard(t *testing.T) {
+	codec := NewCallbackCodec("token")
+
+	keyboard, err := codec.PageKeyboard("chats", 0, 1)
+	assert.NoError(t, err)
+	assert.Nil(t, keyboard, "a single page needs no keyboard")
+
+	keyboard, err = codec.PageKeyboard("chats", 0, 3)
+	assert.NoError(t, err)
+	row := keyboard.InlineKeyboard[0]
+	assert.Equal(t, []string{"1/3", "Next »"}, []string{row[0].Text, row[1].Text})
+	route, args, _ := codec.Decode(row[1].CallbackData)
+	assert.Equal(t, "chats", route)
+	assert.Equal(t, 1, (&Callback{Args: args}).Page())
+
+	keyboard, _ = codec.PageKeyboard("chats", 1, 3)
+	assert.Len(t, keyboard.InlineKeyboard[0], 3)
+	keyboard, _ = codec.PageKeyboard("chats", 2, 3)
+	row = keyboard.InlineKeyboard[0]
+	assert.Equal(t, []string{"« Prev", "3/3"}, []string{row[0].Text, row[1].Text})
+}
+
+func TestPaginate(t *testing.T) {
+	start, end, page, pages := Paginate(45, 1, 20)
+	assert.Equal(t, []int{20, 40, 1, 3}, []int{start, end, page, pages})
+
+	start, end, page, pages = Paginate(45, 7, 20)
+	assert.Equal(t, []int{40, 45, 2, 3}, []int{start, end, page, pages}, "the page is clamped")
+
+	start, end, page, pages = Paginate(0, 0, 20)
+	assert.Equal(t, []int{0, 0, 0, 1}, []int{start, end, page, pages})
+}
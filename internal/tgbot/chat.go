@@ -0,0 +1,68 @@
+package tgbot
+
+import (
+	"context"
+	"errors"
+
+	"gourbot/internal/llm"
+	"gourbot/internal/types"
+
+	"github.com/go-telegram/bot/models"
+)
+
+// ChatHandler answers a text message with the LLM, streaming the answer into a reply.
+// Mentions of the bot, which address it in groups, are not a part of the question.
+func (tgBot *TgBot) ChatHandler(update *models.Update) {
+	text := update.Message.Text
+	if IsGroupChat(&update.Message.Chat) {
+		text = StripMention(text, tgBot.me.Username)
+	}
+	if text == "" {
+		tgBot.Reply(update, "Yes?")
+		return
+	}
+	tgBot.Answer(update, text)
+}
+
+// Answer asks the LLM about text in the context of the chat's conversation and streams
+// the answer into a reply to the update's message. The model may call the tools the user has permissions for while answering.
+// Like inline answers, the answer is charged to the user's quota, and refused once it is exhausted.
+// It returns the complete answer once the stream is finished.
+func (tgBot *TgBot) Answer(update *models.Update, text string) (string, error) {
+	chatID := update.Message.Chat.ID
+	userID := update.Message.From.ID
+	user, err := tgBot.storage.GetTgUser(userID)
+	if err != nil {
+		tgBot.logger.Errorf("Failed to retrieve user: %v", err)
+		user = types.NewTgUser(userID, "", nil) // Without permissions no tools are offered but the chat's
+	}
+	if ok, message := tgBot.CheckQuota(user); !ok {
+		tgBot.Reply(update, message)
+		return "", errors.New(message)
+	}
+
+	stopTyping := tgBot.KeepChatAction(chatID, models.ChatActionTyping)
+	defer stopTyping()
+
+	reply, err := tgBot.NewStreamReply(update)
+	if err != nil {
+		tgBot.logger.Errorf("Failed to send placeholder reply: %v", err)
+		return "", err
+	}
+
+	conv := tgBot.ConversationOf(update.Message)
+	req := tgBot.ChatRequest(chatID, userID, tgBot.ConversationMessages(conv, text))
+	msg, err := tgBot.RunTools(user, chatID, req, func(ctx context.Context, req *llm.ChatRequest) (*llm.Message, error) {
+		return tgBot.registry().ChatStream(ctx, req, reply.Write)
+	})
+	stopTyping()
+	reply.Finish(err)
+	if msg == nil {
+		return "", err
+	}
+	tgBot.ChargeChat(userID, req, msg.Content)
+	if err == nil && msg.Content != "" {
+		tgBot.Remember(conv, userID, text, msg.Content)
+	}
+	return msg.Content, err
+}
@@ -0,0 +1,33 @@
+package tgbot
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"gourbot/internal/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnswer_Quota(t *testing.T) {
+	tgBot, api := newTestBot(t)
+	tgBot.config().UserDailyQuota = 1
+	addTestUser(t, tgBot, 42, types.CanChat)
+
+	answer, err := tgBot.Answer(privateMessage(42, "The answer?"), "The answer?")
+	assert.NoError(t, err)
+	assert.Equal(t, testAnswer, answer)
+	assert.Equal(t, testAnswer, lastText(api))
+	spent, err := tgBot.storage.GetUserCostSince(42, time.Now().Add(-time.Hour))
+	assert.NoError(t, err)
+	assert.Greater(t, spent, 0.0, "chat answers are charged")
+	tgBot.wgWorkers.Wait() // The history may be summarized in the background
+	completions := len(api.sent("completions"))
+
+	assert.NoError(t, tgBot.storage.AddUsage(types.NewUsage(42, types.UsageImage, "dall-e-3", 1)))
+	_, err = tgBot.Answer(privateMessage(42, "Again?"), "Again?")
+	assert.Error(t, err)
+	assert.True(t, strings.HasPrefix(lastText(api), "Daily quota exceeded"), lastText(api))
+	assert.Len(t, api.sent("completions"), completions, "an exhausted quota is not spent further")
+}
@@ -0,0 +1,240 @@
+package tgbot
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gourbot/internal/types"
+
+	"github.com/go-telegram/bot/models"
+)
+
+const (
+	chatApproveUsage = "Usage: /chat_approve <chat ID> [permission ...]; CanChat is granted by default"
+	chatRevokeUsage  = "Usage: /chat_revoke <chat ID> [permission ...]; all permissions are revoked by default"
+)
+
+// GetChatFromUpdate extracts the chat an update belongs to, or returns nil if it has none.
+func GetChatFromUpdate(update *models.Update) *models.Chat {
+	switch {
+	case update.Message != nil:
+		return &update.Message.Chat
+	case update.EditedMessage != nil:
+		return &update.EditedMessage.Chat
+	case update.ChannelPost != nil:
+		return &update.ChannelPost.Chat
+	case update.EditedChannelPost != nil:
+		return &update.EditedChannelPost.Chat
+	case update.MyChatMember != nil:
+		return &update.MyChatMember.Chat
+	case update.ChatMember != nil:
+		return &update.ChatMember.Chat
+	case update.ChatJoinRequest != nil:
+		return &update.ChatJoinRequest.Chat
+	case update.CallbackQuery != nil && update.CallbackQuery.Message.Message != nil:
+		return &update.CallbackQuery.Message.Message.Chat
+	case update.CallbackQuery != nil && update.CallbackQuery.Message.InaccessibleMessage != nil:
+		return &update.CallbackQuery.Message.InaccessibleMessage.Chat
+	}
+	return nil
+}
+
+// ChatTitle returns the title of a group or the name of a private chat.
+func ChatTitle(chat *models.Chat) string {
+	switch {
+	case chat.Title != "":
+		return chat.Title
+	case chat.Username != "":
+		return chat.Username
+	}
+	return strings.TrimSpace(chat.FirstName + " " + chat.LastName)
+}
+
+// TrackChat registers the chat of the update in the tgchats table or refreshes it.
+// The master is notified about new groups, which need approval. It returns the stored
+// chat, or nil if the update has no chat or the storage failed.
+func (tgBot *TgBot) TrackChat(update *models.Update) *types.TgChat {
+	tc := GetChatFromUpdate(update)
+	if tc == nil {
+		return nil
+	}
+	chat, created, err := tgBot.trackChat(tc)
+	if err != nil {
+		tgBot.logger.Errorf("Failed to track chat %d: %v", tc.ID, err)
+		return nil
+	}
+	if created && tc.Type != models.ChatTypePrivate {
+		tgBot.Notify(types.NotifyNewUser, fmt.Sprintf("New chat detected: %s (%s), ID: %d. To approve, use /chat_approve %d",
+			chat.Title, chat.Type, chat.Id, chat.Id))
+	}
+	return chat
+}
+
+// trackChat adds the chat to the tgchats table or refreshes its type, title and last seen
+// time. It reports whether the chat was added.
+func (tgBot *TgBot) trackChat(tc *models.Chat) (*types.TgChat, bool, error) {
+	chat, err := tgBot.storage.GetTgChat(tc.ID)
+	if err == sql.ErrNoRows {
+		chat = types.NewTgChat(tc.ID, string(tc.Type), ChatTitle(tc))
+		return chat, true, tgBot.storage.AddTgChat(chat)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	chat.Type = string(tc.Type)
+	chat.Title = ChatTitle(tc)
+	chat.SeenAt = time.Now()
+	return chat, false, tgBot.storage.TouchTgChat(chat)
+}
+
+// ChatByID returns the stored chat or nil if it is unknown.
+func (tgBot *TgBot) ChatByID(chatID int64) *types.TgChat {
+	chat, err := tgBot.storage.GetTgChat(chatID)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			tgBot.logger.Errorf("Failed to retrieve chat %d: %v", chatID, err)
+		}
+		return nil
+	}
+	return chat
+}
+
+// ParseChatPermissionArgs parses "<chat ID> [permission ...]" arguments of the chat commands.
+func ParseChatPermissionArgs(args string) (int64, []string, error) {
+	return parsePermissionArgs(args, "chat")
+}
+
+// parsePermissionArgs parses "<ID> [permission ...]" arguments; what names the ID in errors.
+func parsePermissionArgs(args, what string) (int64, []string, error) {
+	fields := strings.Fields(args)
+	if len(fields) == 0 {
+		return 0, nil, fmt.Errorf("%s ID is missing", what)
+	}
+	chatID, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return 0, nil, fmt.Errorf("bad %s ID %q", what, fields[0])
+	}
+	var permissions []string
+	for _, field := range fields[1:] {
+		known := false
+		for _, permission := range types.KnownPermissions {
+			if strings.EqualFold(field, permission) {
+				permissions = append(permissions, permission)
+				known = true
+				break
+			}
+		}
+		if !known {
+			return 0, nil, fmt.Errorf("unknown permission %q", field)
+		}
+	}
+	return chatID, permissions, nil
+}
+
+// chatsPerPage is the number of chats listed on a page of /chats.
+const chatsPerPage = 20
+
+// CmdChats handles the "/chats" command which lists the known groups and channels page by page.
+func (tgBot *TgBot) CmdChats(update *models.Update) {
+	if tgBot.UserWithPermission(update, types.CanManageUsers) == nil {
+		return
+	}
+	text, keyboard, err := tgBot.chatsPage(0)
+	if err != nil {
+		tgBot.logger.Errorf("Failed to get chats: %v", err)
+		tgBot.Reply(update, "Failed to get chats.")
+		return
+	}
+	tgBot.ReplyWithKeyboard(update, text, keyboard)
+}
+
+// CallbackChats shows another page of the /chats list.
+func (tgBot *TgBot) CallbackChats(cb *Callback) {
+	text, keyboard, err := tgBot.chatsPage(cb.Page())
+	if err == nil {
+		err = tgBot.EditCallbackMessage(cb, text, keyboard)
+	}
+	if err != nil {
+		tgBot.logger.Errorf("Failed to show chats: %v", err)
+		cb.Alert("Failed to get chats.")
+	}
+}
+
+// chatsPage renders a page of the known groups and channels with its navigation keyboard.
+func (tgBot *TgBot) chatsPage(page int) (string, *models.InlineKeyboardMarkup, error) {
+	chats, err := tgBot.storage.GetAllTgChats()
+	if err != nil {
+		return "", nil, err
+	}
+	var groups []*types.TgChat
+	for _, chat := range chats {
+		if chat.Type != string(models.ChatTypePrivate) {
+			groups = append(groups, chat)
+		}
+	}
+	if len(groups) == 0 {
+		return "No group chats yet.", nil, nil
+	}
+	start, end, page, pages := Paginate(len(groups), page, chatsPerPage)
+	var sb strings.Builder
+	for _, chat := range groups[start:end] {
+		fmt.Fprintf(&sb, "%d %s (%s): [%s], seen %s\n", chat.Id, chat.Title, chat.Type,
+			chat.PermissionsToString(), chat.SeenAt.Format("2006-01-02 15:04"))
+	}
+	keyboard, err := tgBot.callbackCodec.PageKeyboard(callbackChats, page, pages)
+	return sb.String(), keyboard, err
+}
+
+// CmdChatApprove handles the "/chat_approve" command which grants permissions to everybody in a chat.
+func (tgBot *TgBot) CmdChatApprove(update *models.Update) {
+	tgBot.changeChatPermissions(update, chatApproveUsage, func(chat *types.TgChat, permissions []string) {
+		if len(permissions) == 0 {
+			permissions = []string{types.CanChat}
+		}
+		for _, permission := range permissions {
+			chat.AddPermission(permission)
+		}
+	})
+}
+
+// CmdChatRevoke handles the "/chat_revoke" command which takes permissions of a chat away.
+func (tgBot *TgBot) CmdChatRevoke(update *models.Update) {
+	tgBot.changeChatPermissions(update, chatRevokeUsage, func(chat *types.TgChat, permissions []string) {
+		if len(permissions) == 0 {
+			chat.ClearPermissions()
+		}
+		for _, permission := range permissions {
+			chat.RemovePermission(permission)
+		}
+	})
+}
+
+// changeChatPermissions implements the master commands which change chat permissions.
+func (tgBot *TgBot) changeChatPermissions(update *models.Update, usage string, change func(chat *types.TgChat, permissions []string)) {
+	if tgBot.UserWithPermission(update, types.CanManageUsers) == nil {
+		return
+	}
+	chatID, permissions, err := ParseChatPermissionArgs(CommandArgs(update.Message.Text))
+	if err != nil {
+		tgBot.Reply(update, err.Error()+"\n"+usage)
+		return
+	}
+	chat, err := tgBot.storage.GetTgChat(chatID)
+	if err == sql.ErrNoRows {
+		tgBot.Reply(update, fmt.Sprintf("Unknown chat %d. Use /chats to list the known ones.", chatID))
+		return
+	}
+	if err == nil {
+		change(chat, permissions)
+		err = tgBot.storage.UpdateTgChat(chat)
+	}
+	if err != nil {
+		tgBot.logger.Errorf("Failed to change permissions of chat %d: %v", chatID, err)
+		tgBot.Reply(update, "Failed to change the chat permissions.")
+		return
+	}
+	tgBot.Reply(update, fmt.Sprintf("Chat %s now has permissions [%s].", chat.Title, chat.PermissionsToString()))
+}
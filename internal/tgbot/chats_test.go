@@ -0,0 +1,48 @@
+package tgbot
+
+import (
+	"testing"
+
+	"gourbot/internal/types"
+
+	"github.com/go-telegram/bot/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseChatPermissionArgs(t *testing.T) {
+	chatID, permissions, err := ParseChatPermissionArgs("-1001234")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(-1001234), chatID)
+	assert.Empty(t, permissions)
+
+	chatID, permissions, err = ParseChatPermissionArgs("-42 canchat CanDraw")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(-42), chatID)
+	assert.Equal(t, []string{types.CanChat, types.CanDraw}, permissions, "permission names are case-insensitive")
+
+	_, _, err = ParseChatPermissionArgs("")
+	assert.Error(t, err)
+	_, _, err = ParseChatPermissionArgs("family")
+	assert.Error(t, err)
+	_, _, err = ParseChatPermissionArgs("-42 CanFly")
+	assert.Error(t, err)
+}
+
+func TestChatTitle(t *testing.T) {
+	assert.Equal(t, "Family", ChatTitle(&models.Chat{Title: "Family", Username: "family"}))
+	assert.Equal(t, "john", ChatTitle(&models.Chat{Username: "john", FirstName: "John"}))
+	assert.Equal(t, "John Doe", ChatTitle(&models.Chat{FirstName: "John", LastName: "Doe"}))
+	assert.Equal(t, "John", ChatTitle(&models.Chat{FirstName: "John"}))
+}
+
+func TestGetChatFromUpdate(t *testing.T) {
+	assert.Nil(t, GetChatFromUpdate(&models.Update{}))
+	chat := GetChatFromUpdate(&models.Update{Message: &models.Message{Chat: models.Chat{ID: 5}}})
+	if assert.NotNil(t, chat) {
+		assert.Equal(t, int64(5), chat.ID)
+	}
+	chat = GetChatFromUpdate(&models.Update{MyChatMember: &models.ChatMemberUpdated{Chat: models.Chat{ID: -7}}})
+	if assert.NotNil(t, chat) {
+		assert.Equal(t, int64(-7), chat.ID)
+	}
+}
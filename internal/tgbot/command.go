@@ -0,0 +1,34 @@
+package tgbot
+
+import (
+	"strings"
+
+	"github.com/go-telegram/bot/models"
+)
+
+// MatchCommand reports whether text invokes the command, optionally followed by
+// the bot username (/cmd@botname) and arguments.
+func MatchCommand(text, command string) bool {
+	if !strings.HasPrefix(text, command) {
+		return false
+	}
+	rest := text[len(command):]
+	return rest == "" || strings.HasPrefix(rest, "@") || strings.HasPrefix(rest, " ") || strings.HasPrefix(rest, "\n")
+}
+
+// CommandArgs returns the text following the command and the optional @botname suffix.
+func CommandArgs(text string) string {
+	text = strings.TrimSpace(text)
+	i := strings.IndexAny(text, " \t\n")
+	if i < 0 {
+		return ""
+	}
+	return strings.TrimSpace(text[i+1:])
+}
+
+// matchCommandFunc builds a matcher for commands with arguments in message texts.
+func matchCommandFunc(command string) func(update *models.Update) bool {
+	return func(update *models.Update) bool {
+		return update.Message != nil && MatchCommand(update.Message.Text, command)
+	}
+}
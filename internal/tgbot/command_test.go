@@ -0,0 +1,23 @@
+package tgbot
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchCommand(t *testing.T) {
+	assert.True(t, MatchCommand("/draw", "/draw"))
+	assert.True(t, MatchCommand("/draw a cat", "/draw"))
+	assert.True(t, MatchCommand("/draw@gourbot a cat", "/draw"))
+	assert.True(t, MatchCommand("/draw\na cat", "/draw"))
+	assert.False(t, MatchCommand("/drawing", "/draw"))
+	assert.False(t, MatchCommand("draw a cat", "/draw"))
+}
+
+func TestCommandArgs(t *testing.T) {
+	assert.Equal(t, "", CommandArgs("/draw"))
+	assert.Equal(t, "a cat", CommandArgs("/draw a cat"))
+	assert.Equal(t, "a cat", CommandArgs("/draw@gourbot   a cat "))
+	assert.Equal(t, "a cat\non a mat", CommandArgs("/draw\na cat\non a mat"))
+}
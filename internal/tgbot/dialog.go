@@ -0,0 +1,244 @@
+package tgbot
+
+import (
+	"fmt"
+	"time"
+
+	"gourbot/internal/types"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// dialogExpiryInterval is how often timed out dialogs are looked for.
+const dialogExpiryInterval = time.Minute
+
+// DialogStep handles the user's answer at a step of a dialog. It either moves the dialog
+// to another step with Next, ends it with Finish, or does neither to ask again.
+type DialogStep func(dc *DialogContext)
+
+// dialogDef is a registered dialog.
+type dialogDef struct {
+	first string
+	steps map[string]DialogStep
+}
+
+// DialogChoice is a button of a DialogKeyboard.
+type DialogChoice struct {
+	Text  string
+	Value string // Passed to the step as DialogContext.Button
+}
+
+// DialogContext is the answer of a user to the current step of a dialog.
+type DialogContext struct {
+	Dialog   *types.Dialog
+	Update   *models.Update
+	Text     string    // Text of the answer message, empty if a button was pressed
+	Button   string    // Value of the pressed DialogKeyboard button, empty if a message was sent
+	Callback *Callback // The pressed button, nil if a message was sent
+	tgBot    *TgBot
+	message  *models.Message // Message the dialog continues from, for the forum topic
+	next     string
+	finished bool
+}
+
+// Next moves the dialog to the step once the current one returns.
+func (dc *DialogContext) Next(step string) {
+	dc.next = step
+}
+
+// Finish ends the dialog once the current step returns.
+func (dc *DialogContext) Finish() {
+	dc.finished = true
+}
+
+// Get returns a value collected earlier in the dialog.
+func (dc *DialogContext) Get(key string) string {
+	return dc.Dialog.Data[key]
+}
+
+// Set stores a value in the dialog state.
+func (dc *DialogContext) Set(key, value string) {
+	dc.Dialog.Data[key] = value
+}
+
+// Say sends a message to the dialog's chat, optionally with a DialogKeyboard.
+func (dc *DialogContext) Say(text string, keyboard *models.InlineKeyboardMarkup) {
+	params := &bot.SendMessageParams{ChatID: dc.Dialog.ChatId, Text: text}
+	if dc.message != nil {
+		params.MessageThreadID = TopicOf(dc.message)
+	}
+	if keyboard != nil {
+		params.ReplyMarkup = keyboard
+	}
+	dc.tgBot.SendMessage(params)
+}
+
+// DialogKeyboard creates buttons answering the current step of the dialog.
+func (tgBot *TgBot) DialogKeyboard(name string, choices ...DialogChoice) (*models.InlineKeyboardMarkup, error) {
+	var row []models.InlineKeyboardButton
+	for _, choice := range choices {
+		button, err := tgBot.callbackCodec.Button(choice.Text, callbackDialog, name, choice.Value)
+		if err != nil {
+			return nil, err
+		}
+		row = append(row, button)
+	}
+	return &models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{row}}, nil
+}
+
+// RegisterDialog registers a dialog which starts at the first step.
+func (tgBot *TgBot) RegisterDialog(name, first string, steps map[string]DialogStep) {
+	if _, exists := tgBot.dialogs[name]; exists {
+		return // Dialog already registered
+	}
+	tgBot.dialogs[name] = &dialogDef{first: first, steps: steps}
+}
+
+// StartDialog starts the dialog for the sender of the update's message in its chat,
+// replacing any other dialog of the sender there. The data, which may be nil, is available
+// to the steps with Get. The caller asks the first question.
+func (tgBot *TgBot) StartDialog(update *models.Update, name string, data map[string]string) error {
+	def := tgBot.dialogs[name]
+	if def == nil {
+		return fmt.Errorf("unknown dialog %q", name)
+	}
+	dialog := types.NewDialog(update.Message.Chat.ID, update.Message.From.ID, name, def.first, tgBot.dialogTimeout())
+	for key, value := range data {
+		dialog.Data[key] = value
+	}
+	return tgBot.storage.SaveDialog(dialog)
+}
+
+// HandleDialog passes the message to the dialog its sender runs in the chat, if any,
+// and reports whether it did.
+func (tgBot *TgBot) HandleDialog(update *models.Update) bool {
+	msg := update.Message
+	if msg == nil || msg.From == nil {
+		return false
+	}
+	dialog, err := tgBot.storage.GetDialog(msg.Chat.ID, msg.From.ID)
+	if err != nil {
+		tgBot.logger.Errorf("Failed to get dialog of user %d in chat %d: %v", msg.From.ID, msg.Chat.ID, err)
+		return false
+	}
+	if dialog == nil {
+		return false
+	}
+	if dialog.Expired() {
+		tgBot.storage.DeleteDialog(dialog.ChatId, dialog.UserId)
+		tgBot.Reply(update, "The dialog has timed out, please start it again.")
+		return true
+	}
+	text := msg.Text
+	if IsGroupChat(&msg.Chat) {
+		text = StripMention(text, tgBot.me.Username)
+	}
+	tgBot.runDialog(&DialogContext{Dialog: dialog, Update: update, Text: text, tgBot: tgBot, message: msg})
+	return true
+}
+
+// CallbackDialog passes a pressed DialogKeyboard button to the presser's dialog.
+func (tgBot *TgBot) CallbackDialog(cb *Callback) {
+	if cb.Message == nil {
+		cb.Alert("This dialog is over.")
+		return
+	}
+	dialog, err := tgBot.storage.GetDialog(cb.Message.Chat.ID, cb.Query.From.ID)
+	if err != nil {
+		tgBot.logger.Errorf("Failed to get dialog of user %d in chat %d: %v", cb.Query.From.ID, cb.Message.Chat.ID, err)
+	}
+	if dialog == nil || dialog.Name != cb.Arg(0) || dialog.Expired() {
+		cb.Alert("This dialog is over.")
+		return
+	}
+	dc := &DialogContext{Dialog: dialog, Update: cb.Update, Button: cb.Arg(1), Callback: cb, tgBot: tgBot, message: cb.Message}
+	tgBot.runDialog(dc)
+	if dc.finished || dc.next != "" {
+		tgBot.EditCallbackMessage(cb, cb.Message.Text, nil) // The question is answered, remove its buttons
+	}
+}
+
+// runDialog runs the current step of the dialog and stores the resulting state.
+func (tgBot *TgBot) runDialog(dc *DialogContext) {
+	dialog := dc.Dialog
+	var step DialogStep
+	if def := tgBot.dialogs[dialog.Name]; def != nil {
+		step = def.steps[dialog.Step]
+	}
+	if step == nil {
+		tgBot.logger.Errorf("Dialog %s has no step %q", dialog.Name, dialog.Step)
+		tgBot.storage.DeleteDialog(dialog.ChatId, dialog.UserId)
+		dc.Say("This dialog is not available anymore.", nil)
+		return
+	}
+
+	step(dc)
+	if dc.finished {
+		if _, err := tgBot.storage.DeleteDialog(dialog.ChatId, dialog.UserId); err != nil {
+			tgBot.logger.Errorf("Failed to delete dialog of user %d in chat %d: %v", dialog.UserId, dialog.ChatId, err)
+		}
+		return
+	}
+	if dc.next != "" {
+		dialog.Step = dc.next
+	}
+	dialog.UpdatedAt = time.Now()
+	dialog.ExpiresAt = dialog.UpdatedAt.Add(tgBot.dialogTimeout())
+	if err := tgBot.storage.SaveDialog(dialog); err != nil {
+		tgBot.logger.Errorf("Failed to save dialog of user %d in chat %d: %v", dialog.UserId, dialog.ChatId, err)
+	}
+}
+
+// CmdCancel handles the "/cancel" command which ends the sender's dialog in the chat.
+func (tgBot *TgBot) CmdCancel(update *models.Update) {
+	deleted, err := tgBot.storage.DeleteDialog(update.Message.Chat.ID, update.Message.From.ID)
+	switch {
+	case err != nil:
+		tgBot.logger.Errorf("Failed to cancel dialog of user %d: %v", update.Message.From.ID, err)
+		tgBot.Reply(update, "Failed to cancel the dialog.")
+	case !deleted:
+		tgBot.Reply(update, "There is nothing to cancel.")
+	default:
+		tgBot.Reply(update, "Cancelled.")
+	}
+}
+
+// expireDialogs periodically removes timed out dialogs and tells their users about it.
+func (tgBot *TgBot) expireDialogs() {
+	defer tgBot.wgWorkers.Done()
+	ticker := time.NewTicker(dialogExpiryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-tgBot.stopping:
+			return
+		case <-tgBot.context.Done():
+			return
+		case now := <-ticker.C:
+			tgBot.expireDialogsAt(now)
+		}
+	}
+}
+
+// expireDialogsAt removes the dialogs timed out at the given time and tells their users.
+func (tgBot *TgBot) expireDialogsAt(now time.Time) {
+	dialogs, err := tgBot.storage.TakeExpiredDialogs(now)
+	if err != nil {
+		tgBot.logger.Errorf("Failed to expire dialogs: %v", err)
+		return
+	}
+	for _, dialog := range dialogs {
+		text := "The dialog has timed out."
+		if dialog.ChatId != dialog.UserId {
+			if user, err := tgBot.storage.GetTgUser(dialog.UserId); err == nil {
+				text = "The dialog with " + user.Name + " has timed out."
+			}
+		}
+		tgBot.SendMessage(&bot.SendMessageParams{ChatID: dialog.ChatId, Text: text})
+	}
+}
+
+func (tgBot *TgBot) dialogTimeout() time.Duration {
+	return time.Duration(tgBot.config().DialogTimeout) * time.Minute
+}
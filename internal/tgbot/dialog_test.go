@@ -0,0 +1,163 @@
+package tgbot
+
+import (
+	"testing"
+	"time"
+
+	"gourbot/internal/types"
+
+	"github.com/go-telegram/bot/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// newDialogTestBot returns a bot with a two-step "greet" dialog: it asks for a name,
+// then for a confirmation with buttons.
+func newDialogTestBot(t *testing.T) (*TgBot, *fakeAPI) {
+	tgBot, api := newTestBot(t)
+	addTestUser(t, tgBot, 42, types.CanChat)
+	tgBot.RegisterCallback(callbackDialog, "", tgBot.CallbackDialog)
+	tgBot.RegisterDialog("greet", "name", map[string]DialogStep{
+		"name": func(dc *DialogContext) {
+			if dc.Text == "" {
+				dc.Say("Your name, please.", nil)
+				return
+			}
+			dc.Set("name", dc.Text)
+			keyboard, _ := tgBot.DialogKeyboard("greet", DialogChoice{"Yes", "yes"}, DialogChoice{"No", "no"})
+			dc.Say("Greet "+dc.Text+"?", keyboard)
+			dc.Next("confirm")
+		},
+		"confirm": func(dc *DialogContext) {
+			switch dc.Button {
+			case "yes":
+				dc.Say("Hello, "+dc.Get("name")+"!", nil)
+				dc.Finish()
+			case "no":
+				dc.Say("Maybe later.", nil)
+				dc.Finish()
+			default:
+				dc.Say("Please press Yes or No.", nil)
+			}
+		},
+	})
+	return tgBot, api
+}
+
+// pressDialogButton returns an update of the user pressing a button of the dialog.
+func pressDialogButton(t *testing.T, tgBot *TgBot, userID int64, name, value string) *models.Update {
+	data, err := tgBot.callbackCodec.Encode(callbackDialog, name, value)
+	assert.NoError(t, err)
+	return &models.Update{
+		ID: 2,
+		CallbackQuery: &models.CallbackQuery{
+			ID:   "query",
+			From: models.User{ID: userID},
+			Data: data,
+			Message: models.MaybeInaccessibleMessage{
+				Type:    models.MaybeInaccessibleMessageTypeMessage,
+				Message: &models.Message{ID: 7, Chat: models.Chat{ID: userID, Type: models.ChatTypePrivate}, Text: "Greet Alice?"},
+			},
+		},
+	}
+}
+
+// lastText returns the last message sent or edited by the bot.
+func lastText(api *fakeAPI) string {
+	texts := api.texts()
+	if len(texts) == 0 {
+		return ""
+	}
+	return texts[len(texts)-1]
+}
+
+func TestDialog_Steps(t *testing.T) {
+	tgBot, api := newDialogTestBot(t)
+
+	assert.False(t, tgBot.HandleDialog(privateMessage(42, "hi")), "messages outside a dialog are not taken")
+	assert.Error(t, tgBot.StartDialog(privateMessage(42, "/greet"), "unknown", nil))
+	assert.NoError(t, tgBot.StartDialog(privateMessage(42, "/greet"), "greet", map[string]string{"origin": "test"}))
+
+	assert.True(t, tgBot.HandleDialog(privateMessage(42, "Alice")))
+	assert.Equal(t, "Greet Alice?", lastText(api))
+	dialog, err := tgBot.storage.GetDialog(42, 42)
+	assert.NoError(t, err)
+	if assert.NotNil(t, dialog) {
+		assert.Equal(t, "confirm", dialog.Step, "the step moved on")
+		assert.Equal(t, map[string]string{"origin": "test", "name": "Alice"}, dialog.Data)
+	}
+
+	assert.True(t, tgBot.HandleDialog(privateMessage(42, "yes")), "a text answer to a button question")
+	assert.Equal(t, "Please press Yes or No.", lastText(api))
+	dialog, _ = tgBot.storage.GetDialog(42, 42)
+	if assert.NotNil(t, dialog) {
+		assert.Equal(t, "confirm", dialog.Step, "the step is asked again")
+	}
+
+	assert.False(t, tgBot.HandleDialog(privateMessage(43, "Bob")), "dialogs belong to their user")
+}
+
+func TestDialog_Buttons(t *testing.T) {
+	tgBot, api := newDialogTestBot(t)
+	assert.NoError(t, tgBot.StartDialog(privateMessage(42, "/greet"), "greet", nil))
+	tgBot.HandleDialog(privateMessage(42, "Alice"))
+
+	tgBot.CallbackHandler(pressDialogButton(t, tgBot, 42, "other", "yes"))
+	answers := api.sent("answerCallbackQuery")
+	if assert.Len(t, answers, 1) {
+		assert.Equal(t, "This dialog is over.", answers[0].params.Get("text"), "buttons of other dialogs are refused")
+	}
+
+	tgBot.CallbackHandler(pressDialogButton(t, tgBot, 42, "greet", "yes"))
+	texts := api.texts()
+	assert.Contains(t, texts, "Hello, Alice!")
+	edits := api.sent("editMessageText")
+	if assert.NotEmpty(t, edits) {
+		assert.Equal(t, "", edits[len(edits)-1].params.Get("reply_markup"), "the answered question loses its buttons")
+	}
+	dialog, err := tgBot.storage.GetDialog(42, 42)
+	assert.NoError(t, err)
+	assert.Nil(t, dialog, "the dialog is finished")
+
+	tgBot.CallbackHandler(pressDialogButton(t, tgBot, 42, "greet", "no"))
+	answers = api.sent("answerCallbackQuery")
+	assert.Equal(t, "This dialog is over.", answers[len(answers)-1].params.Get("text"), "a finished dialog takes no more buttons")
+}
+
+func TestDialog_Cancel(t *testing.T) {
+	tgBot, api := newDialogTestBot(t)
+	assert.NoError(t, tgBot.StartDialog(privateMessage(42, "/greet"), "greet", nil))
+
+	tgBot.CmdCancel(privateMessage(42, "/cancel"))
+	assert.Equal(t, "Cancelled.", lastText(api))
+	assert.False(t, tgBot.HandleDialog(privateMessage(42, "Alice")), "a cancelled dialog takes no answers")
+
+	tgBot.CmdCancel(privateMessage(42, "/cancel"))
+	assert.Equal(t, "There is nothing to cancel.", lastText(api))
+}
+
+func TestDialog_Timeout(t *testing.T) {
+	tgBot, api := newDialogTestBot(t)
+	addTestUser(t, tgBot, 43)
+
+	// A dialog timed out before the expiry loop noticed it
+	late := types.NewDialog(42, 42, "greet", "name", -time.Second)
+	assert.NoError(t, tgBot.storage.SaveDialog(late))
+	assert.True(t, tgBot.HandleDialog(privateMessage(42, "Alice")))
+	assert.Equal(t, "The dialog has timed out, please start it again.", lastText(api))
+	dialog, _ := tgBot.storage.GetDialog(42, 42)
+	assert.Nil(t, dialog)
+
+	// The expiry loop tells the users in their chats
+	assert.NoError(t, tgBot.StartDialog(privateMessage(42, "/greet"), "greet", nil))
+	group := types.NewDialog(-100, 43, "greet", "name", time.Minute)
+	assert.NoError(t, tgBot.storage.SaveDialog(group))
+	tgBot.expireDialogsAt(time.Now())
+	assert.Len(t, api.sent("sendMessage"), 1, "dialogs which did not time out yet are kept")
+
+	tgBot.expireDialogsAt(time.Now().Add(time.Hour))
+	texts := api.texts()
+	assert.Contains(t, texts, "The dialog has timed out.")
+	assert.Contains(t, texts, "The dialog with user43 has timed out.", "in groups the user is named")
+	dialog, _ = tgBot.storage.GetDialog(42, 42)
+	assert.Nil(t, dialog)
+}
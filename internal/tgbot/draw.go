@@ -0,0 +1,162 @@
+package tgbot
+
+import (
+	"bytes"
+	"image"
+	"image/draw"
+	_ "image/jpeg" // Telegram photos are JPEG
+	"image/png"
+	"strings"
+
+	"gourbot/internal/llm"
+	"gourbot/internal/types"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// maxCaptionLength is the Telegram limit for media captions.
+const maxCaptionLength = 1024
+
+// maxVariationSide is the largest photo side sent to the variations endpoint.
+const maxVariationSide = 1024
+
+const drawUsage = "Usage: /draw [size=1024x1024] [quality=hd] <prompt>\n" +
+	"Reply to a photo with /draw <prompt> to edit it, or with a bare /draw to get a variation."
+
+// ParseDrawArgs splits /draw arguments into the image options given as leading
+// key=value pairs and the prompt itself.
+func ParseDrawArgs(args string) *llm.ImageRequest {
+	req := &llm.ImageRequest{}
+	fields := strings.Fields(args)
+options:
+	for len(fields) > 0 {
+		key, value, _ := strings.Cut(fields[0], "=")
+		switch strings.ToLower(key) {
+		case "size":
+			req.Size = value
+		case "quality":
+			req.Quality = value
+		default:
+			break options // Not an option, the prompt starts here
+		}
+		fields = fields[1:]
+	}
+	req.Prompt = strings.Join(fields, " ")
+	return req
+}
+
+// CmdDraw handles the "/draw" command.
+func (tgBot *TgBot) CmdDraw(update *models.Update) {
+	user := tgBot.UserWithPermission(update, types.CanDraw)
+	if user == nil {
+		return
+	}
+	openai := tgBot.registry().OpenAI()
+	if openai == nil {
+		tgBot.Reply(update, "Drawing requires the OpenAI provider, which is not configured.")
+		return
+	}
+
+	req := ParseDrawArgs(CommandArgs(update.Message.Text))
+	prompt := req.Prompt
+	var source []models.PhotoSize
+	if reply := update.Message.ReplyToMessage; reply != nil {
+		source = reply.Photo
+	}
+	if prompt == "" && len(source) == 0 {
+		tgBot.Reply(update, drawUsage)
+		return
+	}
+	if ok, message := tgBot.CheckQuota(user); !ok {
+		tgBot.Reply(update, message)
+		return
+	}
+
+	stopAction := tgBot.KeepChatAction(update.Message.Chat.ID, models.ChatActionUploadPhoto)
+	defer stopAction()
+
+	var picture []byte
+	var err error
+	switch {
+	case len(source) == 0:
+		req.Model = tgBot.config().ImageModel
+		picture, err = openai.GenerateImage(tgBot.context, req)
+	case prompt != "":
+		req.Model = tgBot.config().ImageEditModel
+		picture, err = tgBot.editPhoto(openai, req, source)
+	default:
+		req.Model = llm.VariationModel
+		picture, err = tgBot.photoVariation(openai, req, source)
+	}
+	if err != nil {
+		tgBot.logger.Errorf("Image request failed: %v", err)
+		tgBot.Notify(types.NotifyError, "Image request failed: "+err.Error())
+		tgBot.Reply(update, "Failed to draw: "+err.Error())
+		return
+	}
+	tgBot.ChargeUsage(user.Id, types.UsageImage, req.Model, llm.ImagePrice(req.Model, req.Size, req.Quality))
+
+	caption := prompt
+	if caption == "" {
+		caption = "(variation)"
+	}
+	tgBot.SendPhoto(&bot.SendPhotoParams{
+		ChatID:          update.Message.Chat.ID,
+		MessageThreadID: TopicOf(update.Message),
+		Photo:           &models.InputFileUpload{Filename: "image.png", Data: bytes.NewReader(picture)},
+		Caption:         TruncateMessage(caption, maxCaptionLength),
+		ReplyParameters: &models.ReplyParameters{MessageID: update.Message.ID},
+	})
+}
+
+// editPhoto redraws the largest available size of the photo according to the prompt.
+func (tgBot *TgBot) editPhoto(openai *llm.OpenAI, req *llm.ImageRequest, photo []models.PhotoSize) ([]byte, error) {
+	data, err := tgBot.DownloadFile(photo[len(photo)-1].FileID)
+	if err != nil {
+		return nil, err
+	}
+	return openai.EditImage(tgBot.context, req, data, "image.jpg")
+}
+
+// photoVariation creates a variation of the photo. The variations endpoint accepts
+// only square PNG images, so the photo is cropped and converted first.
+func (tgBot *TgBot) photoVariation(openai *llm.OpenAI, req *llm.ImageRequest, photo []models.PhotoSize) ([]byte, error) {
+	best := photo[0]
+	for _, size := range photo[1:] {
+		if size.Width <= maxVariationSide && size.Height <= maxVariationSide {
+			best = size
+		}
+	}
+	data, err := tgBot.DownloadFile(best.FileID)
+	if err != nil {
+		return nil, err
+	}
+	square, err := SquarePNG(data)
+	if err != nil {
+		return nil, err
+	}
+	return openai.CreateImageVariation(tgBot.context, req.Size, square)
+}
+
+// SquarePNG crops the center square out of an image and encodes it as PNG.
+func SquarePNG(data []byte) ([]byte, error) {
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	bounds := src.Bounds()
+	side := bounds.Dx()
+	if bounds.Dy() < side {
+		side = bounds.Dy()
+	}
+	origin := image.Pt(bounds.Min.X+(bounds.Dx()-side)/2, bounds.Min.Y+(bounds.Dy()-side)/2)
+	dst := image.NewRGBA(image.Rect(0, 0, side, side))
+	draw.Draw(dst, dst.Bounds(), src, origin, draw.Src)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, dst); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
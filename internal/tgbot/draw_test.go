@@ -0,0 +1,48 @@
+package tgbot
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDrawArgs(t *testing.T) {
+	req := ParseDrawArgs("a red cat")
+	assert.Equal(t, "a red cat", req.Prompt)
+	assert.Empty(t, req.Size)
+	assert.Empty(t, req.Quality)
+
+	req = ParseDrawArgs("size=1792x1024 quality=hd a red cat")
+	assert.Equal(t, "a red cat", req.Prompt)
+	assert.Equal(t, "1792x1024", req.Size)
+	assert.Equal(t, "hd", req.Quality)
+
+	// Options are recognized only before the prompt
+	req = ParseDrawArgs("a cat size=256x256")
+	assert.Equal(t, "a cat size=256x256", req.Prompt)
+	assert.Empty(t, req.Size)
+
+	req = ParseDrawArgs("size=512x512")
+	assert.Empty(t, req.Prompt)
+	assert.Equal(t, "512x512", req.Size)
+}
+
+func TestSquarePNG(t *testing.T) {
+	var src bytes.Buffer
+	assert.NoError(t, jpeg.Encode(&src, image.NewRGBA(image.Rect(0, 0, 40, 30)), nil))
+
+	data, err := SquarePNG(src.Bytes())
+	assert.NoError(t, err)
+
+	img, err := png.Decode(bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, 30, img.Bounds().Dx())
+	assert.Equal(t, 30, img.Bounds().Dy())
+
+	_, err = SquarePNG([]byte("not an image"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,34 @@
+package tgbot
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/go-telegram/bot"
+)
+
+// maxDownloadSize limits files downloaded from Telegram (the Bot API itself serves up to 20 MB).
+const maxDownloadSize = 20 * 1024 * 1024
+
+// DownloadFile fetches the content of a file sent to the bot.
+func (tgBot *TgBot) DownloadFile(fileID string) ([]byte, error) {
+	file, err := tgBot.bot.GetFile(tgBot.context, &bot.GetFileParams{FileID: fileID})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(tgBot.context, http.MethodGet, tgBot.bot.FileDownloadLink(file), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		// Do not include the URL into the error, it contains the bot token
+		return nil, fmt.Errorf("download of file %s failed: %s", fileID, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxDownloadSize))
+}
@@ -0,0 +1,80 @@
+package tgbot
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxMessageLength is the Telegram limit for the text of a single message.
+const maxMessageLength = 4096
+
+var boldRe = regexp.MustCompile(`\*\*([^*\n]+)\*\*`)
+
+// MarkdownToHTML converts the markdown subset commonly produced by LLMs
+// (fenced code blocks, inline code and bold text) into Telegram-compatible HTML.
+// Everything else is escaped and passed through as plain text.
+func MarkdownToHTML(text string) string {
+	var sb strings.Builder
+	for i, block := range strings.Split(text, "```") {
+		if i%2 == 1 {
+			// Fenced code block, the first line may hold the language name
+			if nl := strings.IndexByte(block, '\n'); nl >= 0 && !strings.ContainsAny(block[:nl], " \t") {
+				block = block[nl+1:]
+			}
+			sb.WriteString("<pre><code>")
+			sb.WriteString(html.EscapeString(strings.TrimRight(block, "\n")))
+			sb.WriteString("</code></pre>")
+			continue
+		}
+		for j, span := range strings.Split(block, "`") {
+			if j%2 == 1 {
+				sb.WriteString("<code>")
+				sb.WriteString(html.EscapeString(span))
+				sb.WriteString("</code>")
+				continue
+			}
+			sb.WriteString(boldRe.ReplaceAllString(html.EscapeString(span), "<b>$1</b>"))
+		}
+	}
+	return sb.String()
+}
+
+// SplitMessage splits text into chunks no longer than limit runes,
+// preferring to break at line boundaries.
+func SplitMessage(text string, limit int) []string {
+	var chunks []string
+	for utf8.RuneCountInString(text) > limit {
+		cut := runeOffset(text, limit)
+		if nl := strings.LastIndexByte(text[:cut], '\n'); nl > 0 {
+			cut = nl + 1
+		}
+		chunks = append(chunks, text[:cut])
+		text = text[cut:]
+	}
+	if text != "" || len(chunks) == 0 {
+		chunks = append(chunks, text)
+	}
+	return chunks
+}
+
+// TruncateMessage shortens text to fit into limit runes, marking the cut with an ellipsis.
+func TruncateMessage(text string, limit int) string {
+	if utf8.RuneCountInString(text) <= limit {
+		return text
+	}
+	runes := []rune(text)
+	return string(runes[:limit-1]) + "…"
+}
+
+// runeOffset returns the byte offset of the n-th rune in s.
+func runeOffset(s string, n int) int {
+	for i := range s {
+		if n == 0 {
+			return i
+		}
+		n--
+	}
+	return len(s)
+}
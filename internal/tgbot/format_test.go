@@ -0,0 +1,59 @@
+package tgbot
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarkdownToHTML(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "Plain text is escaped",
+			input:    "a < b && c > d",
+			expected: "a &lt; b &amp;&amp; c &gt; d",
+		},
+		{
+			name:     "Bold text",
+			input:    "this is **important**",
+			expected: "this is <b>important</b>",
+		},
+		{
+			name:     "Inline code",
+			input:    "call `f(<x>)` now",
+			expected: "call <code>f(&lt;x&gt;)</code> now",
+		},
+		{
+			name:     "Fenced code block with language",
+			input:    "code:\n```go\nfmt.Println(\"**\")\n```\ndone",
+			expected: "code:\n<pre><code>fmt.Println(&#34;**&#34;)</code></pre>\ndone",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, MarkdownToHTML(tt.input))
+		})
+	}
+}
+
+func TestSplitMessage(t *testing.T) {
+	assert.Equal(t, []string{""}, SplitMessage("", 10))
+	assert.Equal(t, []string{"short"}, SplitMessage("short", 10))
+	assert.Equal(t, []string{"0123456789", "abc"}, SplitMessage("0123456789abc", 10))
+	assert.Equal(t, []string{"line one\n", "line two"}, SplitMessage("line one\nline two", 10))
+
+	// Multi-byte runes are never cut in half
+	chunks := SplitMessage(strings.Repeat("ж", 25), 10)
+	assert.Equal(t, []string{strings.Repeat("ж", 10), strings.Repeat("ж", 10), strings.Repeat("ж", 5)}, chunks)
+}
+
+func TestTruncateMessage(t *testing.T) {
+	assert.Equal(t, "short", TruncateMessage("short", 10))
+	assert.Equal(t, "абвг…", TruncateMessage("абвгдежз", 5))
+}
@@ -0,0 +1,168 @@
+package tgbot
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf16"
+
+	"gourbot/internal/types"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+const botUsage = "Usage: /bot [on|off|threads on|threads off]"
+
+var doubleSpaceRe = regexp.MustCompile(`[ \t]{2,}`)
+
+// conversation identifies a chat, or a forum topic of a chat, with its own LLM context.
+type conversation struct {
+	chatID   int64
+	threadID int // 0 for the whole chat
+}
+
+// IsGroupChat reports whether the chat is a group or a supergroup.
+func IsGroupChat(chat *models.Chat) bool {
+	return chat.Type == models.ChatTypeGroup || chat.Type == models.ChatTypeSupergroup
+}
+
+// AddressedToBot reports whether a group message is meant for the bot: it mentions the bot,
+// replies to one of its messages, or is a command not addressed to another bot.
+func AddressedToBot(msg *models.Message, me *models.User) bool {
+	if msg.ReplyToMessage != nil && msg.ReplyToMessage.From != nil && msg.ReplyToMessage.From.ID == me.ID {
+		return true
+	}
+	if strings.HasPrefix(msg.Text, "/") {
+		command := strings.Fields(msg.Text)[0]
+		_, username, found := strings.Cut(command, "@")
+		return !found || strings.EqualFold(username, me.Username)
+	}
+	text := utf16.Encode([]rune(msg.Text))
+	for _, entity := range msg.Entities {
+		switch entity.Type {
+		case models.MessageEntityTypeMention:
+			if entity.Offset < 0 || entity.Offset+entity.Length > len(text) {
+				continue
+			}
+			mention := string(utf16.Decode(text[entity.Offset : entity.Offset+entity.Length]))
+			if strings.EqualFold(mention, "@"+me.Username) {
+				return true
+			}
+		case models.MessageEntityTypeTextMention:
+			if entity.User != nil && entity.User.ID == me.ID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// StripMention removes mentions of the bot username from the text.
+func StripMention(text, username string) string {
+	mention := regexp.MustCompile(`(?i)@` + regexp.QuoteMeta(username) + `\b`)
+	text = mention.ReplaceAllString(text, "")
+	return strings.TrimSpace(doubleSpaceRe.ReplaceAllString(text, " "))
+}
+
+// TopicOf returns the forum topic of the message or 0 if it is not in a topic.
+func TopicOf(msg *models.Message) int {
+	if msg.IsTopicMessage {
+		return msg.MessageThreadID
+	}
+	return 0
+}
+
+// ConversationOf returns the conversation a message belongs to. Forum topics have
+// their own context unless threads are turned off for the chat with "/bot threads off".
+func (tgBot *TgBot) ConversationOf(msg *models.Message) conversation {
+	conv := conversation{chatID: msg.Chat.ID}
+	if topic := TopicOf(msg); topic != 0 && tgBot.chatSettingOn(msg.Chat.ID, types.SettingThreads) {
+		conv.threadID = topic
+	}
+	return conv
+}
+
+// BotEnabledInChat reports whether the group admins have not disabled the bot in the chat.
+func (tgBot *TgBot) BotEnabledInChat(chatID int64) bool {
+	return tgBot.chatSettingOn(chatID, types.SettingEnabled)
+}
+
+// chatSettingOn reports whether a chat setting which is on by default is not "off".
+func (tgBot *TgBot) chatSettingOn(chatID int64, key string) bool {
+	value, err := tgBot.storage.GetChatSetting(chatID, key)
+	if err != nil {
+		tgBot.logger.Errorf("Failed to get setting %s of chat %d: %v", key, chatID, err)
+	}
+	return value != "off"
+}
+
+// IsChatAdmin reports whether the user is an administrator or the owner of the chat.
+func (tgBot *TgBot) IsChatAdmin(chatID, userID int64) (bool, error) {
+	member, err := tgBot.bot.GetChatMember(tgBot.context, &bot.GetChatMemberParams{ChatID: chatID, UserID: userID})
+	if err != nil {
+		return false, err
+	}
+	return member.Type == models.ChatMemberTypeOwner || member.Type == models.ChatMemberTypeAdministrator, nil
+}
+
+// CmdBot handles the "/bot" command which lets group admins enable or disable the bot in
+// the group and choose whether forum topics have separate conversations. It is not guarded
+// by user permissions, so that admins can turn off a bot somebody else added.
+func (tgBot *TgBot) CmdBot(update *models.Update) {
+	msg := update.Message
+	if !IsGroupChat(&msg.Chat) {
+		tgBot.Reply(update, "This command works in groups only.")
+		return
+	}
+	if !AddressedToBot(msg, tgBot.me) || msg.From == nil {
+		return
+	}
+	chatID := msg.Chat.ID
+
+	args := strings.Fields(strings.ToLower(CommandArgs(msg.Text)))
+	if len(args) == 0 {
+		status := "enabled"
+		if !tgBot.BotEnabledInChat(chatID) {
+			status = "disabled"
+		}
+		threads := "separate conversations"
+		if !tgBot.chatSettingOn(chatID, types.SettingThreads) {
+			threads = "one shared conversation"
+		}
+		tgBot.Reply(update, "The bot is "+status+" in this chat; forum topics have "+threads+".\n"+botUsage)
+		return
+	}
+
+	key, value := types.SettingEnabled, args[0]
+	if args[0] == "threads" && len(args) == 2 {
+		key, value = types.SettingThreads, args[1]
+	}
+	if value != "on" && value != "off" {
+		tgBot.Reply(update, botUsage)
+		return
+	}
+
+	allowed, err := tgBot.IsChatAdmin(chatID, msg.From.ID)
+	if err != nil {
+		tgBot.logger.Errorf("Failed to get member %d of chat %d: %v", msg.From.ID, chatID, err)
+	}
+	if !allowed {
+		if user, err := tgBot.storage.GetTgUser(msg.From.ID); err == nil && user.HasPermission(types.CanEverything) {
+			allowed = true
+		}
+	}
+	if !allowed {
+		tgBot.Reply(update, "Only chat administrators can change this.")
+		return
+	}
+
+	if value == "on" {
+		value = "" // On is the default
+	}
+	if err := tgBot.storage.SetChatSetting(chatID, key, value); err != nil {
+		tgBot.logger.Errorf("Failed to set %s of chat %d: %v", key, chatID, err)
+		tgBot.Reply(update, "Failed to save the setting.")
+		return
+	}
+	tgBot.Reply(update, "Done.")
+}
@@ -0,0 +1,47 @@
+package tgbot
+
+import (
+	"testing"
+
+	"github.com/go-telegram/bot/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddressedToBot(t *testing.T) {
+	me := &models.User{ID: 42, Username: "GourBot"}
+	mention := func(text string, offset, length int) *models.Message {
+		return &models.Message{Text: text, Entities: []models.MessageEntity{
+			{Type: models.MessageEntityTypeMention, Offset: offset, Length: length},
+		}}
+	}
+
+	assert.False(t, AddressedToBot(&models.Message{Text: "hello all"}, me))
+	assert.True(t, AddressedToBot(mention("@gourbot hi", 0, 8), me), "mentions are case-insensitive")
+	assert.True(t, AddressedToBot(mention("привет @GourBot", 7, 8), me), "offsets are in UTF-16 units")
+	assert.False(t, AddressedToBot(mention("@otherbot hi", 0, 9), me))
+	assert.False(t, AddressedToBot(mention("@gour", 0, 50), me), "broken entities are ignored")
+
+	assert.True(t, AddressedToBot(&models.Message{Text: "hi", Entities: []models.MessageEntity{
+		{Type: models.MessageEntityTypeTextMention, Offset: 0, Length: 2, User: &models.User{ID: 42}},
+	}}, me))
+	assert.True(t, AddressedToBot(&models.Message{Text: "and?", ReplyToMessage: &models.Message{From: &models.User{ID: 42}}}, me))
+	assert.False(t, AddressedToBot(&models.Message{Text: "and?", ReplyToMessage: &models.Message{From: &models.User{ID: 7}}}, me))
+
+	assert.True(t, AddressedToBot(&models.Message{Text: "/draw a cat"}, me))
+	assert.True(t, AddressedToBot(&models.Message{Text: "/draw@gourbot a cat"}, me))
+	assert.False(t, AddressedToBot(&models.Message{Text: "/draw@otherbot a cat"}, me))
+}
+
+func TestStripMention(t *testing.T) {
+	assert.Equal(t, "what time is it?", StripMention("@GourBot what time is it?", "gourbot"))
+	assert.Equal(t, "hey how are you", StripMention("hey @gourbot how are you @GOURBOT", "GourBot"))
+	assert.Equal(t, "line one\nline two", StripMention("@gourbot line one\nline two", "gourbot"), "line breaks are kept")
+	assert.Equal(t, "ask @gourbotfan", StripMention("ask @gourbotfan", "gourbot"), "longer usernames are not mentions")
+	assert.Equal(t, "ask @other", StripMention("ask @other", "gourbot"))
+	assert.Empty(t, StripMention("@gourbot", "gourbot"))
+}
+
+func TestTopicOf(t *testing.T) {
+	assert.Equal(t, 5, TopicOf(&models.Message{IsTopicMessage: true, MessageThreadID: 5}))
+	assert.Zero(t, TopicOf(&models.Message{MessageThreadID: 5}), "reply threads outside forums are not topics")
+}
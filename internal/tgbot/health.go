@@ -0,0 +1,60 @@
+package tgbot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"gourbot/internal/buildinfo"
+)
+
+// healthStatus is the JSON answer of the health endpoint.
+type healthStatus struct {
+	Status        string         `json:"status"` // "ok", or "error" with the Error
+	Error         string         `json:"error,omitempty"`
+	Build         buildinfo.Info `json:"build"`
+	StartedAt     time.Time      `json:"started_at"`
+	UptimeSeconds int64          `json:"uptime_seconds"`
+}
+
+// serveHealth serves GET /health on the configured address until the context is done, for
+// monitoring and container health checks. It answers 503 when the database is unusable.
+func (tgBot *TgBot) serveHealth(ctx context.Context, addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", tgBot.healthHandler)
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+	tgBot.logger.Infof("Serving the health endpoint on %s", addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		tgBot.logger.Errorf("Health endpoint failed: %v", err)
+	}
+}
+
+// healthHandler reports the build, the uptime and whether the database responds.
+func (tgBot *TgBot) healthHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	status := healthStatus{
+		Status:        "ok",
+		Build:         buildinfo.Get(),
+		StartedAt:     tgBot.startedAt,
+		UptimeSeconds: int64(time.Since(tgBot.startedAt).Seconds()),
+	}
+	code := http.StatusOK
+	if err := tgBot.storage.Ping(); err != nil {
+		status.Status, status.Error = "error", "database: "+err.Error()
+		code = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(status)
+}
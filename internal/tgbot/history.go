@@ -0,0 +1,215 @@
+package tgbot
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gourbot/internal/llm"
+	"gourbot/internal/types"
+
+	"github.com/go-telegram/bot/models"
+)
+
+// summaryPrompt instructs the model how to fold old turns into the rolling summary.
+const summaryPrompt = `You maintain the memory of a chat assistant. Update the summary of the conversation ` +
+	`with the new messages. Keep facts, names, decisions, preferences of the users and open questions; ` +
+	`drop greetings and small talk. Write in the language of the conversation, in at most 300 words. ` +
+	`Reply with the updated summary only.`
+
+// summaryIntro introduces the summary in the prompts of new questions.
+const summaryIntro = "Summary of the earlier conversation:\n"
+
+// SplitHistory splits the history into the older messages to summarize and the most
+// recent ones, at most keepTokens in total, which are kept verbatim.
+func SplitHistory(history []*types.HistoryMessage, keepTokens int) (old, recent []*types.HistoryMessage) {
+	i, kept := len(history), 0
+	for i > 0 && kept+history[i-1].Tokens <= keepTokens {
+		i--
+		kept += history[i].Tokens
+	}
+	return history[:i], history[i:]
+}
+
+// historyTokens returns the estimated size of the messages.
+func historyTokens(history []*types.HistoryMessage) int {
+	total := 0
+	for _, msg := range history {
+		total += msg.Tokens
+	}
+	return total
+}
+
+// ConversationMessages builds the messages of a new question: the summary of the older
+// conversation, the recent turns and the question itself.
+func (tgBot *TgBot) ConversationMessages(conv conversation, text string) []llm.Message {
+	var messages []llm.Message
+	summary, err := tgBot.storage.GetSummary(conv.chatID, conv.threadID)
+	if err != nil {
+		tgBot.logger.Errorf("Failed to get summary of chat %d: %v", conv.chatID, err)
+	}
+	if summary != nil {
+		messages = append(messages, llm.Message{Role: llm.RoleSystem, Content: summaryIntro + summary.Text})
+	}
+	history, err := tgBot.storage.GetHistory(conv.chatID, conv.threadID)
+	if err != nil {
+		tgBot.logger.Errorf("Failed to get history of chat %d: %v", conv.chatID, err)
+	}
+	for _, msg := range history {
+		messages = append(messages, llm.Message{Role: msg.Role, Content: msg.Content})
+	}
+	return append(messages, llm.Message{Role: llm.RoleUser, Content: text})
+}
+
+// Remember stores a question and its answer in the conversation history. If the history
+// has grown too long, its older part is summarized in the background.
+func (tgBot *TgBot) Remember(conv conversation, userID int64, question, answer string) {
+	for _, msg := range []*llm.Message{
+		{Role: llm.RoleUser, Content: question},
+		{Role: llm.RoleAssistant, Content: answer},
+	} {
+		record := types.NewHistoryMessage(conv.chatID, conv.threadID, userID, msg.Role, msg.Content, llm.EstimateMessageTokens(msg))
+		if err := tgBot.storage.AddHistoryMessage(record); err != nil {
+			tgBot.logger.Errorf("Failed to store history of chat %d: %v", conv.chatID, err)
+			return
+		}
+	}
+
+	// Only one summarization per conversation at a time; the next answer retries if needed
+	if _, running := tgBot.summarizing.LoadOrStore(conv, true); running {
+		return
+	}
+	tgBot.wgWorkers.Add(1)
+	go func() {
+		defer tgBot.wgWorkers.Done()
+		defer tgBot.summarizing.Delete(conv)
+		if err := tgBot.Summarize(conv, userID); err != nil {
+			tgBot.logger.Errorf("Failed to summarize chat %d: %v", conv.chatID, err)
+		}
+	}()
+}
+
+// Summarize folds the older part of the conversation history into the rolling summary.
+// It does nothing while the history is within GOURBOT_HISTORY_MAX_TOKENS.
+func (tgBot *TgBot) Summarize(conv conversation, userID int64) error {
+	history, err := tgBot.storage.GetHistory(conv.chatID, conv.threadID)
+	if err != nil {
+		return err
+	}
+	if historyTokens(history) <= tgBot.config().HistoryMaxTokens {
+		return nil
+	}
+	old, _ := SplitHistory(history, tgBot.config().HistoryKeepTokens)
+	if len(old) == 0 {
+		return nil
+	}
+	summary, err := tgBot.storage.GetSummary(conv.chatID, conv.threadID)
+	if err != nil {
+		return err
+	}
+
+	var sb strings.Builder
+	sb.WriteString("Summary so far:\n")
+	if summary != nil {
+		sb.WriteString(summary.Text)
+	} else {
+		sb.WriteString("(none)")
+	}
+	sb.WriteString("\n\nNew messages:\n")
+	for _, msg := range old {
+		fmt.Fprintf(&sb, "%s: %s\n", msg.Role, msg.Content)
+	}
+
+	model := tgBot.config().SummaryModel
+	if model == "" {
+		model = tgBot.SelectedModel(conv.chatID, userID)
+	}
+	answer, err := tgBot.registry().Chat(tgBot.context, &llm.ChatRequest{
+		Model: model,
+		Messages: []llm.Message{
+			{Role: llm.RoleSystem, Content: summaryPrompt},
+			{Role: llm.RoleUser, Content: sb.String()},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	text := strings.TrimSpace(answer.Content)
+	if text == "" {
+		return fmt.Errorf("empty summary")
+	}
+
+	tgBot.logger.Infof("Summarized %d messages of chat %d, thread %d", len(old), conv.chatID, conv.threadID)
+	return tgBot.storage.SaveSummary(&types.Summary{
+		ChatId:    conv.chatID,
+		ThreadId:  conv.threadID,
+		Text:      text,
+		Tokens:    llm.EstimateTokens(text),
+		UpdatedAt: time.Now(),
+	}, old[len(old)-1].Id)
+}
+
+// CmdSummary handles the "/summary" command: shows what the bot remembers about the
+// conversation in the chat or forum topic; "/summary clear" forgets it.
+func (tgBot *TgBot) CmdSummary(update *models.Update) {
+	if tgBot.UserWithPermission(update, types.CanChat) == nil {
+		return
+	}
+	conv := tgBot.ConversationOf(update.Message)
+	chatID := conv.chatID
+
+	if strings.ToLower(CommandArgs(update.Message.Text)) == "clear" {
+		keyboard, err := tgBot.callbackCodec.ConfirmKeyboard(callbackSummaryClear)
+		if err != nil {
+			tgBot.logger.Errorf("Failed to create keyboard: %v", err)
+			return
+		}
+		tgBot.ReplyWithKeyboard(update, "Forget the conversation?", keyboard)
+		return
+	}
+
+	summary, err := tgBot.storage.GetSummary(conv.chatID, conv.threadID)
+	if err != nil {
+		tgBot.logger.Errorf("Failed to get summary of chat %d: %v", chatID, err)
+		tgBot.Reply(update, "Failed to get the summary.")
+		return
+	}
+	history, err := tgBot.storage.GetHistory(conv.chatID, conv.threadID)
+	if err != nil {
+		tgBot.logger.Errorf("Failed to get history of chat %d: %v", chatID, err)
+		tgBot.Reply(update, "Failed to get the history.")
+		return
+	}
+
+	var sb strings.Builder
+	if summary != nil {
+		sb.WriteString(summaryIntro + summary.Text + "\n\n")
+		fmt.Fprintf(&sb, "(updated %s)\n", summary.UpdatedAt.Format("2006-01-02 15:04"))
+	} else {
+		sb.WriteString("There is no summary yet.\n")
+	}
+	fmt.Fprintf(&sb, "Recent messages remembered verbatim: %d (~%d of %d tokens).\n",
+		len(history), historyTokens(history), tgBot.config().HistoryMaxTokens)
+	sb.WriteString("Use /summary clear to forget the conversation.")
+	for _, part := range SplitMessage(sb.String(), maxMessageLength) {
+		tgBot.Reply(update, part)
+	}
+}
+
+// CallbackSummaryClear forgets the conversation once "/summary clear" is confirmed.
+func (tgBot *TgBot) CallbackSummaryClear(cb *Callback) {
+	if cb.Message == nil {
+		cb.Alert("This button is no longer valid.")
+		return
+	}
+	text := "The conversation is kept."
+	if cb.Confirmed() {
+		conv := tgBot.ConversationOf(cb.Message)
+		text = "The conversation is forgotten."
+		if err := tgBot.storage.ClearHistory(conv.chatID, conv.threadID); err != nil {
+			tgBot.logger.Errorf("Failed to clear history of chat %d: %v", conv.chatID, err)
+			text = "Failed to forget the conversation."
+		}
+	}
+	tgBot.EditCallbackMessage(cb, text, nil)
+}
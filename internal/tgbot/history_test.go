@@ -0,0 +1,32 @@
+package tgbot
+
+import (
+	"testing"
+
+	"gourbot/internal/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitHistory(t *testing.T) {
+	var history []*types.HistoryMessage
+	for _, tokens := range []int{10, 20, 30, 40} {
+		history = append(history, &types.HistoryMessage{Tokens: tokens})
+	}
+
+	old, recent := SplitHistory(history, 75)
+	assert.Len(t, old, 2)
+	assert.Len(t, recent, 2, "the newest messages fitting into the limit should be kept")
+
+	old, recent = SplitHistory(history, 100)
+	assert.Empty(t, old)
+	assert.Len(t, recent, 4)
+
+	old, recent = SplitHistory(history, 39)
+	assert.Len(t, old, 4, "a message exceeding the limit should be summarized")
+	assert.Empty(t, recent)
+
+	old, recent = SplitHistory(nil, 10)
+	assert.Empty(t, old)
+	assert.Empty(t, recent)
+}
@@ -0,0 +1,181 @@
+package tgbot
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"gourbot/internal/llm"
+	"gourbot/internal/types"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+const (
+	// inlineAnswerTimeout limits the LLM call, as Telegram drops unanswered inline queries soon.
+	inlineAnswerTimeout = 8 * time.Second
+	// inlineCacheTime is how long Telegram may cache the results of an inline query, in seconds.
+	inlineCacheTime = 60
+	// inlineTitleLength and inlineDescriptionLength limit the texts of an inline result in runes.
+	inlineTitleLength       = 64
+	inlineDescriptionLength = 200
+	// inlineSystemPrompt tells the model its answer is sent into a chat as is.
+	inlineSystemPrompt = "You answer inline queries: your answer is sent into a chat on behalf of the user. " +
+		"Answer briefly and to the point, without greetings or follow-up questions."
+)
+
+// isInlineQuery matches inline queries.
+func isInlineQuery(update *models.Update) bool {
+	return update.InlineQuery != nil
+}
+
+// isChosenInlineResult matches the reports about inline results sent by users.
+func isChosenInlineResult(update *models.Update) bool {
+	return update.ChosenInlineResult != nil
+}
+
+// InlineHandler answers an inline query with the LLM. Telegram sends a query for every
+// keystroke, so the query is answered in the background once the user stops typing
+// for GOURBOT_INLINE_DEBOUNCE milliseconds; superseded queries are never answered.
+func (tgBot *TgBot) InlineHandler(update *models.Update) {
+	query := update.InlineQuery
+	if strings.TrimSpace(query.Query) == "" {
+		tgBot.AnswerInlineQuery(query.ID, nil)
+		return
+	}
+	tgBot.inlinePending.Store(query.From.ID, query.ID)
+	tgBot.wgWorkers.Add(1)
+	go func() {
+		defer tgBot.wgWorkers.Done()
+		select {
+		case <-time.After(time.Duration(tgBot.config().InlineDebounce) * time.Millisecond):
+		case <-tgBot.context.Done():
+			return
+		}
+		if !tgBot.inlinePending.CompareAndDelete(query.From.ID, query.ID) {
+			return // The user kept typing
+		}
+		tgBot.answerInline(query)
+	}()
+}
+
+// answerInline answers the inline query with a single article holding the LLM's answer.
+func (tgBot *TgBot) answerInline(query *models.InlineQuery) {
+	text := strings.TrimSpace(query.Query)
+	user, err := tgBot.storage.GetTgUser(query.From.ID)
+	if err != nil {
+		tgBot.logger.Errorf("Failed to retrieve user: %v", err)
+		return
+	}
+	answer, err := tgBot.InlineAnswer(user, text)
+	if err != nil {
+		tgBot.logger.Errorf("Failed to answer inline query of user %d: %v", user.Id, err)
+		tgBot.AnswerInlineQuery(query.ID, nil)
+		return
+	}
+	tgBot.AnswerInlineQuery(query.ID, []models.InlineQueryResult{
+		&models.InlineQueryResultArticle{
+			ID:          strconv.FormatInt(answer.Id, 10),
+			Title:       TruncateMessage(text, inlineTitleLength),
+			Description: TruncateMessage(answer.Answer, inlineDescriptionLength),
+			InputMessageContent: &models.InputTextMessageContent{
+				MessageText: TruncateMessage(answer.Answer, maxMessageLength),
+			},
+		},
+	})
+}
+
+// InlineAnswer returns an answer of the user's model to the query. An answer of the same
+// model with the same system prompt to the same query generated within
+// GOURBOT_INLINE_CACHE_TTL minutes is reused for free; otherwise the LLM is asked if the
+// user's quota allows it and the answer is charged right away, whether it is sent or not.
+// The answer is stored, its ID identifies the inline result.
+func (tgBot *TgBot) InlineAnswer(user *types.TgUser, text string) (*types.InlineAnswer, error) {
+	req := tgBot.ChatRequest(user.Id, user.Id, []llm.Message{
+		{Role: llm.RoleSystem, Content: inlineSystemPrompt},
+		{Role: llm.RoleUser, Content: text},
+	})
+	provider, model, err := tgBot.registry().Resolve(req.Model)
+	if err != nil {
+		return nil, err
+	}
+	ref := provider.Name() + "/" + model
+	promptHash := PromptHash(req)
+
+	since := time.Now().Add(-time.Duration(tgBot.config().InlineCacheTTL) * time.Minute)
+	cached, err := tgBot.storage.FindInlineAnswer(text, ref, promptHash, since)
+	if err != nil {
+		tgBot.logger.Errorf("Failed to look up cached inline answer: %v", err)
+	}
+	if cached != nil {
+		answer := types.NewInlineAnswer(user.Id, text, ref, promptHash, cached.Answer, 0)
+		return answer, tgBot.storage.AddInlineAnswer(answer)
+	}
+
+	if ok, message := tgBot.CheckQuota(user); !ok {
+		return nil, errors.New(message)
+	}
+	ctx, cancel := context.WithTimeout(tgBot.context, inlineAnswerTimeout)
+	defer cancel()
+	msg, err := tgBot.registry().Chat(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(msg.Content) == "" {
+		return nil, errors.New("empty answer")
+	}
+	cost := tgBot.ChargeChat(user.Id, req, msg.Content)
+	answer := types.NewInlineAnswer(user.Id, text, ref, promptHash, msg.Content, cost)
+	return answer, tgBot.storage.AddInlineAnswer(answer)
+}
+
+// PromptHash identifies what besides the query shapes an answer to it: the system
+// messages of the request, such as the user's persona, and its temperature.
+func PromptHash(req *llm.ChatRequest) string {
+	hash := sha256.New()
+	for _, message := range req.Messages {
+		if message.Role == llm.RoleSystem {
+			hash.Write([]byte(message.Content))
+			hash.Write([]byte{0})
+		}
+	}
+	if req.Temperature != nil {
+		hash.Write([]byte(strconv.FormatFloat(*req.Temperature, 'g', -1, 64)))
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:16]
+}
+
+// ChosenInlineHandler records that a user sent an inline answer.
+func (tgBot *TgBot) ChosenInlineHandler(update *models.Update) {
+	result := update.ChosenInlineResult
+	id, err := strconv.ParseInt(result.ResultID, 10, 64)
+	if err != nil {
+		tgBot.logger.Warnf("Unknown inline result %q", result.ResultID)
+		return
+	}
+	if err := tgBot.storage.MarkInlineAnswerChosen(id, time.Now()); err != nil {
+		tgBot.logger.Errorf("Failed to mark inline answer %d chosen: %v", id, err)
+	}
+}
+
+// AnswerInlineQuery sends the results of an inline query; no results tell the client
+// there is nothing to offer.
+func (tgBot *TgBot) AnswerInlineQuery(queryID string, results []models.InlineQueryResult) {
+	if results == nil {
+		results = []models.InlineQueryResult{}
+	}
+	_, err := tgBot.bot.AnswerInlineQuery(tgBot.context, &bot.AnswerInlineQueryParams{
+		InlineQueryID: queryID,
+		Results:       results,
+		CacheTime:     inlineCacheTime,
+		IsPersonal:    true,
+	})
+	if err != nil {
+		tgBot.logger.Warnf("AnswerInlineQuery failed: %v", err)
+	}
+}
@@ -0,0 +1,30 @@
+package tgbot
+
+import (
+	"testing"
+
+	"gourbot/internal/llm"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPromptHash(t *testing.T) {
+	request := func(system string, temperature *float64, question string) *llm.ChatRequest {
+		return &llm.ChatRequest{
+			Model:       "gpt-4o-mini",
+			Temperature: temperature,
+			Messages: []llm.Message{
+				{Role: llm.RoleSystem, Content: inlineSystemPrompt},
+				{Role: llm.RoleSystem, Content: system},
+				{Role: llm.RoleUser, Content: question},
+			},
+		}
+	}
+	warm := 1.2
+	pirate := PromptHash(request("You are a pirate.", nil, "capital of France"))
+
+	assert.Len(t, pirate, 16)
+	assert.Equal(t, pirate, PromptHash(request("You are a pirate.", nil, "capital of Spain")), "the question is not part of the hash")
+	assert.NotEqual(t, pirate, PromptHash(request("You are a butler.", nil, "capital of France")), "personas differ")
+	assert.NotEqual(t, pirate, PromptHash(request("You are a pirate.", &warm, "capital of France")), "temperatures differ")
+}
@@ -0,0 +1,101 @@
+package tgbot
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/go-telegram/bot/models"
+)
+
+// Answers of a confirm/cancel keyboard, passed as the first callback argument.
+const (
+	confirmYes = "y"
+	confirmNo  = "n"
+)
+
+// Button creates an inline keyboard button calling back the route with the arguments.
+func (c *CallbackCodec) Button(text, route string, args ...string) (models.InlineKeyboardButton, error) {
+	data, err := c.Encode(route, args...)
+	return models.InlineKeyboardButton{Text: text, CallbackData: data}, err
+}
+
+// ConfirmKeyboard creates a keyboard with "Confirm" and "Cancel" buttons for the route.
+// The handler gets the answer as the first argument, see Callback.Confirmed, followed by args.
+func (c *CallbackCodec) ConfirmKeyboard(route string, args ...string) (*models.InlineKeyboardMarkup, error) {
+	yes, err := c.Button("✅ Confirm", route, append([]string{confirmYes}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	no, err := c.Button("❌ Cancel", route, append([]string{confirmNo}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	return &models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{{yes, no}}}, nil
+}
+
+// Confirmed reports whether the "Confirm" button of a ConfirmKeyboard was pressed.
+func (cb *Callback) Confirmed() bool {
+	return cb.Arg(0) == confirmYes
+}
+
+// PageKeyboard creates the navigation row of a paginated list: buttons to the previous
+// and the next page around the page counter. Pages are numbered from zero and passed to
+// the route as the first argument, see Callback.Page. A single page needs no keyboard,
+// so nil is returned for it.
+func (c *CallbackCodec) PageKeyboard(route string, page, pages int, args ...string) (*models.InlineKeyboardMarkup, error) {
+	if pages <= 1 {
+		return nil, nil
+	}
+	button := func(text string, target int) (models.InlineKeyboardButton, error) {
+		return c.Button(text, route, append([]string{strconv.Itoa(target)}, args...)...)
+	}
+	var row []models.InlineKeyboardButton
+	if page > 0 {
+		prev, err := button("« Prev", page-1)
+		if err != nil {
+			return nil, err
+		}
+		row = append(row, prev)
+	}
+	counter, err := c.Button(fmt.Sprintf("%d/%d", page+1, pages), callbackNoop)
+	if err != nil {
+		return nil, err
+	}
+	row = append(row, counter)
+	if page < pages-1 {
+		next, err := button("Next »", page+1)
+		if err != nil {
+			return nil, err
+		}
+		row = append(row, next)
+	}
+	return &models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{row}}, nil
+}
+
+// Page returns the page requested by a PageKeyboard button.
+func (cb *Callback) Page() int {
+	page, _ := strconv.Atoi(cb.Arg(0))
+	return page
+}
+
+// Paginate returns the bounds of a page of total items and the number of pages.
+// The page is clamped to the existing ones.
+func Paginate(total, page, perPage int) (start, end, clamped, pages int) {
+	pages = (total + perPage - 1) / perPage
+	if pages == 0 {
+		pages = 1
+	}
+	clamped = page
+	if clamped >= pages {
+		clamped = pages - 1
+	}
+	if clamped < 0 {
+		clamped = 0
+	}
+	start = clamped * perPage
+	end = start + perPage
+	if end > total {
+		end = total
+	}
+	return start, end, clamped, pages
+}
@@ -0,0 +1,160 @@
+package tgbot
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gourbot/internal/types"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// ErrChatUnavailable is returned when sending to a chat the bot was removed from
+// or to a user who blocked the bot.
+var ErrChatUnavailable = errors.New("the bot was blocked or removed from the chat")
+
+// allowedUpdates lists the updates the bot receives. chat_member updates are not sent
+// by Telegram unless requested explicitly.
+var allowedUpdates = bot.AllowedUpdates{
+	models.AllowedUpdateMessage,
+	models.AllowedUpdateCallbackQuery,
+	models.AllowedUpdateInlineQuery,
+	models.AllowedUpdateChosenInlineResult,
+	models.AllowedUpdateMyChatMember,
+	models.AllowedUpdateChatMember,
+}
+
+// DisplayName returns the username of a Telegram user or, if there is none, the full name.
+func DisplayName(user *models.User) string {
+	if user.Username != "" {
+		return user.Username
+	}
+	return strings.TrimSpace(user.FirstName + " " + user.LastName)
+}
+
+// MemberStatus returns the status of a chat member and the member's user.
+func MemberStatus(member *models.ChatMember) (string, *models.User) {
+	switch {
+	case member.Owner != nil:
+		return types.StatusOwner, member.Owner.User
+	case member.Administrator != nil:
+		return types.StatusAdministrator, &member.Administrator.User
+	case member.Member != nil:
+		return types.StatusMember, member.Member.User
+	case member.Restricted != nil:
+		return types.StatusRestricted, member.Restricted.User
+	case member.Left != nil:
+		return types.StatusLeft, member.Left.User
+	case member.Banned != nil:
+		return types.StatusKicked, member.Banned.User
+	}
+	return string(member.Type), nil
+}
+
+// isMembershipUpdate matches the my_chat_member and chat_member updates.
+func isMembershipUpdate(update *models.Update) bool {
+	return update.MyChatMember != nil || update.ChatMember != nil
+}
+
+// MembershipHandler records membership transitions in chats and reacts to the bot being
+// added to or removed from a group, or blocked and unblocked by a user.
+func (tgBot *TgBot) MembershipHandler(update *models.Update) {
+	if update.ChatMember != nil {
+		tgBot.recordMembershipChange(update.ChatMember)
+	}
+	if update.MyChatMember != nil {
+		tgBot.botMembershipChanged(update.MyChatMember)
+	}
+}
+
+// recordMembershipChange stores the transition and returns the old and the new status.
+func (tgBot *TgBot) recordMembershipChange(u *models.ChatMemberUpdated) (string, string) {
+	oldStatus, _ := MemberStatus(&u.OldChatMember)
+	newStatus, member := MemberStatus(&u.NewChatMember)
+	var memberID int64
+	if member != nil {
+		memberID = member.ID
+	}
+	change := types.NewMembershipChange(u.Chat.ID, memberID, u.From.ID, oldStatus, newStatus)
+	if err := tgBot.storage.AddMembershipChange(change); err != nil {
+		tgBot.logger.Errorf("Failed to record membership change in chat %d: %v", u.Chat.ID, err)
+	}
+	return oldStatus, newStatus
+}
+
+// botMembershipChanged handles a change of the bot's own status in a chat.
+func (tgBot *TgBot) botMembershipChanged(u *models.ChatMemberUpdated) {
+	chat, _, err := tgBot.trackChat(&u.Chat)
+	if err != nil {
+		tgBot.logger.Errorf("Failed to track chat %d: %v", u.Chat.ID, err)
+		return
+	}
+	oldStatus, newStatus := tgBot.recordMembershipChange(u)
+	if err := tgBot.storage.SetTgChatStatus(chat.Id, newStatus); err != nil {
+		tgBot.logger.Errorf("Failed to store the bot status in chat %d: %v", chat.Id, err)
+	}
+	wasPresent, isPresent := types.IsPresentStatus(oldStatus), types.IsPresentStatus(newStatus)
+
+	if u.Chat.Type == models.ChatTypePrivate {
+		switch {
+		case newStatus == types.StatusKicked:
+			tgBot.logger.Infof("User %d blocked the bot", chat.Id)
+		case oldStatus == types.StatusKicked:
+			tgBot.logger.Infof("User %d unblocked the bot", chat.Id)
+		}
+		return
+	}
+
+	by := fmt.Sprintf("%s (%d)", DisplayName(&u.From), u.From.ID)
+	switch {
+	case isPresent && !wasPresent:
+		message := fmt.Sprintf("Bot was added to %s (%s), ID: %d, by %s.", chat.Title, chat.Type, chat.Id, by)
+		if len(chat.Permissions) == 0 {
+			if tgBot.config().LeaveUnapproved && !tgBot.IsAllowed(u.From.ID) {
+				tgBot.LeaveChat(chat.Id)
+				message += " The chat is not approved, so the bot left it."
+			} else {
+				message += fmt.Sprintf(" To approve, use /chat_approve %d", chat.Id)
+			}
+		}
+		tgBot.Notify(types.NotifySecurity, message)
+	case wasPresent && !isPresent:
+		tgBot.Notify(types.NotifySecurity, fmt.Sprintf("Bot was removed from %s (%s), ID: %d, by %s.", chat.Title, chat.Type, chat.Id, by))
+	}
+}
+
+// LeaveChat makes the bot leave a group.
+func (tgBot *TgBot) LeaveChat(chatID int64) {
+	tgBot.wgWorkers.Add(1)
+	defer tgBot.wgWorkers.Done()
+	if _, err := tgBot.bot.LeaveChat(tgBot.context, &bot.LeaveChatParams{ChatID: chatID}); err != nil {
+		tgBot.logger.Errorf("LeaveChat failed: %v", err)
+	}
+}
+
+// checkRecipient returns ErrChatUnavailable if messages cannot be delivered to the chat.
+func (tgBot *TgBot) checkRecipient(chatID any) error {
+	id, ok := chatID.(int64)
+	if !ok {
+		return nil // Channel usernames are not tracked
+	}
+	if chat := tgBot.ChatByID(id); chat != nil && chat.BotRemoved() {
+		return ErrChatUnavailable
+	}
+	return nil
+}
+
+// checkSendError marks the chat as unavailable if Telegram refused to deliver a message
+// because the user blocked the bot or the bot was removed from the group.
+func (tgBot *TgBot) checkSendError(chatID any, err error) {
+	id, ok := chatID.(int64)
+	if !ok || !errors.Is(err, bot.ErrorForbidden) {
+		return
+	}
+	tgBot.logger.Infof("Chat %d is unavailable, stop sending to it", id)
+	if err := tgBot.storage.SetTgChatStatus(id, types.StatusKicked); err != nil {
+		tgBot.logger.Errorf("Failed to store the bot status in chat %d: %v", id, err)
+	}
+}
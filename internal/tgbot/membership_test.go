@@ -0,0 +1,32 @@
+package tgbot
+
+import (
+	"testing"
+
+	"gourbot/internal/types"
+
+	"github.com/go-telegram/bot/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemberStatus(t *testing.T) {
+	user := &models.User{ID: 42, Username: "alice"}
+
+	status, member := MemberStatus(&models.ChatMember{Type: models.ChatMemberTypeMember, Member: &models.ChatMemberMember{User: user}})
+	assert.Equal(t, types.StatusMember, status)
+	assert.Equal(t, user, member)
+
+	status, member = MemberStatus(&models.ChatMember{Type: models.ChatMemberTypeAdministrator, Administrator: &models.ChatMemberAdministrator{User: *user}})
+	assert.Equal(t, types.StatusAdministrator, status)
+	assert.Equal(t, int64(42), member.ID)
+
+	status, _ = MemberStatus(&models.ChatMember{Type: models.ChatMemberTypeBanned, Banned: &models.ChatMemberBanned{User: user}})
+	assert.Equal(t, types.StatusKicked, status)
+	assert.False(t, types.IsPresentStatus(status))
+}
+
+func TestDisplayName(t *testing.T) {
+	assert.Equal(t, "alice", DisplayName(&models.User{Username: "alice", FirstName: "Alice"}))
+	assert.Equal(t, "Alice Smith", DisplayName(&models.User{FirstName: "Alice", LastName: "Smith"}))
+	assert.Equal(t, "Alice", DisplayName(&models.User{FirstName: "Alice"}))
+}
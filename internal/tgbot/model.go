@@ -0,0 +1,95 @@
+package tgbot
+
+import (
+	"strings"
+
+	"gourbot/internal/types"
+
+	"github.com/go-telegram/bot/models"
+)
+
+// SelectedModel returns the model reference chosen for the chat, falling back to the
+// user's choice. An empty result means the registry default model. Choices which no
+// longer resolve (e.g. the provider was removed from the config) are ignored.
+func (tgBot *TgBot) SelectedModel(chatID, userID int64) string {
+	model, err := tgBot.storage.GetChatSetting(chatID, types.SettingModel)
+	if err != nil {
+		tgBot.logger.Errorf("Failed to get model of chat %d: %v", chatID, err)
+	}
+	if model == "" {
+		user, err := tgBot.storage.GetTgUser(userID)
+		if err != nil {
+			tgBot.logger.Errorf("Failed to retrieve user: %v", err)
+			return ""
+		}
+		model = user.GetSetting(types.SettingModel)
+	}
+	if model == "" {
+		return ""
+	}
+	if _, _, err := tgBot.registry().Resolve(model); err != nil {
+		tgBot.logger.Warnf("Ignore selected model of chat %d, user %d: %v", chatID, userID, err)
+		return ""
+	}
+	return model
+}
+
+// CmdModel handles the "/model" command: lists the available models or selects one.
+// In private chats the choice is stored for the user, in groups for the whole chat.
+func (tgBot *TgBot) CmdModel(update *models.Update) {
+	user := tgBot.UserWithPermission(update, types.CanChat)
+	if user == nil {
+		return
+	}
+	chatID := update.Message.Chat.ID
+	private := update.Message.Chat.Type == models.ChatTypePrivate
+	arg := CommandArgs(update.Message.Text)
+
+	if arg == "" {
+		current := tgBot.SelectedModel(chatID, user.Id)
+		if current == "" {
+			current = tgBot.registry().DefaultModel() + " (default)"
+		}
+		var sb strings.Builder
+		sb.WriteString("Current model: " + current + "\nAvailable models:\n")
+		for _, p := range tgBot.registry().Providers() {
+			if len(p.Models()) == 0 {
+				sb.WriteString("- " + p.Name() + "/<any model>\n")
+				continue
+			}
+			for _, model := range p.Models() {
+				sb.WriteString("- " + p.Name() + "/" + model + "\n")
+			}
+		}
+		sb.WriteString("Use /model <model> to select one or /model default to reset.")
+		tgBot.Reply(update, sb.String())
+		return
+	}
+
+	model := arg
+	if strings.ToLower(arg) == "default" {
+		model = ""
+	} else if p, name, err := tgBot.registry().Resolve(arg); err != nil {
+		tgBot.Reply(update, "Bad model: "+err.Error())
+		return
+	} else {
+		model = p.Name() + "/" + name
+	}
+
+	var err error
+	if private {
+		user.SetSetting(types.SettingModel, model)
+		err = tgBot.storage.UpdateTgUser(user)
+	} else {
+		err = tgBot.storage.SetChatSetting(chatID, types.SettingModel, model)
+	}
+	if err != nil {
+		tgBot.logger.Errorf("Failed to save model for chat %d: %v", chatID, err)
+		tgBot.Reply(update, "Failed to save the model.")
+		return
+	}
+	if model == "" {
+		model = tgBot.registry().DefaultModel()
+	}
+	tgBot.Reply(update, "Model "+model+" selected.")
+}
@@ -0,0 +1,238 @@
+package tgbot
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"gourbot/internal/config"
+	"gourbot/internal/types"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+const notifyUsage = "Usage: /notify [<category>|all] [instant|digest|off]\nCategories: lifecycle, new_user, error, quota, security"
+
+// Notify sends an event of the category to the admin group, or to every master and admin
+// if there is none. Each recipient chooses with /notify whether the category is sent right
+// away, collected for the digest or dropped.
+func (tgBot *TgBot) Notify(category, message string) {
+	tgBot.logger.Infof("Notify %s: %s", category, message)
+	for _, chatID := range NotifyTargets(tgBot.config()) {
+		switch tgBot.notifyMode(chatID, category) {
+		case types.NotifyInstant:
+			tgBot.sendNotification(chatID, message)
+		case types.NotifyDigest:
+			if err := tgBot.storage.AddNotification(types.NewNotification(chatID, category, message)); err != nil {
+				tgBot.logger.Errorf("Failed to queue notification for %d: %v", chatID, err)
+				tgBot.sendNotification(chatID, message)
+			}
+		}
+	}
+}
+
+// sendNotification sends a notification to a recipient.
+func (tgBot *TgBot) sendNotification(chatID int64, message string) {
+	_, err := tgBot.SendMessage(&bot.SendMessageParams{
+		ChatID: chatID,
+		Text:   message,
+	})
+	if err != nil {
+		tgBot.logger.Errorf("Notify %d failed: %v", chatID, err)
+	} else {
+		tgBot.logger.Infof("Notify sent to %d", chatID)
+	}
+}
+
+// notifyMode returns the delivery mode of the category chosen by the recipient, a user or
+// the admin group.
+func (tgBot *TgBot) notifyMode(chatID int64, category string) string {
+	var setting string
+	if chatID < 0 {
+		setting, _ = tgBot.storage.GetChatSetting(chatID, types.NotifySetting(category))
+	} else if user, err := tgBot.storage.GetTgUser(chatID); err == nil {
+		setting = user.GetSetting(types.NotifySetting(category))
+	}
+	return types.NotifyMode(category, setting)
+}
+
+// setNotifyMode stores the delivery mode of the categories for the recipient.
+func (tgBot *TgBot) setNotifyMode(chatID int64, categories []string, mode string) error {
+	if chatID < 0 {
+		for _, category := range categories {
+			if err := tgBot.storage.SetChatSetting(chatID, types.NotifySetting(category), mode); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	user, err := tgBot.storage.GetTgUser(chatID)
+	if err != nil {
+		return err
+	}
+	for _, category := range categories {
+		user.SetSetting(types.NotifySetting(category), mode)
+	}
+	return tgBot.storage.UpdateTgUser(user)
+}
+
+// ParseNotifyArgs parses the arguments of /notify: no arguments show the settings,
+// otherwise a category or "all" and a mode.
+func ParseNotifyArgs(args string) ([]string, string, error) {
+	fields := strings.Fields(strings.ToLower(args))
+	switch {
+	case len(fields) == 0:
+		return nil, "", nil
+	case len(fields) != 2:
+		return nil, "", fmt.Errorf("expected a category and a mode")
+	}
+	categories := []string{fields[0]}
+	if fields[0] == "all" {
+		categories = types.NotifyCategories
+	} else if !slices.Contains(types.NotifyCategories, fields[0]) {
+		return nil, "", fmt.Errorf("unknown category %q", fields[0])
+	}
+	if !slices.Contains(types.NotifyModes, fields[1]) {
+		return nil, "", fmt.Errorf("unknown mode %q", fields[1])
+	}
+	return categories, fields[1], nil
+}
+
+// CmdNotify handles the "/notify" command which shows or sets how the notifications of
+// each category are delivered: to the sender, or to the admin group when used there.
+func (tgBot *TgBot) CmdNotify(update *models.Update) {
+	cfg := tgBot.config()
+	recipient, whose := update.Message.From.ID, "your"
+	switch {
+	case cfg.AdminChatID != 0 && update.Message.Chat.ID == cfg.AdminChatID:
+		if tgBot.UserWithPermission(update, types.CanManageUsers) == nil {
+			return
+		}
+		recipient, whose = cfg.AdminChatID, "this group's"
+	case cfg.AdminChatID != 0 && slices.Contains(append(slices.Clone(cfg.MasterUIDs), cfg.AdminUIDs...), recipient):
+		tgBot.Reply(update, "Notifications go to the admin group, use /notify there.")
+		return
+	case !slices.Contains(NotifyTargets(cfg), recipient):
+		tgBot.Reply(update, "You do not get notifications, they are for masters and admins.")
+		return
+	}
+
+	categories, mode, err := ParseNotifyArgs(CommandArgs(update.Message.Text))
+	if err != nil {
+		tgBot.Reply(update, err.Error()+"\n\n"+notifyUsage)
+		return
+	}
+	if categories != nil {
+		if err := tgBot.setNotifyMode(recipient, categories, mode); err != nil {
+			tgBot.logger.Errorf("Failed to store notification settings of %d: %v", recipient, err)
+			tgBot.Reply(update, "Failed to change the notification settings.")
+			return
+		}
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Notifications, %s settings:\n", whose)
+	for _, category := range types.NotifyCategories {
+		fmt.Fprintf(&sb, "- %s: %s\n", category, tgBot.notifyMode(recipient, category))
+	}
+	if job := tgBot.digestJob(); job != nil {
+		fmt.Fprintf(&sb, "\nThe next digest is due %s.", tgBot.formatJobTime(job, job.NextRunAt))
+	}
+	tgBot.Reply(update, sb.String()+"\n\n"+notifyUsage)
+}
+
+// digestJob returns the job of the notification digest, or nil if there is none.
+func (tgBot *TgBot) digestJob() *types.Job {
+	return tgBot.systemJob(types.JobDigest)
+}
+
+// scheduleDigest keeps the digest job on the schedule of GOURBOT_NOTIFY_DIGEST.
+func (tgBot *TgBot) scheduleDigest(cfg *config.Config) {
+	tgBot.scheduleSystemJob(types.JobDigest, cfg.NotifyDigest, cfg)
+}
+
+// systemJob returns the recurring job of the bot itself of the given kind, or nil if
+// there is none. Such jobs belong to user 0.
+func (tgBot *TgBot) systemJob(kind string) *types.Job {
+	jobs, err := tgBot.storage.GetUserJobs(0, kind)
+	if err != nil {
+		tgBot.logger.Errorf("Failed to get the %s job: %v", kind, err)
+		return nil
+	}
+	if len(jobs) == 0 {
+		return nil
+	}
+	return jobs[0]
+}
+
+// scheduleSystemJob keeps the job of the bot itself of the given kind on the schedule of
+// the cron expression in the configured time zone; an empty expression deletes the job.
+func (tgBot *TgBot) scheduleSystemJob(kind, cron string, cfg *config.Config) {
+	timezone := cfg.Timezone
+	if timezone == "" {
+		timezone = time.Local.String()
+	}
+	job := tgBot.systemJob(kind)
+	var err error
+	switch {
+	case cron == "":
+		if job != nil {
+			_, err = tgBot.storage.DeleteJob(job.Id)
+		}
+	case job == nil:
+		job = types.NewJob(kind, 0, 0, 0, "", cron, timezone, time.Time{})
+		job.NextRunAt = NextJobRun(job, time.Now())
+		err = tgBot.storage.AddJob(job)
+	case job.Cron != cron || job.Timezone != timezone:
+		job.Cron, job.Timezone = cron, timezone
+		job.NextRunAt = NextJobRun(job, time.Now())
+		err = tgBot.storage.UpdateJob(job)
+	}
+	if err != nil {
+		tgBot.logger.Errorf("Failed to schedule the %s job: %v", kind, err)
+	}
+}
+
+// deliverDigest sends every recipient the notifications collected since the last digest.
+func (tgBot *TgBot) deliverDigest(job *types.Job, late time.Duration) error {
+	notifications, err := tgBot.storage.TakeNotifications()
+	if err != nil {
+		return err
+	}
+	loc, err := time.LoadLocation(job.Timezone)
+	if err != nil {
+		loc = time.Local
+	}
+	for start := 0; start < len(notifications); {
+		end := start + 1
+		for end < len(notifications) && notifications[end].ChatId == notifications[start].ChatId {
+			end++
+		}
+		chatID := notifications[start].ChatId
+		for _, chunk := range SplitMessage(FormatDigest(notifications[start:end], loc), maxMessageLength) {
+			tgBot.sendNotification(chatID, chunk)
+		}
+		start = end
+	}
+	return nil
+}
+
+// FormatDigest renders the notifications of a recipient grouped by category.
+func FormatDigest(notifications []*types.Notification, loc *time.Location) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Digest of %d notifications", len(notifications))
+	for _, category := range types.NotifyCategories {
+		var entries []string
+		for _, n := range notifications {
+			if n.Category == category {
+				entries = append(entries, n.CreatedAt.In(loc).Format("Jan 02 15:04")+" "+n.Text)
+			}
+		}
+		if len(entries) > 0 {
+			fmt.Fprintf(&sb, "\n\n%s (%d):\n- %s", category, len(entries), strings.Join(entries, "\n- "))
+		}
+	}
+	return sb.String()
+}
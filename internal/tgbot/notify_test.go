@@ -0,0 +1,52 @@
+package tgbot
+
+import (
+	"testing"
+	"time"
+
+	"gourbot/internal/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseNotifyArgs(t *testing.T) {
+	categories, mode, err := ParseNotifyArgs("")
+	assert.NoError(t, err)
+	assert.Nil(t, categories, "no arguments show the settings")
+
+	categories, mode, err = ParseNotifyArgs("Quota Instant")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{types.NotifyQuota}, categories)
+	assert.Equal(t, types.NotifyInstant, mode)
+
+	categories, mode, err = ParseNotifyArgs("all digest")
+	assert.NoError(t, err)
+	assert.Equal(t, types.NotifyCategories, categories)
+	assert.Equal(t, types.NotifyDigest, mode)
+
+	for _, args := range []string{"quota", "weather off", "quota loud", "quota off now"} {
+		_, _, err := ParseNotifyArgs(args)
+		assert.Error(t, err, args)
+	}
+}
+
+func TestNotifyMode(t *testing.T) {
+	assert.Equal(t, types.NotifyInstant, types.NotifyMode(types.NotifyLifecycle, ""))
+	assert.Equal(t, types.NotifyInstant, types.NotifyMode(types.NotifyError, ""), "errors are sent right away by default")
+	assert.Equal(t, types.NotifyDigest, types.NotifyMode(types.NotifyQuota, ""), "quota goes to the digest by default")
+	assert.Equal(t, types.NotifyOff, types.NotifyMode(types.NotifyQuota, types.NotifyOff))
+	assert.Equal(t, "notify_error", types.NotifySetting(types.NotifyError))
+}
+
+func TestFormatDigest(t *testing.T) {
+	at := time.Date(2024, 5, 17, 8, 30, 0, 0, time.UTC)
+	notifications := []*types.Notification{
+		{ChatId: 1, Category: types.NotifyQuota, Text: "alice exceeded the daily quota", CreatedAt: at},
+		{ChatId: 1, Category: types.NotifyError, Text: "LLM request failed", CreatedAt: at.Add(time.Hour)},
+		{ChatId: 1, Category: types.NotifyQuota, Text: "bob exceeded the daily quota", CreatedAt: at.Add(2 * time.Hour)},
+	}
+	assert.Equal(t, "Digest of 3 notifications\n\n"+
+		"error (1):\n- May 17 09:30 LLM request failed\n\n"+
+		"quota (2):\n- May 17 08:30 alice exceeded the daily quota\n- May 17 10:30 bob exceeded the daily quota",
+		FormatDigest(notifications, time.UTC))
+}
@@ -0,0 +1,258 @@
+package tgbot
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gourbot/internal/llm"
+	"gourbot/internal/types"
+
+	"github.com/go-telegram/bot/models"
+)
+
+var personaNameRe = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+// Dialog of the "/persona_new" command.
+const (
+	personaDialog       = "persona"
+	personaStepName     = "name"
+	personaStepPrompt   = "prompt"
+	personaStepConfirm  = "confirm"
+	personaChoiceSave   = "save"
+	personaChoiceCancel = "cancel"
+)
+
+const personaSetUsage = "Usage: /persona_set <name> [model=<model>] [temperature=<0..2>]\n<system prompt on the following lines>"
+
+// ParsePersonaArgs parses /persona_set arguments: the first line holds the name and
+// optional key=value parameters, the following lines hold the system prompt.
+func ParsePersonaArgs(args string) (*types.Persona, error) {
+	header, prompt, _ := strings.Cut(args, "\n")
+	fields := strings.Fields(header)
+	if len(fields) == 0 {
+		return nil, errors.New("persona name is missing")
+	}
+	name := strings.ToLower(fields[0])
+	if !personaNameRe.MatchString(name) {
+		return nil, fmt.Errorf("bad persona name %q: use up to 32 latin letters, digits, '-' or '_'", fields[0])
+	}
+
+	persona := types.NewPersona(name, strings.TrimSpace(prompt), 0)
+	for _, field := range fields[1:] {
+		key, value, found := strings.Cut(field, "=")
+		if !found {
+			return nil, fmt.Errorf("bad parameter %q, expected key=value", field)
+		}
+		switch strings.ToLower(key) {
+		case "model":
+			persona.Model = value
+		case "temperature":
+			temperature, err := strconv.ParseFloat(value, 64)
+			if err != nil || temperature < 0 || temperature > 2 {
+				return nil, fmt.Errorf("bad temperature %q, expected a number from 0 to 2", value)
+			}
+			persona.Temperature = &temperature
+		default:
+			return nil, fmt.Errorf("unknown parameter %q", key)
+		}
+	}
+	if persona.SystemPrompt == "" {
+		return nil, errors.New("system prompt is missing")
+	}
+	return persona, nil
+}
+
+// ChatRequest builds an LLM request for the user in the chat. The model is taken from
+// the chat's persona, the chat setting or the user setting, in that order; the persona's
+// system prompt and temperature are applied as well.
+func (tgBot *TgBot) ChatRequest(chatID, userID int64, messages []llm.Message) *llm.ChatRequest {
+	req := &llm.ChatRequest{Messages: messages, Model: tgBot.SelectedModel(chatID, userID)}
+	persona, err := tgBot.storage.GetChatPersona(chatID)
+	if err != nil {
+		tgBot.logger.Errorf("Failed to get persona of chat %d: %v", chatID, err)
+	}
+	if persona != nil {
+		if persona.Model != "" {
+			req.Model = persona.Model
+		}
+		req.Temperature = persona.Temperature
+		req.Messages = append([]llm.Message{{Role: llm.RoleSystem, Content: persona.SystemPrompt}}, messages...)
+	}
+	return req
+}
+
+// CmdPersona handles the "/persona" command: lists personas or selects one for the chat.
+func (tgBot *TgBot) CmdPersona(update *models.Update) {
+	if tgBot.UserWithPermission(update, types.CanUseRoles) == nil {
+		return
+	}
+	chatID := update.Message.Chat.ID
+	name := strings.ToLower(CommandArgs(update.Message.Text))
+
+	switch name {
+	case "":
+		personas, err := tgBot.storage.GetAllPersonas()
+		if err != nil {
+			tgBot.logger.Errorf("Failed to get personas: %v", err)
+			tgBot.Reply(update, "Failed to get personas.")
+			return
+		}
+		current, _ := tgBot.storage.GetChatPersona(chatID)
+		var sb strings.Builder
+		if current != nil {
+			sb.WriteString("Current persona: " + current.Name + "\n")
+		} else {
+			sb.WriteString("No persona selected.\n")
+		}
+		if len(personas) == 0 {
+			sb.WriteString("There are no personas yet.")
+		} else {
+			sb.WriteString("Available personas:\n")
+			for _, persona := range personas {
+				sb.WriteString("- " + persona.Describe() + "\n")
+			}
+			sb.WriteString("Use /persona <name> to select one or /persona off to reset.")
+		}
+		tgBot.Reply(update, sb.String())
+
+	case "off":
+		if err := tgBot.storage.SetChatPersona(chatID, 0); err != nil {
+			tgBot.logger.Errorf("Failed to reset persona of chat %d: %v", chatID, err)
+			tgBot.Reply(update, "Failed to reset the persona.")
+			return
+		}
+		tgBot.Reply(update, "Persona reset.")
+
+	default:
+		persona, err := tgBot.storage.GetPersona(name)
+		if err == sql.ErrNoRows {
+			tgBot.Reply(update, "Unknown persona "+name+". Use /persona to list them.")
+			return
+		}
+		if err == nil {
+			err = tgBot.storage.SetChatPersona(chatID, persona.Id)
+		}
+		if err != nil {
+			tgBot.logger.Errorf("Failed to select persona %s in chat %d: %v", name, chatID, err)
+			tgBot.Reply(update, "Failed to select the persona.")
+			return
+		}
+		tgBot.Reply(update, "Persona "+persona.Name+" selected.")
+	}
+}
+
+// CmdPersonaSet handles the "/persona_set" command which creates or edits a persona.
+func (tgBot *TgBot) CmdPersonaSet(update *models.Update) {
+	user := tgBot.UserWithPermission(update, types.CanManageRoles)
+	if user == nil {
+		return
+	}
+	persona, err := ParsePersonaArgs(CommandArgs(update.Message.Text))
+	if err != nil {
+		tgBot.Reply(update, err.Error()+"\n"+personaSetUsage)
+		return
+	}
+	if persona.Model != "" {
+		if _, _, err := tgBot.registry().Resolve(persona.Model); err != nil {
+			tgBot.Reply(update, "Bad model: "+err.Error()+". Use /model to list available models.")
+			return
+		}
+	}
+	persona.CreatedBy = user.Id
+	if err := tgBot.storage.SavePersona(persona); err != nil {
+		tgBot.logger.Errorf("Failed to save persona %s: %v", persona.Name, err)
+		tgBot.Reply(update, "Failed to save the persona.")
+		return
+	}
+	tgBot.Reply(update, "Persona "+persona.Describe()+" saved.")
+}
+
+// CmdPersonaDel handles the "/persona_del" command.
+func (tgBot *TgBot) CmdPersonaDel(update *models.Update) {
+	if tgBot.UserWithPermission(update, types.CanManageRoles) == nil {
+		return
+	}
+	name := strings.ToLower(CommandArgs(update.Message.Text))
+	if name == "" {
+		tgBot.Reply(update, "Usage: /persona_del <name>")
+		return
+	}
+	deleted, err := tgBot.storage.DeletePersona(name)
+	switch {
+	case err != nil:
+		tgBot.logger.Errorf("Failed to delete persona %s: %v", name, err)
+		tgBot.Reply(update, "Failed to delete the persona.")
+	case !deleted:
+		tgBot.Reply(update, "Unknown persona "+name+".")
+	default:
+		tgBot.Reply(update, "Persona "+name+" deleted.")
+	}
+}
+
+// CmdPersonaNew handles the "/persona_new" command which creates a persona step by step.
+func (tgBot *TgBot) CmdPersonaNew(update *models.Update) {
+	if tgBot.UserWithPermission(update, types.CanManageRoles) == nil {
+		return
+	}
+	if err := tgBot.StartDialog(update, personaDialog, nil); err != nil {
+		tgBot.logger.Errorf("Failed to start persona dialog: %v", err)
+		tgBot.Reply(update, "Failed to start the dialog.")
+		return
+	}
+	tgBot.Reply(update, "What is the name of the new persona? Use /cancel to stop.")
+}
+
+// personaDialogSteps are the steps of the "/persona_new" dialog.
+func (tgBot *TgBot) personaDialogSteps() map[string]DialogStep {
+	return map[string]DialogStep{
+		personaStepName: func(dc *DialogContext) {
+			name := strings.ToLower(strings.TrimSpace(dc.Text))
+			if !personaNameRe.MatchString(name) {
+				dc.Say("Please send a name of up to 32 latin letters, digits, '-' or '_'.", nil)
+				return
+			}
+			dc.Set(personaStepName, name)
+			dc.Say("What is the system prompt of "+name+"?", nil)
+			dc.Next(personaStepPrompt)
+		},
+		personaStepPrompt: func(dc *DialogContext) {
+			prompt := strings.TrimSpace(dc.Text)
+			if prompt == "" {
+				dc.Say("Please send the system prompt as text.", nil)
+				return
+			}
+			dc.Set(personaStepPrompt, prompt)
+			keyboard, err := tgBot.DialogKeyboard(personaDialog,
+				DialogChoice{Text: "💾 Save", Value: personaChoiceSave},
+				DialogChoice{Text: "❌ Cancel", Value: personaChoiceCancel})
+			if err != nil {
+				tgBot.logger.Errorf("Failed to create keyboard: %v", err)
+				return
+			}
+			dc.Say("Save persona "+dc.Get(personaStepName)+" with this prompt?\n\n"+prompt, keyboard)
+			dc.Next(personaStepConfirm)
+		},
+		personaStepConfirm: func(dc *DialogContext) {
+			switch dc.Button {
+			case personaChoiceSave:
+				persona := types.NewPersona(dc.Get(personaStepName), dc.Get(personaStepPrompt), dc.Dialog.UserId)
+				if err := tgBot.storage.SavePersona(persona); err != nil {
+					tgBot.logger.Errorf("Failed to save persona %s: %v", persona.Name, err)
+					dc.Say("Failed to save the persona.", nil)
+				} else {
+					dc.Say("Persona "+persona.Describe()+" saved. Use /persona "+persona.Name+" to select it.", nil)
+				}
+				dc.Finish()
+			case personaChoiceCancel:
+				dc.Say("Cancelled.", nil)
+				dc.Finish()
+			default:
+				dc.Say("Please press Save or Cancel.", nil)
+			}
+		},
+	}
+}
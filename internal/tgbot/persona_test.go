@@ -0,0 +1,35 @@
+package tgbot
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePersonaArgs(t *testing.T) {
+	persona, err := ParsePersonaArgs("Translator\nTranslate everything\nto English.")
+	assert.NoError(t, err)
+	assert.Equal(t, "translator", persona.Name)
+	assert.Equal(t, "Translate everything\nto English.", persona.SystemPrompt)
+	assert.Empty(t, persona.Model)
+	assert.Nil(t, persona.Temperature)
+
+	persona, err = ParsePersonaArgs("reviewer model=gpt-4o temperature=0.3\nReview the code.")
+	assert.NoError(t, err)
+	assert.Equal(t, "gpt-4o", persona.Model)
+	assert.Equal(t, 0.3, *persona.Temperature)
+
+	errorCases := []string{
+		"",                            // no name
+		"translator",                  // no prompt
+		"bad name!\nprompt",           // bad name
+		"tutor temperature=5\nprompt", // temperature out of range
+		"tutor color=red\nprompt",     // unknown parameter
+		"tutor model\nprompt",         // not a key=value pair
+		"a_very_long_persona_name_exceeding_32\nprompt",
+	}
+	for _, args := range errorCases {
+		_, err := ParsePersonaArgs(args)
+		assert.Error(t, err, "args %q should be rejected", args)
+	}
+}
@@ -0,0 +1,60 @@
+package tgbot
+
+import (
+	"fmt"
+	"time"
+
+	"gourbot/internal/llm"
+	"gourbot/internal/types"
+)
+
+// quotaPeriod is the window the user daily quota applies to.
+const quotaPeriod = 24 * time.Hour
+
+// CheckQuota reports whether the user may spend more money on paid API calls.
+// Users with CanEverything are not limited. If the quota is exhausted, the returned
+// message explains it to the user.
+func (tgBot *TgBot) CheckQuota(user *types.TgUser) (bool, string) {
+	if tgBot.config().UserDailyQuota <= 0 || user.HasPermission(types.CanEverything) {
+		return true, ""
+	}
+	spent, err := tgBot.storage.GetUserCostSince(user.Id, time.Now().Add(-quotaPeriod))
+	if err != nil {
+		tgBot.logger.Errorf("Failed to get usage of user %d: %v", user.Id, err)
+		return false, "Failed to check your quota, try again later."
+	}
+	if spent >= tgBot.config().UserDailyQuota {
+		// Once a day per user, not on every refused request
+		today := time.Now().Format(time.DateOnly)
+		if previous, _ := tgBot.quotaNotified.Swap(user.Id, today); previous != today {
+			tgBot.Notify(types.NotifyQuota, fmt.Sprintf("%s (%d) exceeded the daily quota: spent $%.2f of $%.2f.",
+				user.Name, user.Id, spent, tgBot.config().UserDailyQuota))
+		}
+		return false, fmt.Sprintf("Daily quota exceeded: spent $%.2f of $%.2f.", spent, tgBot.config().UserDailyQuota)
+	}
+	return true, ""
+}
+
+// ChargeUsage records the cost of a paid API call against the user's quota.
+func (tgBot *TgBot) ChargeUsage(userID int64, kind, model string, cost float64) {
+	if err := tgBot.storage.AddUsage(types.NewUsage(userID, kind, model, cost)); err != nil {
+		tgBot.logger.Errorf("Failed to record usage of user %d: %v", userID, err)
+	}
+}
+
+// ChargeChat records the cost of a chat request and its answer against the user's quota,
+// estimated from the tokens of both, and returns it.
+func (tgBot *TgBot) ChargeChat(userID int64, req *llm.ChatRequest, answer string) float64 {
+	provider, model, err := tgBot.registry().Resolve(req.Model)
+	if err != nil {
+		tgBot.logger.Errorf("Failed to resolve model %q to charge user %d: %v", req.Model, userID, err)
+		return 0
+	}
+	inputTokens := 0
+	for i := range req.Messages {
+		inputTokens += llm.EstimateMessageTokens(&req.Messages[i])
+	}
+	cost := llm.ChatPrice(model, inputTokens, llm.EstimateTokens(answer))
+	tgBot.ChargeUsage(userID, types.UsageChat, provider.Name()+"/"+model, cost)
+	return cost
+}
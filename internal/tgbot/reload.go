@@ -0,0 +1,65 @@
+package tgbot
+
+import (
+	"fmt"
+	"strings"
+
+	"gourbot/internal/config"
+	"gourbot/internal/llm"
+	"gourbot/internal/logger"
+	"gourbot/internal/types"
+)
+
+// ApplyConfig switches the running bot to a reloaded configuration: the logger, the LLM
+// providers and everything read per update. Settings which need a restart keep their
+// running values. The master is told what changed.
+func (tgBot *TgBot) ApplyConfig(cfg *config.Config, reason string) {
+	running := tgBot.config()
+	reloadable, restart := running.Diff(cfg)
+	if len(reloadable) == 0 && len(restart) == 0 {
+		tgBot.logger.Infof("Configuration reloaded (%s), nothing changed", reason)
+		return
+	}
+	cfg.KeepRestartSettings(running)
+
+	if changesLLM(reloadable) {
+		registry, err := llm.NewRegistry(cfg)
+		if err != nil {
+			tgBot.logger.Errorf("Failed to reload LLM providers: %v", err)
+			tgBot.Notify(types.NotifyError, fmt.Sprintf("Configuration not reloaded (%s): %v", reason, err))
+			return
+		}
+		tgBot.llm.Store(registry)
+	}
+	logger.Apply(tgBot.logger, cfg)
+	tgBot.cfg.Store(cfg)
+	tgBot.applyAdmins(running, cfg)
+	tgBot.scheduleDigest(cfg)
+	tgBot.scheduleBackup(cfg)
+
+	tgBot.logger.Infof("Configuration reloaded (%s), applied %v, restart required for %v", reason, reloadable, restart)
+	tgBot.Notify(types.NotifyLifecycle, ReloadReport(reason, reloadable, restart))
+}
+
+// ReloadReport tells the master which settings a reload changed.
+func ReloadReport(reason string, reloadable, restart []string) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Configuration reloaded (%s).", reason)
+	if len(reloadable) > 0 {
+		sb.WriteString("\nApplied: " + strings.Join(reloadable, ", "))
+	}
+	if len(restart) > 0 {
+		sb.WriteString("\nChanged but need a restart: " + strings.Join(restart, ", "))
+	}
+	return sb.String()
+}
+
+// changesLLM reports whether any of the changed settings configures the LLM providers.
+func changesLLM(keys []string) bool {
+	for _, key := range keys {
+		if strings.HasPrefix(key, "llm.") {
+			return true
+		}
+	}
+	return false
+}
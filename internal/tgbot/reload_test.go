@@ -0,0 +1,16 @@
+package tgbot
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReloadReport(t *testing.T) {
+	assert.Equal(t, "Configuration reloaded (SIGHUP).\nApplied: llm.openai_model, logging.level\nChanged but need a restart: telegram.token",
+		ReloadReport("SIGHUP", []string{"llm.openai_model", "logging.level"}, []string{"telegram.token"}))
+	assert.Equal(t, "Configuration reloaded (the config file changed).\nApplied: limits.user_daily_quota",
+		ReloadReport("the config file changed", []string{"limits.user_daily_quota"}, nil))
+	assert.True(t, changesLLM([]string{"logging.level", "llm.providers.local.key"}))
+	assert.False(t, changesLLM([]string{"logging.level"}))
+}
@@ -0,0 +1,236 @@
+package tgbot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gourbot/internal/schedule"
+	"gourbot/internal/types"
+
+	"github.com/go-telegram/bot/models"
+)
+
+const (
+	// maxUserReminders limits the number of pending reminders of a user.
+	maxUserReminders = 50
+	// remindersPerPage is the number of reminders listed on a page of /reminders.
+	remindersPerPage = 10
+)
+
+const remindUsage = "Usage: /remind <when> <what>, e.g. /remind tomorrow at 9 to call mom\nTimes I understand:\n" + schedule.Examples
+
+// UserLocation returns the time zone of the user: the one set with /timezone,
+// GOURBOT_TIMEZONE or the server's one.
+func (tgBot *TgBot) UserLocation(user *types.TgUser) *time.Location {
+	for _, name := range []string{user.GetSetting(types.SettingTimezone), tgBot.config().Timezone} {
+		if name == "" {
+			continue
+		}
+		if loc, err := time.LoadLocation(name); err == nil {
+			return loc
+		}
+	}
+	return time.Local
+}
+
+// ScheduleReminder parses "<when> <what>" in the user's time zone and schedules the reminder
+// for the chat.
+func (tgBot *TgBot) ScheduleReminder(user *types.TgUser, chatID int64, threadID int, input string) (*types.Job, error) {
+	jobs, err := tgBot.storage.GetUserJobs(user.Id, types.JobReminder)
+	if err != nil {
+		return nil, err
+	}
+	if len(jobs) >= maxUserReminders {
+		return nil, fmt.Errorf("you already have %d reminders, cancel some with /reminders", len(jobs))
+	}
+	loc := tgBot.UserLocation(user)
+	reminder, err := schedule.ParseReminder(input, time.Now().In(loc))
+	if err != nil {
+		return nil, err
+	}
+	job := types.NewJob(types.JobReminder, user.Id, chatID, threadID, reminder.Text, reminder.Cron, loc.String(), reminder.At)
+	return job, tgBot.storage.AddJob(job)
+}
+
+// describeJob describes a scheduled job for its owner.
+func (tgBot *TgBot) describeJob(job *types.Job) string {
+	text := fmt.Sprintf("#%d %s: %s", job.Id, tgBot.formatJobTime(job, job.NextRunAt), job.Text)
+	if job.Recurring() {
+		text += " (repeats: " + job.Cron + ")"
+	}
+	return text
+}
+
+// CmdRemind handles the "/remind" command which schedules a reminder in the chat.
+func (tgBot *TgBot) CmdRemind(update *models.Update) {
+	user := tgBot.UserWithPermission(update, types.CanChat)
+	if user == nil {
+		return
+	}
+	args := CommandArgs(update.Message.Text)
+	if args == "" {
+		tgBot.Reply(update, remindUsage)
+		return
+	}
+	job, err := tgBot.ScheduleReminder(user, update.Message.Chat.ID, TopicOf(update.Message), args)
+	if err != nil {
+		tgBot.Reply(update, "Cannot set the reminder: "+err.Error()+"\n\n"+remindUsage)
+		return
+	}
+	tgBot.Reply(update, "Okay, I will remind you: "+tgBot.describeJob(job))
+}
+
+// CmdReminders handles the "/reminders" command which lists the user's reminders with
+// buttons to cancel them. In groups only the reminders of the group are listed.
+func (tgBot *TgBot) CmdReminders(update *models.Update) {
+	user := tgBot.UserWithPermission(update, types.CanChat)
+	if user == nil {
+		return
+	}
+	text, keyboard, err := tgBot.remindersPage(user, &update.Message.Chat, 0)
+	if err != nil {
+		tgBot.logger.Errorf("Failed to get reminders of user %d: %v", user.Id, err)
+		tgBot.Reply(update, "Failed to get your reminders.")
+		return
+	}
+	tgBot.ReplyWithKeyboard(update, text, keyboard)
+}
+
+// CallbackReminders shows another page of /reminders.
+func (tgBot *TgBot) CallbackReminders(cb *Callback) {
+	tgBot.showRemindersPage(cb, cb.Page())
+}
+
+// CallbackReminderCancel cancels a reminder listed by /reminders.
+func (tgBot *TgBot) CallbackReminderCancel(cb *Callback) {
+	id, _ := strconv.ParseInt(cb.Arg(0), 10, 64)
+	job, err := tgBot.storage.GetJob(id)
+	switch {
+	case err != nil || job.UserId != cb.User.Id:
+		cb.Alert("This reminder does not exist anymore.")
+	default:
+		if _, err := tgBot.storage.DeleteJob(id); err != nil {
+			tgBot.logger.Errorf("Failed to delete job %d: %v", id, err)
+			cb.Alert("Failed to cancel the reminder.")
+			return
+		}
+		cb.Answer("Reminder #" + cb.Arg(0) + " cancelled.")
+	}
+	page, _ := strconv.Atoi(cb.Arg(1))
+	tgBot.showRemindersPage(cb, page)
+}
+
+// showRemindersPage replaces the /reminders message with the page.
+func (tgBot *TgBot) showRemindersPage(cb *Callback, page int) {
+	if cb.Message == nil {
+		cb.Alert("This list is too old, use /reminders again.")
+		return
+	}
+	text, keyboard, err := tgBot.remindersPage(cb.User, &cb.Message.Chat, page)
+	if err == nil {
+		err = tgBot.EditCallbackMessage(cb, text, keyboard)
+	}
+	if err != nil {
+		tgBot.logger.Errorf("Failed to show reminders of user %d: %v", cb.User.Id, err)
+	}
+}
+
+// remindersPage renders a page of the user's reminders in the chat with cancel buttons.
+func (tgBot *TgBot) remindersPage(user *types.TgUser, chat *models.Chat, page int) (string, *models.InlineKeyboardMarkup, error) {
+	jobs, err := tgBot.storage.GetUserJobs(user.Id, types.JobReminder)
+	if err != nil {
+		return "", nil, err
+	}
+	if IsGroupChat(chat) {
+		var inChat []*types.Job
+		for _, job := range jobs {
+			if job.ChatId == chat.ID {
+				inChat = append(inChat, job)
+			}
+		}
+		jobs = inChat
+	}
+	if len(jobs) == 0 {
+		return "You have no reminders here. Set one with /remind.", nil, nil
+	}
+
+	start, end, page, pages := Paginate(len(jobs), page, remindersPerPage)
+	var sb strings.Builder
+	keyboard := &models.InlineKeyboardMarkup{}
+	var row []models.InlineKeyboardButton
+	for _, job := range jobs[start:end] {
+		sb.WriteString(tgBot.describeJob(job) + "\n")
+		id := strconv.FormatInt(job.Id, 10)
+		button, err := tgBot.callbackCodec.Button("❌ #"+id, callbackReminderCancel, id, strconv.Itoa(page))
+		if err != nil {
+			return "", nil, err
+		}
+		if row = append(row, button); len(row) == 5 {
+			keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, row)
+			row = nil
+		}
+	}
+	if len(row) > 0 {
+		keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, row)
+	}
+	sb.WriteString("Press a button to cancel a reminder.")
+	pager, err := tgBot.callbackCodec.PageKeyboard(callbackReminders, page, pages)
+	if err != nil {
+		return "", nil, err
+	}
+	if pager != nil {
+		keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, pager.InlineKeyboard...)
+	}
+	return sb.String(), keyboard, nil
+}
+
+// CmdTimezone handles the "/timezone" command which shows or sets the user's time zone.
+func (tgBot *TgBot) CmdTimezone(update *models.Update) {
+	user := tgBot.UserWithPermission(update, types.CanChat)
+	if user == nil {
+		return
+	}
+	name := CommandArgs(update.Message.Text)
+	if name == "" {
+		loc := tgBot.UserLocation(user)
+		tgBot.Reply(update, fmt.Sprintf("Your time zone is %s, the time is %s.\nUse /timezone <zone>, e.g. /timezone Europe/Berlin, to change it.",
+			loc, time.Now().In(loc).Format("15:04")))
+		return
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil || name == "Local" {
+		tgBot.Reply(update, "Unknown time zone "+name+". Use a name like Europe/Berlin or America/New_York.")
+		return
+	}
+	user.SetSetting(types.SettingTimezone, loc.String())
+	if err := tgBot.storage.UpdateTgUser(user); err != nil {
+		tgBot.logger.Errorf("Failed to set time zone of user %d: %v", user.Id, err)
+		tgBot.Reply(update, "Failed to set the time zone.")
+		return
+	}
+	tgBot.Reply(update, fmt.Sprintf("Time zone set to %s, the time is %s. Existing reminders keep their time zone.",
+		loc, time.Now().In(loc).Format("15:04")))
+}
+
+func (tgBot *TgBot) toolSetReminder(ctx context.Context, args json.RawMessage) (string, error) {
+	caller, err := callerFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	var params struct {
+		When string `json:"when"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", err
+	}
+	job, err := tgBot.ScheduleReminder(caller.user, caller.chatID, 0, params.When+" "+params.Text)
+	if err != nil {
+		return "", err
+	}
+	return "Reminder set: " + tgBot.describeJob(job), nil
+}
@@ -0,0 +1,164 @@
+package tgbot
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gourbot/internal/schedule"
+	"gourbot/internal/types"
+
+	"github.com/go-telegram/bot"
+)
+
+const (
+	// schedulerInterval is how often due jobs are looked for.
+	schedulerInterval = 15 * time.Second
+	// schedulerBatch limits the number of jobs run at once.
+	schedulerBatch = 100
+	// maxJobAttempts is the number of failed runs in a row after which a run is skipped.
+	maxJobAttempts = 5
+	// jobRetryDelay is the pause before a failed run is retried.
+	jobRetryDelay = 5 * time.Minute
+	// jobLateThreshold is the delay after which a run is reported as missed.
+	jobLateThreshold = 2 * time.Minute
+)
+
+// JobFunc runs a due job; late tells how long after its time the job runs, e.g. because
+// the bot was offline.
+type JobFunc func(job *types.Job, late time.Duration) error
+
+// RegisterJobKind registers the function running the jobs of the kind.
+func (tgBot *TgBot) RegisterJobKind(kind string, run JobFunc) {
+	if _, exists := tgBot.jobKinds[kind]; exists {
+		return // Kind already registered
+	}
+	tgBot.jobKinds[kind] = run
+}
+
+// runScheduler runs due jobs until the bot stops. Jobs missed while the bot was offline
+// are caught up right at the start. Start counts the scheduler as a worker, so stopping
+// waits for the current run and no run starts while the bot waits for its workers.
+func (tgBot *TgBot) runScheduler() {
+	defer tgBot.wgWorkers.Done()
+	ticker := time.NewTicker(schedulerInterval)
+	defer ticker.Stop()
+	tgBot.runDueJobs(time.Now())
+	for {
+		select {
+		case <-tgBot.stopping:
+			return
+		case <-tgBot.context.Done():
+			return
+		case now := <-ticker.C:
+			tgBot.runDueJobs(now)
+		}
+	}
+}
+
+// runDueJobs runs the jobs due at the given time and reschedules them, until the bot stops.
+func (tgBot *TgBot) runDueJobs(now time.Time) {
+	jobs, err := tgBot.storage.GetDueJobs(now, schedulerBatch)
+	if err != nil {
+		tgBot.logger.Errorf("Failed to get due jobs: %v", err)
+		return
+	}
+	for _, job := range jobs {
+		if tgBot.isStopping() {
+			return
+		}
+		tgBot.runJob(job, now)
+	}
+}
+
+// isStopping reports whether the bot is stopping.
+func (tgBot *TgBot) isStopping() bool {
+	select {
+	case <-tgBot.stopping:
+		return true
+	default:
+		return tgBot.context.Err() != nil
+	}
+}
+
+// runJob runs a single job. A failed run is retried a few times; a recurring job is then
+// rescheduled to its next time after now, so runs missed during a downtime are caught up
+// only once.
+func (tgBot *TgBot) runJob(job *types.Job, now time.Time) {
+	run := tgBot.jobKinds[job.Kind]
+	if run == nil {
+		tgBot.logger.Errorf("Job %d has unknown kind %q, deleting it", job.Id, job.Kind)
+		tgBot.storage.DeleteJob(job.Id)
+		return
+	}
+
+	err := run(job, now.Sub(job.NextRunAt))
+	if err != nil && !errors.Is(err, ErrChatUnavailable) && job.Attempts+1 < maxJobAttempts {
+		tgBot.logger.Warnf("Job %d failed, retrying later: %v", job.Id, err)
+		job.Attempts++
+		job.NextRunAt = now.Add(jobRetryDelay)
+		if err := tgBot.storage.UpdateJob(job); err != nil {
+			tgBot.logger.Errorf("Failed to reschedule job %d: %v", job.Id, err)
+		}
+		return
+	}
+	if err != nil {
+		tgBot.logger.Errorf("Job %d failed, skipping the run: %v", job.Id, err)
+		if !errors.Is(err, ErrChatUnavailable) {
+			tgBot.Notify(types.NotifyError, fmt.Sprintf("Scheduled %s %d failed %d times, skipping the run: %v", job.Kind, job.Id, maxJobAttempts, err))
+		}
+	}
+
+	var next time.Time
+	if job.Recurring() {
+		next = NextJobRun(job, now)
+	}
+	if next.IsZero() {
+		if _, err := tgBot.storage.DeleteJob(job.Id); err != nil {
+			tgBot.logger.Errorf("Failed to delete job %d: %v", job.Id, err)
+		}
+		return
+	}
+	job.LastRunAt = now
+	job.NextRunAt = next
+	job.Attempts = 0
+	if err := tgBot.storage.UpdateJob(job); err != nil {
+		tgBot.logger.Errorf("Failed to reschedule job %d: %v", job.Id, err)
+	}
+}
+
+// NextJobRun returns the next time of a recurring job after the given one, or the zero
+// time if the job never runs again.
+func NextJobRun(job *types.Job, after time.Time) time.Time {
+	c, err := schedule.ParseCron(job.Cron)
+	if err != nil {
+		return time.Time{}
+	}
+	loc, err := time.LoadLocation(job.Timezone)
+	if err != nil {
+		loc = time.Local
+	}
+	return c.Next(after.In(loc))
+}
+
+// deliverReminder sends a reminder to the chat it was set in.
+func (tgBot *TgBot) deliverReminder(job *types.Job, late time.Duration) error {
+	text := "⏰ " + job.Text
+	if late > jobLateThreshold {
+		text += fmt.Sprintf("\n(due %s, delivered late)", tgBot.formatJobTime(job, job.NextRunAt))
+	}
+	_, err := tgBot.SendMessage(&bot.SendMessageParams{
+		ChatID:          job.ChatId,
+		MessageThreadID: job.ThreadId,
+		Text:            text,
+	})
+	return err
+}
+
+// formatJobTime formats a time of the job in the job's time zone.
+func (tgBot *TgBot) formatJobTime(job *types.Job, t time.Time) string {
+	if loc, err := time.LoadLocation(job.Timezone); err == nil {
+		t = t.In(loc)
+	}
+	return t.Format("Mon, 02 Jan 2006 15:04 MST")
+}
@@ -0,0 +1,62 @@
+package tgbot
+
+import (
+	"testing"
+	"time"
+
+	"gourbot/internal/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNextJobRun(t *testing.T) {
+	loc, err := time.LoadLocation("Asia/Tokyo")
+	assert.NoError(t, err)
+	after := time.Date(2026, 10, 16, 0, 30, 0, 0, time.UTC) // 9:30 in Tokyo
+
+	job := types.NewJob(types.JobReminder, 42, 42, 0, "vitamins", "0 9 * * *", "Asia/Tokyo", after)
+	assert.Equal(t, time.Date(2026, 10, 17, 9, 0, 0, 0, loc), NextJobRun(job, after), "the recurrence is computed in the job's time zone")
+
+	// After a downtime the missed runs are skipped, only the next one counts
+	assert.Equal(t, time.Date(2026, 10, 20, 9, 0, 0, 0, loc), NextJobRun(job, after.AddDate(0, 0, 3)))
+
+	job.Cron = "0 12 30 2 *"
+	assert.True(t, NextJobRun(job, after).IsZero(), "a job which never runs again has no next run")
+	job.Cron = "bad"
+	assert.True(t, NextJobRun(job, after).IsZero())
+}
+
+func TestRunScheduler_Stopping(t *testing.T) {
+	tgBot, _ := newTestBot(t)
+	ran := make(chan int64, 10)
+	tgBot.RegisterJobKind("test", func(job *types.Job, late time.Duration) error {
+		ran <- job.Id
+		return nil
+	})
+	job := types.NewJob("test", 42, 42, 0, "", "", "", time.Now().Add(-time.Minute))
+	assert.NoError(t, tgBot.storage.AddJob(job))
+
+	tgBot.wgWorkers.Add(1)
+	go tgBot.runScheduler()
+	select {
+	case id := <-ran:
+		assert.Equal(t, job.Id, id, "due jobs are caught up at the start")
+	case <-time.After(5 * time.Second):
+		t.Fatal("the due job did not run")
+	}
+
+	// Like /stop: the bot waits for its workers while its context is still live
+	close(tgBot.stopping)
+	stopped := make(chan struct{})
+	go func() {
+		tgBot.wgWorkers.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the scheduler kept running after the bot started stopping")
+	}
+	assert.NoError(t, tgBot.context.Err())
+	assert.True(t, tgBot.isStopping())
+}
@@ -0,0 +1,142 @@
+package tgbot
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"gourbot/internal/types"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+const (
+	// chatActionInterval is how often a chat action is repeated (Telegram shows it for ~5 seconds).
+	chatActionInterval = 4 * time.Second
+	// finishTimeout limits showing an answer interrupted by the bot stopping.
+	finishTimeout = 5 * time.Second
+)
+
+// streamReply progressively updates a placeholder reply while an answer is being streamed.
+type streamReply struct {
+	tgBot     *TgBot
+	ctx       context.Context // Context of the Telegram requests
+	chatID    int64
+	messageID int
+	interval  time.Duration
+	text      strings.Builder
+	shown     string
+	editedAt  time.Time
+}
+
+// NewStreamReply sends a placeholder reply to the update's message and returns a streamReply bound to it.
+func (tgBot *TgBot) NewStreamReply(update *models.Update) (*streamReply, error) {
+	msg, err := tgBot.Reply(update, "…")
+	if err != nil {
+		return nil, err
+	}
+	return &streamReply{
+		tgBot:     tgBot,
+		ctx:       tgBot.context,
+		chatID:    msg.Chat.ID,
+		messageID: msg.ID,
+		interval:  time.Duration(tgBot.config().StreamEditInterval) * time.Millisecond,
+		shown:     "…",
+		editedAt:  time.Now(),
+	}, nil
+}
+
+// Write appends a piece of the answer and edits the placeholder if the throttle interval has passed.
+// Edit failures are logged but do not interrupt the stream.
+func (s *streamReply) Write(delta string) error {
+	s.text.WriteString(delta)
+	if time.Since(s.editedAt) < s.interval {
+		return nil
+	}
+	s.edit(TruncateMessage(s.text.String(), maxMessageLength), "")
+	return nil
+}
+
+// Finish shows the final answer with formatting applied.
+// If streaming failed, the partial answer is kept and marked accordingly. An answer
+// interrupted by the bot stopping is still shown, as the bot waits for its workers.
+func (s *streamReply) Finish(err error) {
+	text := s.text.String()
+	switch {
+	case err == nil && strings.TrimSpace(text) == "":
+		text = "(empty answer)"
+	case errors.Is(err, context.Canceled):
+		text += "\n\n[interrupted]"
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(s.tgBot.context), finishTimeout)
+		defer cancel()
+		s.ctx = ctx
+	case err != nil:
+		s.tgBot.logger.Errorf("LLM stream failed: %v", err)
+		s.tgBot.Notify(types.NotifyError, "LLM request failed: "+err.Error())
+		text += "\n\n[error: " + err.Error() + "]"
+	}
+
+	chunks := SplitMessage(text, maxMessageLength)
+	s.editFormatted(chunks[0])
+	for _, chunk := range chunks[1:] {
+		_, err := s.tgBot.sendMessage(s.ctx, &bot.SendMessageParams{
+			ChatID:    s.chatID,
+			Text:      MarkdownToHTML(chunk),
+			ParseMode: models.ParseModeHTML,
+		})
+		if err != nil {
+			s.tgBot.sendMessage(s.ctx, &bot.SendMessageParams{ChatID: s.chatID, Text: chunk})
+		}
+	}
+}
+
+// editFormatted edits the placeholder with HTML formatting, falling back to plain text
+// if Telegram rejects the markup.
+func (s *streamReply) editFormatted(text string) {
+	if err := s.edit(MarkdownToHTML(text), models.ParseModeHTML); err != nil {
+		s.edit(text, "")
+	}
+}
+
+// edit replaces the placeholder text, skipping no-op edits that Telegram would reject.
+func (s *streamReply) edit(text string, parseMode models.ParseMode) error {
+	if text == s.shown {
+		return nil
+	}
+	s.editedAt = time.Now()
+	_, err := s.tgBot.editMessageText(s.ctx, &bot.EditMessageTextParams{
+		ChatID:    s.chatID,
+		MessageID: s.messageID,
+		Text:      text,
+		ParseMode: parseMode,
+	})
+	if err != nil {
+		return err
+	}
+	s.shown = text
+	return nil
+}
+
+// KeepChatAction shows a chat action such as "typing" until the returned stop function is called.
+func (tgBot *TgBot) KeepChatAction(chatID int64, action models.ChatAction) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(chatActionInterval)
+		defer ticker.Stop()
+		for {
+			tgBot.SendChatAction(chatID, action)
+			select {
+			case <-done:
+				return
+			case <-tgBot.context.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
@@ -0,0 +1,28 @@
+package tgbot
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStreamReply_FinishAfterStop(t *testing.T) {
+	tgBot, api := newTestBot(t)
+
+	reply, err := tgBot.NewStreamReply(privateMessage(42, "question"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	reply.Write("A half-written")
+	tgBot.cancel() // The bot stops while the answer streams
+	reply.Finish(context.Canceled)
+
+	texts := api.texts()
+	if assert.NotEmpty(t, texts) {
+		last := texts[len(texts)-1]
+		assert.True(t, strings.HasPrefix(last, "A half-written"), last)
+		assert.True(t, strings.HasSuffix(last, "[interrupted]"), last)
+	}
+}
@@ -4,10 +4,14 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"gourbot/internal/buildinfo"
 	"gourbot/internal/config"
+	"gourbot/internal/llm"
 	"gourbot/internal/storage"
 	"gourbot/internal/types"
 
@@ -18,36 +22,65 @@ import (
 
 // TgBot represents the Telegram bot instance.
 type TgBot struct {
-	config    *config.Config
-	logger    *logrus.Logger
-	context   context.Context
-	cancel    context.CancelFunc
-	bot       *bot.Bot
-	wgWorkers sync.WaitGroup
-	chanQuit  chan struct{}
-	commands  map[string]string // Store handler IDs as strings
-	storage   *storage.Storage  // Add a new field for storage
+	cfg           atomic.Pointer[config.Config] // Replaced when the configuration is reloaded
+	logger        *logrus.Logger
+	context       context.Context
+	cancel        context.CancelFunc
+	bot           *bot.Bot
+	me            *models.User // The bot's own user
+	wgWorkers     sync.WaitGroup
+	chanQuit      chan struct{}
+	stopping      chan struct{}                // Closed when the bot starts waiting for its workers
+	commands      map[string]string            // Store handler IDs as strings
+	storage       *storage.Storage             // Add a new field for storage
+	llm           atomic.Pointer[llm.Registry] // Replaced when the configuration is reloaded
+	tools         *llm.ToolRegistry
+	summarizing   sync.Map // Conversations whose history is being summarized
+	inlinePending sync.Map // Latest inline query ID of every user, for debouncing
+	quotaNotified sync.Map // Day the admins were last told that a user exceeded the quota
+	startedAt     time.Time
+
+	callbacks     map[string]*callbackRoute // Callback handlers by route
+	callbackCodec *CallbackCodec
+	dialogs       map[string]*dialogDef // Registered dialogs by name
+	jobKinds      map[string]JobFunc    // Scheduler job handlers by kind
 }
 
 // NewTgBot initializes a new TgBot instance.
 func NewTgBot(cfg *config.Config, logger *logrus.Logger) (*TgBot, error) {
+	return newTgBot(cfg, logger)
+}
+
+// newTgBot initializes a TgBot with extra options of the Telegram client, e.g. the URL of
+// a fake Bot API in tests.
+func newTgBot(cfg *config.Config, logger *logrus.Logger, botOptions ...bot.Option) (*TgBot, error) {
 	tgBot := &TgBot{
-		config:   cfg,
-		logger:   logger,
-		chanQuit: make(chan struct{}, 1),
-		commands: make(map[string]string),
-		storage:  storage.NewStorage(cfg), // Initialize the storage field
+		logger:    logger,
+		chanQuit:  make(chan struct{}, 1),
+		stopping:  make(chan struct{}),
+		commands:  make(map[string]string),
+		startedAt: time.Now(),
+
+		callbacks:     make(map[string]*callbackRoute),
+		dialogs:       make(map[string]*dialogDef),
+		jobKinds:      make(map[string]JobFunc),
+		callbackCodec: NewCallbackCodec(string(cfg.TGBotToken)),
+		storage:       storage.NewStorage(cfg), // Initialize the storage field
+	}
+	tgBot.cfg.Store(cfg)
+	registry, err := llm.NewRegistry(cfg)
+	if err != nil {
+		return nil, err
+	}
+	tgBot.llm.Store(registry)
+	if tgBot.tools, err = tgBot.newTools(); err != nil {
+		return nil, err
 	}
 	if err := tgBot.storage.Open(); err != nil {
 		tgBot.logger.Fatalf("Failed to open storage: %v", err)
 		return nil, err
 	}
-	master, err := tgBot.storage.GetTgUser(cfg.MasterUID)
-	if err != nil {
-		master = types.NewTgUser(cfg.MasterUID, "master", nil)
-	}
-	master.AddPermission(types.CanEverything)
-	tgBot.storage.UpdateTgUser(master)
+	tgBot.applyAdmins(nil, cfg)
 
 	opts := []bot.Option{
 		bot.WithDefaultHandler(func(_ context.Context, _ *bot.Bot, update *models.Update) {
@@ -57,53 +90,163 @@ func NewTgBot(cfg *config.Config, logger *logrus.Logger) (*TgBot, error) {
 			if tgBot.Guard(update) {
 				tgBot.DefaultHandler(update)
 			} else {
-				tgBot.logger.Infof("ignore user %d", update.Message.From.ID)
+				tgBot.logIgnored(update)
 			}
 		}),
+		bot.WithAllowedUpdates(allowedUpdates),
 	}
+	opts = append(opts, botOptions...)
 	// Initialize the Telegram bot
-	b, err := bot.New(cfg.TGBotToken, opts...)
+	b, err := bot.New(string(cfg.TGBotToken), opts...)
 	if err != nil {
 		return nil, err
 	}
 	tgBot.bot = b
+	if tgBot.me, err = b.GetMe(context.Background()); err != nil {
+		return nil, err
+	}
 	return tgBot, nil
 }
 
+// config returns the current configuration, which is replaced when it is reloaded.
+func (tgBot *TgBot) config() *config.Config {
+	return tgBot.cfg.Load()
+}
+
+// registry returns the current LLM providers, which are rebuilt when the configuration is reloaded.
+func (tgBot *TgBot) registry() *llm.Registry {
+	return tgBot.llm.Load()
+}
+
 // RegisterCommand registers a command with the bot.
 func (tgBot *TgBot) RegisterCommand(command string, handler func(update *models.Update)) {
 	if _, exists := tgBot.commands[command]; exists {
 		return // Command already registered
 	}
 
-	handlerID := tgBot.bot.RegisterHandler(bot.HandlerTypeMessageText, command, bot.MatchTypeExact, bot.HandlerFunc(
-		func(ctx context.Context, botInstance *bot.Bot, update *models.Update) {
-			tgBot.wgWorkers.Add(1)
-			defer tgBot.wgWorkers.Done()
-			tgBot.storage.AddTgRecord(false, update)
-			if tgBot.Guard(update) {
-				handler(update)
-			} else {
-				tgBot.logger.Infof("ignore user %d", update.Message.From.ID)
-			}
-		},
-	))
+	handlerID := tgBot.bot.RegisterHandler(bot.HandlerTypeMessageText, command, bot.MatchTypeExact, tgBot.guarded(handler))
 	tgBot.commands[command] = handlerID // Store handler ID as string
 }
 
+// RegisterCommandWithArgs registers a command which accepts arguments after the command name.
+func (tgBot *TgBot) RegisterCommandWithArgs(command string, handler func(update *models.Update)) {
+	if _, exists := tgBot.commands[command]; exists {
+		return // Command already registered
+	}
+
+	handlerID := tgBot.bot.RegisterHandlerMatchFunc(matchCommandFunc(command), tgBot.guarded(handler))
+	tgBot.commands[command] = handlerID
+}
+
+// RegisterUnguardedCommand registers a command with arguments which bypasses the Guard
+// check; the handler has to check permissions itself.
+func (tgBot *TgBot) RegisterUnguardedCommand(command string, handler func(update *models.Update)) {
+	if _, exists := tgBot.commands[command]; exists {
+		return // Command already registered
+	}
+
+	handlerID := tgBot.bot.RegisterHandlerMatchFunc(matchCommandFunc(command), tgBot.tracked(handler))
+	tgBot.commands[command] = handlerID
+}
+
+// tracked wraps a handler with worker accounting and update logging only.
+func (tgBot *TgBot) tracked(handler func(update *models.Update)) bot.HandlerFunc {
+	return func(ctx context.Context, botInstance *bot.Bot, update *models.Update) {
+		tgBot.wgWorkers.Add(1)
+		defer tgBot.wgWorkers.Done()
+		tgBot.storage.AddTgRecord(false, update)
+		handler(update)
+	}
+}
+
+// logIgnored logs an update rejected by Guard.
+func (tgBot *TgBot) logIgnored(update *models.Update) {
+	if user := GetUserFromUpdate(update); user != nil {
+		tgBot.logger.Infof("ignore user %d", user.ID)
+	} else {
+		tgBot.logger.Infof("ignore update %d", update.ID)
+	}
+}
+
+// guarded wraps a handler with worker accounting, update logging and the Guard check.
+func (tgBot *TgBot) guarded(handler func(update *models.Update)) bot.HandlerFunc {
+	return func(ctx context.Context, botInstance *bot.Bot, update *models.Update) {
+		tgBot.wgWorkers.Add(1)
+		defer tgBot.wgWorkers.Done()
+		tgBot.storage.AddTgRecord(false, update)
+		if tgBot.Guard(update) {
+			handler(update)
+		} else {
+			tgBot.logIgnored(update)
+		}
+	}
+}
+
 // Start begins the bot's operation.
 func (tgBot *TgBot) Start(ctx context.Context) error {
 	// Register commands
 	tgBot.RegisterCommand("ping", tgBot.CmdPing)
 	tgBot.RegisterCommand("/list", tgBot.CmdList)
 	tgBot.RegisterCommand("/stop", tgBot.CmdStop)
+	tgBot.RegisterCommandWithArgs("/draw", tgBot.CmdDraw)
+	tgBot.RegisterCommandWithArgs("/voice", tgBot.CmdVoice)
+	tgBot.RegisterCommandWithArgs("/persona", tgBot.CmdPersona)
+	tgBot.RegisterCommandWithArgs("/persona_set", tgBot.CmdPersonaSet)
+	tgBot.RegisterCommandWithArgs("/persona_del", tgBot.CmdPersonaDel)
+	tgBot.RegisterCommandWithArgs("/persona_new", tgBot.CmdPersonaNew)
+	tgBot.RegisterCommandWithArgs("/cancel", tgBot.CmdCancel)
+	tgBot.RegisterCommandWithArgs("/remind", tgBot.CmdRemind)
+	tgBot.RegisterCommandWithArgs("/reminders", tgBot.CmdReminders)
+	tgBot.RegisterCommandWithArgs("/timezone", tgBot.CmdTimezone)
+	tgBot.RegisterCommandWithArgs("/model", tgBot.CmdModel)
+	tgBot.RegisterCommandWithArgs("/summary", tgBot.CmdSummary)
+	tgBot.RegisterUnguardedCommand("/bot", tgBot.CmdBot)
+	tgBot.RegisterCommand("/chats", tgBot.CmdChats)
+	tgBot.RegisterCommandWithArgs("/chat_approve", tgBot.CmdChatApprove)
+	tgBot.RegisterCommandWithArgs("/chat_revoke", tgBot.CmdChatRevoke)
+	tgBot.RegisterCommandWithArgs("/approve", tgBot.CmdApprove)
+	tgBot.RegisterCommandWithArgs("/revoke", tgBot.CmdRevoke)
+	tgBot.RegisterCommandWithArgs("/notify", tgBot.CmdNotify)
+	tgBot.RegisterCommandWithArgs("/broadcast", tgBot.CmdBroadcast)
+	tgBot.RegisterCommand("/version", tgBot.CmdVersion)
+	tgBot.RegisterCommandWithArgs("/backup", tgBot.CmdBackup)
+	tgBot.bot.RegisterHandlerMatchFunc(isMembershipUpdate, tgBot.tracked(tgBot.MembershipHandler))
+
+	// Register inline keyboard callbacks
+	tgBot.RegisterCallback(callbackNoop, "", func(cb *Callback) {})
+	tgBot.RegisterCallback(callbackChats, types.CanManageUsers, tgBot.CallbackChats)
+	tgBot.RegisterCallback(callbackSummaryClear, types.CanChat, tgBot.CallbackSummaryClear)
+	tgBot.RegisterCallback(callbackDialog, "", tgBot.CallbackDialog)
+	tgBot.RegisterCallback(callbackReminders, "", tgBot.CallbackReminders)
+	tgBot.RegisterCallback(callbackReminderCancel, "", tgBot.CallbackReminderCancel)
+	tgBot.bot.RegisterHandlerMatchFunc(isCallbackQuery, tgBot.tracked(tgBot.CallbackHandler))
+
+	// Register inline mode
+	tgBot.bot.RegisterHandlerMatchFunc(isInlineQuery, tgBot.guarded(tgBot.InlineHandler))
+	tgBot.bot.RegisterHandlerMatchFunc(isChosenInlineResult, tgBot.tracked(tgBot.ChosenInlineHandler))
+
+	// Register dialogs
+	tgBot.RegisterDialog(personaDialog, personaStepName, tgBot.personaDialogSteps())
+	tgBot.RegisterDialog(broadcastDialog, broadcastStepContent, tgBot.broadcastDialogSteps())
+
+	// Register scheduler jobs
+	tgBot.RegisterJobKind(types.JobReminder, tgBot.deliverReminder)
+	tgBot.RegisterJobKind(types.JobDigest, tgBot.deliverDigest)
+	tgBot.RegisterJobKind(types.JobBackup, tgBot.runBackup)
+	tgBot.scheduleDigest(tgBot.config())
+	tgBot.scheduleBackup(tgBot.config())
 
 	tgBot.context, tgBot.cancel = context.WithCancel(context.Background())
+	// The background loops count as workers until the bot stops, see stopping
+	tgBot.wgWorkers.Add(2)
+	go tgBot.expireDialogs()
+	go tgBot.runScheduler()
+
 	go func() {
 		defer tgBot.cancel()
 		tgBot.logger.Info("start proxy canceller ...")
 		<-ctx.Done()
-		tgBot.Notify("got signal from outer space")
+		tgBot.Notify(types.NotifyLifecycle, "got signal from outer space")
 		time.Sleep(100 * time.Millisecond)
 		tgBot.Stop()
 	}()
@@ -113,15 +256,20 @@ func (tgBot *TgBot) Start(ctx context.Context) error {
 		tgBot.logger.Info("start watching chanQuit ...")
 		<-tgBot.chanQuit
 		tgBot.logger.Info("got chanQuit")
-		tgBot.Notify("bot got chanQuit signal")
+		tgBot.Notify(types.NotifyLifecycle, "bot got chanQuit signal")
+		close(tgBot.stopping)  // Stop the background loops which start workers
 		tgBot.wgWorkers.Wait() // Wait for all workers to finish
 		tgBot.logger.Info("all workers finished - pull the trigger")
 		tgBot.cancel() // Cancel the context
 	}()
 
+	if addr := tgBot.config().HealthAddr; addr != "" {
+		go tgBot.serveHealth(tgBot.context, addr)
+	}
+
 	go func() {
 		time.Sleep(100 * time.Millisecond)
-		tgBot.Notify("bot started")
+		tgBot.Notify(types.NotifyLifecycle, "bot started: "+buildinfo.Get().String())
 	}()
 	// Start the bot
 	tgBot.logger.Info("TgBot instance starting...")
@@ -141,14 +289,44 @@ func (tgBot *TgBot) Stop() {
 	}
 }
 
-// IsAllowed checks if the given ID is allowed to perform certain actions.
+// IsAllowed reports whether the user is a master, i.e. has the CanEverything permission.
 func (tgBot *TgBot) IsAllowed(id int64) bool {
-	return id == tgBot.config.MasterUID
+	user, err := tgBot.storage.GetTgUser(id)
+	return err == nil && user.HasPermission(types.CanEverything)
+}
+
+// UserWithPermission retrieves the sender of the update's message and checks the permission,
+// which either the user or the chat of the message may have.
+// If both lack it, the message is answered with a refusal and nil is returned.
+func (tgBot *TgBot) UserWithPermission(update *models.Update, permission string) *types.TgUser {
+	user, err := tgBot.storage.GetTgUser(update.Message.From.ID)
+	if err != nil {
+		tgBot.logger.Errorf("Failed to retrieve user: %v", err)
+		return nil
+	}
+	if !types.HasAccess(user, tgBot.ChatByID(update.Message.Chat.ID), permission) {
+		tgBot.Reply(update, "You are not allowed to do this ("+permission+" is required).")
+		if slices.Contains(adminPermissions, permission) {
+			tgBot.Notify(types.NotifySecurity, fmt.Sprintf("%s (%d) was refused %q, %s is required.",
+				user.Name, user.Id, update.Message.Text, permission))
+		}
+		return nil
+	}
+	return user
 }
 
 // Guard processes an incoming update, registers the user, and determines if further interaction is allowed.
+// In groups only messages addressed to the bot are processed, unless the bot is disabled in the group.
+// Access is granted if the user or the chat has the CanChat permission.
 func (tgBot *TgBot) Guard(update *models.Update) bool {
 	tgBot.storage.AddTgRecord(false, update)
+	chat := tgBot.TrackChat(update)
+
+	if msg := update.Message; msg != nil && IsGroupChat(&msg.Chat) {
+		if !AddressedToBot(msg, tgBot.me) || !tgBot.BotEnabledInChat(msg.Chat.ID) {
+			return false
+		}
+	}
 
 	// Extract user information from the update
 	user := GetUserFromUpdate(update)
@@ -158,10 +336,7 @@ func (tgBot *TgBot) Guard(update *models.Update) bool {
 	}
 	info, _ := json.Marshal(user)
 
-	username := user.Username
-	if username == "" {
-		username = user.FirstName + " " + user.LastName
-	}
+	username := DisplayName(user)
 
 	// Check if the user exists in the system
 	exists, err := tgBot.storage.TgUserExists(user.ID)
@@ -179,10 +354,10 @@ func (tgBot *TgBot) Guard(update *models.Update) bool {
 			return false
 		}
 
-		// Notify the master about the new user
-		message := "New user detected: " + username + ", ID: " + fmt.Sprint(user.ID) + ". To approve, use /approve_" + fmt.Sprint(user.ID)
-		tgBot.Notify(message)
-		return false
+		// Notify the admins about the new user
+		message := "New user detected: " + username + ", ID: " + fmt.Sprint(user.ID) + ". To approve, use /approve " + fmt.Sprint(user.ID)
+		tgBot.Notify(types.NotifyNewUser, message)
+		return types.HasAccess(tgUser, chat, types.CanChat)
 	}
 
 	// Update existing user information
@@ -201,43 +376,154 @@ func (tgBot *TgBot) Guard(update *models.Update) bool {
 		return false
 	}
 
-	// Check if the user has no permission to chat
-	if !tgUser.HasPermission(types.CanChat) {
+	// Check if neither the user nor the chat has permission to chat
+	if !types.HasAccess(tgUser, chat, types.CanChat) {
 		return false
 	}
 
 	return true
 }
 
+// SendMessage sends a text message and logs the sent message. Chats which blocked
+// or removed the bot are skipped with ErrChatUnavailable.
 func (tgBot *TgBot) SendMessage(smp *bot.SendMessageParams) (*models.Message, error) {
+	return tgBot.sendMessage(tgBot.context, smp)
+}
+
+// sendMessage sends a message like SendMessage within the given context.
+func (tgBot *TgBot) sendMessage(ctx context.Context, smp *bot.SendMessageParams) (*models.Message, error) {
 	tgBot.wgWorkers.Add(1)
 	defer tgBot.wgWorkers.Done()
-	msg, err := tgBot.bot.SendMessage(tgBot.context, smp)
+	if err := tgBot.checkRecipient(smp.ChatID); err != nil {
+		return nil, err
+	}
+	msg, err := tgBot.bot.SendMessage(ctx, smp)
 	if err != nil {
 		tgBot.logger.Errorf("SendMessage failed: %v", err)
+		tgBot.checkSendError(smp.ChatID, err)
 	} else {
 		tgBot.storage.AddTgRecord(true, msg)
 	}
 	return msg, err
 }
 
-// Notify sends a message to the master user.
-func (tgBot *TgBot) Notify(message string) {
-	tgBot.logger.Info("Notify: " + message)
-	_, err := tgBot.SendMessage(&bot.SendMessageParams{
-		ChatID: tgBot.config.MasterUID,
-		Text:   message,
-	})
+// SendPhoto sends a photo and logs the sent message.
+func (tgBot *TgBot) SendPhoto(spp *bot.SendPhotoParams) (*models.Message, error) {
+	tgBot.wgWorkers.Add(1)
+	defer tgBot.wgWorkers.Done()
+	if err := tgBot.checkRecipient(spp.ChatID); err != nil {
+		return nil, err
+	}
+	msg, err := tgBot.bot.SendPhoto(tgBot.context, spp)
+	if err != nil {
+		tgBot.logger.Errorf("SendPhoto failed: %v", err)
+		tgBot.checkSendError(spp.ChatID, err)
+	} else {
+		tgBot.storage.AddTgRecord(true, msg)
+	}
+	return msg, err
+}
+
+// SendDocument sends a file and logs the sent message.
+func (tgBot *TgBot) SendDocument(sdp *bot.SendDocumentParams) (*models.Message, error) {
+	tgBot.wgWorkers.Add(1)
+	defer tgBot.wgWorkers.Done()
+	if err := tgBot.checkRecipient(sdp.ChatID); err != nil {
+		return nil, err
+	}
+	msg, err := tgBot.bot.SendDocument(tgBot.context, sdp)
+	if err != nil {
+		tgBot.logger.Errorf("SendDocument failed: %v", err)
+		tgBot.checkSendError(sdp.ChatID, err)
+	} else {
+		tgBot.storage.AddTgRecord(true, msg)
+	}
+	return msg, err
+}
+
+// SendVoice sends a voice message and logs the sent message.
+func (tgBot *TgBot) SendVoice(svp *bot.SendVoiceParams) (*models.Message, error) {
+	tgBot.wgWorkers.Add(1)
+	defer tgBot.wgWorkers.Done()
+	if err := tgBot.checkRecipient(svp.ChatID); err != nil {
+		return nil, err
+	}
+	msg, err := tgBot.bot.SendVoice(tgBot.context, svp)
+	if err != nil {
+		tgBot.logger.Errorf("SendVoice failed: %v", err)
+		tgBot.checkSendError(svp.ChatID, err)
+	} else {
+		tgBot.storage.AddTgRecord(true, msg)
+	}
+	return msg, err
+}
+
+// CopyMessage sends a copy of a message of any kind without a link to the original.
+func (tgBot *TgBot) CopyMessage(cmp *bot.CopyMessageParams) (*models.MessageID, error) {
+	tgBot.wgWorkers.Add(1)
+	defer tgBot.wgWorkers.Done()
+	if err := tgBot.checkRecipient(cmp.ChatID); err != nil {
+		return nil, err
+	}
+	id, err := tgBot.bot.CopyMessage(tgBot.context, cmp)
+	if err != nil {
+		tgBot.logger.Errorf("CopyMessage failed: %v", err)
+		tgBot.checkSendError(cmp.ChatID, err)
+	}
+	return id, err
+}
+
+// ForwardMessage forwards a message and logs the sent message.
+func (tgBot *TgBot) ForwardMessage(fmp *bot.ForwardMessageParams) (*models.Message, error) {
+	tgBot.wgWorkers.Add(1)
+	defer tgBot.wgWorkers.Done()
+	if err := tgBot.checkRecipient(fmp.ChatID); err != nil {
+		return nil, err
+	}
+	msg, err := tgBot.bot.ForwardMessage(tgBot.context, fmp)
+	if err != nil {
+		tgBot.logger.Errorf("ForwardMessage failed: %v", err)
+		tgBot.checkSendError(fmp.ChatID, err)
+	} else {
+		tgBot.storage.AddTgRecord(true, msg)
+	}
+	return msg, err
+}
+
+// EditMessageText edits the text of a previously sent message.
+func (tgBot *TgBot) EditMessageText(emp *bot.EditMessageTextParams) (*models.Message, error) {
+	return tgBot.editMessageText(tgBot.context, emp)
+}
+
+// editMessageText edits a message like EditMessageText within the given context.
+func (tgBot *TgBot) editMessageText(ctx context.Context, emp *bot.EditMessageTextParams) (*models.Message, error) {
+	tgBot.wgWorkers.Add(1)
+	defer tgBot.wgWorkers.Done()
+	msg, err := tgBot.bot.EditMessageText(ctx, emp)
 	if err != nil {
-		tgBot.logger.Errorf("Notify failed: %v", err)
+		tgBot.logger.Errorf("EditMessageText failed: %v", err)
 	} else {
-		tgBot.logger.Info("Notify sent")
+		tgBot.storage.AddTgRecord(true, msg)
+	}
+	return msg, err
+}
+
+// SendChatAction shows a chat action such as "typing" to the user.
+func (tgBot *TgBot) SendChatAction(chatID int64, action models.ChatAction) {
+	_, err := tgBot.bot.SendChatAction(tgBot.context, &bot.SendChatActionParams{
+		ChatID: chatID,
+		Action: action,
+	})
+	if err != nil {
+		tgBot.logger.Warnf("SendChatAction failed: %v", err)
 	}
 }
 
+// Reply answers the update's message, staying in its forum topic if there is one.
 func (tgBot *TgBot) Reply(update *models.Update, text string) (*models.Message, error) {
 	return tgBot.SendMessage(&bot.SendMessageParams{
-		ChatID: update.Message.Chat.ID,
+		ChatID:          update.Message.Chat.ID,
+		MessageThreadID: TopicOf(update.Message),
 		ReplyParameters: &models.ReplyParameters{
 			MessageID: update.Message.ID,
 		},
@@ -245,12 +531,43 @@ func (tgBot *TgBot) Reply(update *models.Update, text string) (*models.Message,
 	})
 }
 
+// ReplyWithKeyboard answers the update's message with an inline keyboard attached.
+// A nil keyboard sends a plain reply.
+func (tgBot *TgBot) ReplyWithKeyboard(update *models.Update, text string, keyboard *models.InlineKeyboardMarkup) (*models.Message, error) {
+	params := &bot.SendMessageParams{
+		ChatID:          update.Message.Chat.ID,
+		MessageThreadID: TopicOf(update.Message),
+		ReplyParameters: &models.ReplyParameters{
+			MessageID: update.Message.ID,
+		},
+		Text: text,
+	}
+	if keyboard != nil {
+		params.ReplyMarkup = keyboard
+	}
+	return tgBot.SendMessage(params)
+}
+
 // CmdStop handles the "/stop" command.
 func (tgBot *TgBot) DefaultHandler(update *models.Update) {
 	blob, err := json.Marshal(update)
 	if err == nil {
 		tgBot.logger.Infof("GOT::: %s", string(blob))
 	}
+	if tgBot.HandleDialog(update) {
+		return
+	}
+	if update.Message == nil {
+		return // E.g. an edited message, which is not answered again
+	}
+	if update.Message.Text != "" {
+		tgBot.ChatHandler(update)
+		return
+	}
+	if update.Message.Voice != nil || update.Message.Audio != nil {
+		tgBot.VoiceHandler(update)
+		return
+	}
 	tgBot.Reply(update, "IDK what to do with your stuff")
 }
 
@@ -272,10 +589,9 @@ func (tgBot *TgBot) CmdList(update *models.Update) {
 
 // CmdStop handles the "/stop" command.
 func (tgBot *TgBot) CmdStop(update *models.Update) {
-	if !tgBot.IsAllowed(update.Message.From.ID) {
-		tgBot.Reply(update, "You are not authorized to stop the bot.")
+	if tgBot.UserWithPermission(update, types.CanStopBot) == nil {
 		return
 	}
-	tgBot.Notify("Bot is stopping...")
+	tgBot.Notify(types.NotifyLifecycle, "Bot is stopping...")
 	tgBot.Stop()
 }
@@ -0,0 +1,199 @@
+package tgbot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"gourbot/internal/config"
+	"gourbot/internal/types"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// testAnswer is the answer of the test LLM provider to any question.
+const testAnswer = "Forty-two."
+
+// apiCall is a request of the bot to the fake Telegram Bot API.
+type apiCall struct {
+	method string
+	params url.Values
+}
+
+// fakeAPI is a Telegram Bot API server which records the requests of the bot and answers
+// them with plausible results. It also serves the chat completions of the test LLM provider.
+type fakeAPI struct {
+	mu        sync.Mutex
+	calls     []apiCall
+	failures  map[string]map[string]any // Error responses by method
+	messageID int
+}
+
+func (api *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r.ParseMultipartForm(1 << 20)
+	method := path.Base(r.URL.Path)
+	params := r.Form
+	if params == nil {
+		params = url.Values{}
+	}
+
+	api.mu.Lock()
+	api.calls = append(api.calls, apiCall{method: method, params: params})
+	failure, failed := api.failures[method]
+	api.messageID++
+	messageID := api.messageID
+	api.mu.Unlock()
+
+	if failed {
+		json.NewEncoder(w).Encode(failure)
+		return
+	}
+	if method == "completions" {
+		// The test LLM provider shares the server and streams a fixed answer
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"role\":\"assistant\",\"content\":\""+testAnswer+"\"}}]}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+		return
+	}
+	var result any = true
+	switch method {
+	case "getMe":
+		result = models.User{ID: 1, IsBot: true, FirstName: "Gourbot", Username: "gourbot"}
+	case "sendMessage", "editMessageText", "sendDocument":
+		chatID, _ := strconv.ParseInt(params.Get("chat_id"), 10, 64)
+		if id, err := strconv.Atoi(params.Get("message_id")); err == nil {
+			messageID = id
+		}
+		result = models.Message{ID: messageID, Chat: models.Chat{ID: chatID}, Date: int(time.Now().Unix()), Text: params.Get("text")}
+	}
+	json.NewEncoder(w).Encode(map[string]any{"ok": true, "result": result})
+}
+
+// fail makes the API answer the method with an error.
+func (api *fakeAPI) fail(method, description string) {
+	api.failWith(method, map[string]any{"ok": false, "error_code": 400, "description": description})
+}
+
+// throttle makes the API answer the method with a 429 asking to retry after the seconds.
+func (api *fakeAPI) throttle(method string, retryAfter int) {
+	api.failWith(method, map[string]any{"ok": false, "error_code": 429, "description": "Too Many Requests",
+		"parameters": map[string]any{"retry_after": retryAfter}})
+}
+
+func (api *fakeAPI) failWith(method string, response map[string]any) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	if api.failures == nil {
+		api.failures = make(map[string]map[string]any)
+	}
+	api.failures[method] = response
+}
+
+// succeed makes the API answer the method normally again.
+func (api *fakeAPI) succeed(method string) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	delete(api.failures, method)
+}
+
+// sent returns the requests of the given methods, or of all methods without one.
+func (api *fakeAPI) sent(methods ...string) []apiCall {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	var calls []apiCall
+	for _, call := range api.calls {
+		if len(methods) == 0 || slices.Contains(methods, call.method) {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// texts returns the texts of the messages sent and edited, in order.
+func (api *fakeAPI) texts() []string {
+	var texts []string
+	for _, call := range api.sent("sendMessage", "editMessageText") {
+		texts = append(texts, call.params.Get("text"))
+	}
+	return texts
+}
+
+// newTestBot creates a TgBot with an in-memory database which talks to a fake Bot API.
+// Updates given to tgBot.bot.ProcessUpdate are handled before it returns.
+func newTestBot(t *testing.T) (*TgBot, *fakeAPI) {
+	t.Helper()
+	api := &fakeAPI{}
+	server := httptest.NewServer(api)
+	t.Cleanup(server.Close)
+
+	cfg := &config.Config{
+		TGBotToken:    "123456:ABCdefGHIjklMNOpqrSTUvwxYZ0123456789",
+		DbPath:        ":memory:",
+		Providers:     []config.ProviderConfig{{Name: "test", BaseURL: server.URL, Models: []string{"gpt-4o"}}},
+		DialogTimeout: 10,
+		BroadcastRate: 1000,
+	}
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	tgBot, err := newTgBot(cfg, logger, bot.WithServerURL(server.URL), bot.WithNotAsyncHandlers())
+	if err != nil {
+		t.Fatalf("newTgBot failed: %v", err)
+	}
+	tgBot.context, tgBot.cancel = context.WithCancel(context.Background())
+	t.Cleanup(func() {
+		tgBot.cancel()
+		tgBot.storage.Close()
+	})
+	return tgBot, api
+}
+
+// addTestUser adds an approved user with the permissions.
+func addTestUser(t *testing.T, tgBot *TgBot, id int64, permissions ...string) *types.TgUser {
+	t.Helper()
+	user := types.NewTgUser(id, fmt.Sprintf("user%d", id), nil)
+	for _, permission := range permissions {
+		user.Permissions[permission] = true
+	}
+	if err := tgBot.storage.AddTgUser(user); err != nil {
+		t.Fatalf("AddTgUser failed: %v", err)
+	}
+	return user
+}
+
+// privateMessage returns an update with a text message of the user in the private chat.
+func privateMessage(userID int64, text string) *models.Update {
+	return &models.Update{
+		ID: 1,
+		Message: &models.Message{
+			ID:   100,
+			From: &models.User{ID: userID, FirstName: "Test"},
+			Chat: models.Chat{ID: userID, Type: models.ChatTypePrivate},
+			Date: int(time.Now().Unix()),
+			Text: text,
+		},
+	}
+}
+
+func TestDefaultHandler_EditedMessage(t *testing.T) {
+	tgBot, api := newTestBot(t)
+	addTestUser(t, tgBot, 42, types.CanChat)
+
+	update := privateMessage(42, "edited question")
+	update.EditedMessage, update.Message = update.Message, nil
+	assert.NotPanics(t, func() { tgBot.bot.ProcessUpdate(tgBot.context, update) })
+	assert.Empty(t, api.sent("sendMessage"), "edited messages are not answered")
+	assert.NotContains(t, allowedUpdates, models.AllowedUpdateEditedMessage)
+}
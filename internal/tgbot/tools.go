@@ -0,0 +1,211 @@
+package tgbot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gourbot/internal/llm"
+	"gourbot/internal/types"
+)
+
+// maxLookupUsers limits the number of users returned by the lookup_user tool.
+const maxLookupUsers = 10
+
+// toolCaller identifies the user and chat the model is answering while it calls tools.
+type toolCaller struct {
+	user   *types.TgUser
+	chatID int64
+}
+
+type toolCallerKey struct{}
+
+// withToolCaller attaches the caller to the context passed to tool functions.
+func withToolCaller(ctx context.Context, caller *toolCaller) context.Context {
+	return context.WithValue(ctx, toolCallerKey{}, caller)
+}
+
+// callerFrom returns the caller attached with withToolCaller.
+func callerFrom(ctx context.Context) (*toolCaller, error) {
+	caller, ok := ctx.Value(toolCallerKey{}).(*toolCaller)
+	if !ok || caller.user == nil {
+		return nil, fmt.Errorf("unknown caller")
+	}
+	return caller, nil
+}
+
+// newTools creates the registry of tools the model may call.
+func (tgBot *TgBot) newTools() (*llm.ToolRegistry, error) {
+	tools := llm.NewToolRegistry()
+	for _, tool := range []*llm.Tool{
+		{
+			Name:        "current_time",
+			Description: "Returns the current date and time.",
+			Parameters: `{"type": "object", "properties": {
+				"timezone": {"type": "string", "description": "IANA time zone, e.g. Europe/Berlin; the server zone if omitted"}}}`,
+			Permission: types.CanChat,
+			Func:       toolCurrentTime,
+		},
+		{
+			Name:        "calculate",
+			Description: "Evaluates an arithmetic expression with + - * / % ^, parentheses, pi, e and the functions sqrt, abs, round, floor, ceil, ln, log, sin, cos, tan.",
+			Parameters: `{"type": "object", "properties": {
+				"expression": {"type": "string", "description": "The expression, e.g. (2 + 3) * sqrt(16)"}}, "required": ["expression"]}`,
+			Permission: types.CanChat,
+			Func:       toolCalculate,
+		},
+		{
+			Name:        "set_reminder",
+			Description: "Schedules a reminder the bot sends to the current chat, once or repeatedly.",
+			Parameters: `{"type": "object", "properties": {
+				"when": {"type": "string", "description": "When to remind in the user's time zone, in one of the forms: in 10 minutes, in 2h30m, at 18:00, tomorrow at 9, monday at 10:30, on 2026-12-31 at 23:59, every day at 9, every weekday at 8:15, every 2 hours, cron 0 9 * * 1-5"},
+				"text": {"type": "string", "description": "What to remind about"}}, "required": ["when", "text"]}`,
+			Permission: types.CanChat,
+			Func:       tgBot.toolSetReminder,
+		},
+		{
+			Name:        "my_stats",
+			Description: "Returns statistics of the user you are talking to: registration date and money spent on paid API calls.",
+			Parameters:  `{"type": "object", "properties": {}}`,
+			Permission:  types.CanGetStatistics,
+			Func:        tgBot.toolMyStats,
+		},
+		{
+			Name:        "lookup_user",
+			Description: "Finds registered bot users by a part of the name or by Telegram ID.",
+			Parameters: `{"type": "object", "properties": {
+				"query": {"type": "string", "description": "A part of the user name or the Telegram user ID"}}, "required": ["query"]}`,
+			Permission: types.CanGetAllStatistics,
+			Func:       tgBot.toolLookupUser,
+		},
+	} {
+		if err := tools.Register(tool); err != nil {
+			return nil, err
+		}
+	}
+	return tools, nil
+}
+
+// RunTools sends the request to the LLM, letting it call the tools allowed for the user in the chat.
+// Every tool call is recorded in the tool_calls table.
+func (tgBot *TgBot) RunTools(user *types.TgUser, chatID int64, req *llm.ChatRequest, chat llm.ChatFunc) (*llm.Message, error) {
+	if !tgBot.config().ToolsEnabled {
+		return chat(tgBot.context, req)
+	}
+	ctx := withToolCaller(tgBot.context, &toolCaller{user: user, chatID: chatID})
+	tgChat := tgBot.ChatByID(chatID)
+	return tgBot.tools.Run(ctx, req, chat, llm.RunOptions{
+		Allowed: func(permission string) bool {
+			return types.HasAccess(user, tgChat, permission)
+		},
+		MaxSteps: tgBot.config().ToolMaxSteps,
+		OnCall: func(inv *llm.ToolInvocation) {
+			var errMsg string
+			if inv.Err != nil {
+				errMsg = inv.Err.Error()
+				tgBot.logger.Warnf("Tool %s called for user %d failed: %v", inv.Name, user.Id, inv.Err)
+			}
+			call := types.NewToolCall(user.Id, chatID, inv.Name, inv.Arguments, inv.Result, errMsg)
+			if err := tgBot.storage.AddToolCall(call); err != nil {
+				tgBot.logger.Errorf("Failed to record tool call of user %d: %v", user.Id, err)
+			}
+		},
+	})
+}
+
+func toolCurrentTime(_ context.Context, args json.RawMessage) (string, error) {
+	var params struct {
+		Timezone string `json:"timezone"`
+	}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", err
+	}
+	now := time.Now()
+	if params.Timezone != "" {
+		location, err := time.LoadLocation(params.Timezone)
+		if err != nil {
+			return "", fmt.Errorf("unknown time zone %q", params.Timezone)
+		}
+		now = now.In(location)
+	}
+	return now.Format("Monday, 2006-01-02 15:04:05 MST (-07:00)"), nil
+}
+
+func toolCalculate(_ context.Context, args json.RawMessage) (string, error) {
+	var params struct {
+		Expression string `json:"expression"`
+	}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", err
+	}
+	value, err := Calculate(params.Expression)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatFloat(value, 'g', 15, 64), nil
+}
+
+func (tgBot *TgBot) toolMyStats(ctx context.Context, _ json.RawMessage) (string, error) {
+	caller, err := callerFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	user := caller.user
+	today, err := tgBot.storage.GetUserCostSince(user.Id, time.Now().Add(-quotaPeriod))
+	if err != nil {
+		return "", err
+	}
+	total, err := tgBot.storage.GetUserCostSince(user.Id, time.Unix(0, 0))
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Name: %s\n", user.Name)
+	fmt.Fprintf(&sb, "Registered: %s\n", user.CreatedAt.Format("2006-01-02"))
+	fmt.Fprintf(&sb, "Spent in the last 24 hours: $%.4f", today)
+	if tgBot.config().UserDailyQuota > 0 && !user.HasPermission(types.CanEverything) {
+		fmt.Fprintf(&sb, " of $%.2f daily quota", tgBot.config().UserDailyQuota)
+	}
+	fmt.Fprintf(&sb, "\nSpent in total: $%.4f", total)
+	return sb.String(), nil
+}
+
+func (tgBot *TgBot) toolLookupUser(_ context.Context, args json.RawMessage) (string, error) {
+	var params struct {
+		Query string `json:"query"`
+	}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", err
+	}
+	query := strings.ToLower(strings.TrimSpace(params.Query))
+	if query == "" {
+		return "", fmt.Errorf("empty query")
+	}
+	users, err := tgBot.storage.GetAllTgUsers()
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	found := 0
+	for _, user := range users {
+		if strconv.FormatInt(user.Id, 10) != query && !strings.Contains(strings.ToLower(user.Name), query) {
+			continue
+		}
+		if found == maxLookupUsers {
+			sb.WriteString("... more users match, refine the query\n")
+			break
+		}
+		found++
+		fmt.Fprintf(&sb, "%d %s: permissions [%s], registered %s, last seen %s\n", user.Id, user.Name,
+			user.PermissionsToString(), user.CreatedAt.Format("2006-01-02"), user.SeenAt.Format("2006-01-02 15:04"))
+	}
+	if found == 0 {
+		return "No users found.", nil
+	}
+	return sb.String(), nil
+}
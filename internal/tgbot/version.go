@@ -0,0 +1,33 @@
+package tgbot
+
+import (
+	"fmt"
+	"time"
+
+	"gourbot/internal/buildinfo"
+
+	"github.com/go-telegram/bot/models"
+)
+
+// CmdVersion handles the "/version" command which shows the running build and its uptime.
+func (tgBot *TgBot) CmdVersion(update *models.Update) {
+	tgBot.Reply(update, fmt.Sprintf("%s\nUp for %s.", buildinfo.Get(), FormatUptime(time.Since(tgBot.startedAt))))
+}
+
+// FormatUptime formats a duration in days, hours and minutes, e.g. "3d 4h 5m"; durations
+// under a minute are shown in seconds.
+func FormatUptime(d time.Duration) string {
+	if d < time.Minute {
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	}
+	days := int(d / (24 * time.Hour))
+	hours := int(d / time.Hour % 24)
+	minutes := int(d / time.Minute % 60)
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%dd %dh %dm", days, hours, minutes)
+	case hours > 0:
+		return fmt.Sprintf("%dh %dm", hours, minutes)
+	}
+	return fmt.Sprintf("%dm", minutes)
+}
@@ -0,0 +1,15 @@
+package tgbot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatUptime(t *testing.T) {
+	assert.Equal(t, "42s", FormatUptime(42*time.Second))
+	assert.Equal(t, "1m", FormatUptime(time.Minute+30*time.Second))
+	assert.Equal(t, "2h 0m", FormatUptime(2*time.Hour))
+	assert.Equal(t, "3d 4h 5m", FormatUptime(76*time.Hour+5*time.Minute+59*time.Second))
+}
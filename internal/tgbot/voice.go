@@ -0,0 +1,152 @@
+package tgbot
+
+import (
+	"bytes"
+	"mime"
+	"path/filepath"
+	"strings"
+
+	"gourbot/internal/llm"
+	"gourbot/internal/types"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// maxSpeechInput is the API limit for the text of a single speech request.
+const maxSpeechInput = 4096
+
+// audioExtensions maps audio MIME types to file extensions understood by the transcription API.
+var audioExtensions = map[string]string{
+	"audio/ogg":   ".ogg",
+	"audio/opus":  ".ogg",
+	"audio/mpeg":  ".mp3",
+	"audio/mp3":   ".mp3",
+	"audio/mp4":   ".m4a",
+	"audio/x-m4a": ".m4a",
+	"audio/wav":   ".wav",
+	"audio/x-wav": ".wav",
+	"audio/webm":  ".webm",
+	"audio/flac":  ".flac",
+}
+
+// AudioFilename chooses a filename with an extension the transcription API recognizes.
+func AudioFilename(filename, mimeType string) string {
+	if filename != "" && filepath.Ext(filename) != "" {
+		return filename
+	}
+	mediaType, _, _ := mime.ParseMediaType(mimeType)
+	if ext, ok := audioExtensions[mediaType]; ok {
+		return "audio" + ext
+	}
+	return "audio.mp3"
+}
+
+// VoiceHandler transcribes a voice note or audio file and answers it like a text message.
+func (tgBot *TgBot) VoiceHandler(update *models.Update) {
+	user := tgBot.UserWithPermission(update, types.CanUseSound)
+	if user == nil {
+		return
+	}
+	openai := tgBot.registry().OpenAI()
+	if openai == nil {
+		tgBot.Reply(update, "Voice messages require the OpenAI provider, which is not configured.")
+		return
+	}
+	if ok, message := tgBot.CheckQuota(user); !ok {
+		tgBot.Reply(update, message)
+		return
+	}
+
+	var fileID, filename string
+	var duration int
+	if voice := update.Message.Voice; voice != nil {
+		fileID, duration, filename = voice.FileID, voice.Duration, "voice.ogg"
+	} else {
+		audio := update.Message.Audio
+		fileID, duration, filename = audio.FileID, audio.Duration, AudioFilename(audio.FileName, audio.MimeType)
+	}
+
+	stopTyping := tgBot.KeepChatAction(update.Message.Chat.ID, models.ChatActionTyping)
+	data, err := tgBot.DownloadFile(fileID)
+	if err != nil {
+		stopTyping()
+		tgBot.logger.Errorf("Failed to download audio: %v", err)
+		tgBot.Reply(update, "Failed to download the audio.")
+		return
+	}
+	text, err := openai.Transcribe(tgBot.context, tgBot.config().TranscribeModel, data, filename)
+	stopTyping()
+	if err != nil {
+		tgBot.logger.Errorf("Transcription failed: %v", err)
+		tgBot.Notify(types.NotifyError, "Transcription failed: "+err.Error())
+		tgBot.Reply(update, "Failed to transcribe: "+err.Error())
+		return
+	}
+	tgBot.ChargeUsage(user.Id, types.UsageAudio, tgBot.config().TranscribeModel, llm.TranscriptionPrice(duration))
+
+	text = strings.TrimSpace(text)
+	if text == "" {
+		tgBot.Reply(update, "No speech recognized.")
+		return
+	}
+	tgBot.Reply(update, "Heard: "+TruncateMessage(text, maxMessageLength-len("Heard: ")))
+
+	answer, err := tgBot.Answer(update, text)
+	if err != nil || user.GetSetting(types.SettingVoiceReplies) != "on" {
+		return
+	}
+	tgBot.ReplyVoice(openai, update, user, answer)
+}
+
+// ReplyVoice synthesizes the text and sends it as a voice message replying to the update's message.
+func (tgBot *TgBot) ReplyVoice(openai *llm.OpenAI, update *models.Update, user *types.TgUser, text string) {
+	text = TruncateMessage(text, maxSpeechInput)
+	stopAction := tgBot.KeepChatAction(update.Message.Chat.ID, models.ChatActionRecordVoice)
+	audio, err := openai.Speech(tgBot.context, tgBot.config().SpeechModel, tgBot.config().SpeechVoice, text)
+	stopAction()
+	if err != nil {
+		tgBot.logger.Errorf("Speech synthesis failed: %v", err)
+		tgBot.Notify(types.NotifyError, "Speech synthesis failed: "+err.Error())
+		return
+	}
+	tgBot.ChargeUsage(user.Id, types.UsageAudio, tgBot.config().SpeechModel, llm.SpeechPrice(text))
+
+	tgBot.SendVoice(&bot.SendVoiceParams{
+		ChatID:          update.Message.Chat.ID,
+		MessageThreadID: TopicOf(update.Message),
+		Voice:           &models.InputFileUpload{Filename: "answer.ogg", Data: bytes.NewReader(audio)},
+		ReplyParameters: &models.ReplyParameters{MessageID: update.Message.ID},
+	})
+}
+
+// CmdVoice handles the "/voice" command which toggles spoken replies to voice messages.
+func (tgBot *TgBot) CmdVoice(update *models.Update) {
+	user := tgBot.UserWithPermission(update, types.CanUseSound)
+	if user == nil {
+		return
+	}
+
+	switch arg := strings.ToLower(CommandArgs(update.Message.Text)); arg {
+	case "on", "off":
+		value := arg
+		if value == "off" {
+			value = "" // Text-only replies are the default
+		}
+		user.SetSetting(types.SettingVoiceReplies, value)
+		if err := tgBot.storage.UpdateTgUser(user); err != nil {
+			tgBot.logger.Errorf("Failed to update user: %v", err)
+			tgBot.Reply(update, "Failed to save the setting.")
+			return
+		}
+		tgBot.Reply(update, "Voice replies are "+arg+".")
+	case "":
+		state := "off"
+		if user.GetSetting(types.SettingVoiceReplies) == "on" {
+			state = "on"
+		}
+		tgBot.Reply(update, "Voice replies are "+state+". Use /voice on or /voice off to change.")
+	default:
+		tgBot.Reply(update, "Usage: /voice [on|off]")
+	}
+}
@@ -0,0 +1,15 @@
+package tgbot
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAudioFilename(t *testing.T) {
+	assert.Equal(t, "song.flac", AudioFilename("song.flac", "audio/flac"))
+	assert.Equal(t, "audio.mp3", AudioFilename("song", "audio/mpeg"))
+	assert.Equal(t, "audio.m4a", AudioFilename("", "audio/x-m4a"))
+	assert.Equal(t, "audio.ogg", AudioFilename("", "audio/ogg; codecs=opus"))
+	assert.Equal(t, "audio.mp3", AudioFilename("", "application/octet-stream"))
+}
@@ -0,0 +1,55 @@
+package types
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Dialog is the state of a multi-step conversation of a user with the bot in a chat.
+// A user has at most one dialog per chat.
+type Dialog struct {
+	ChatId    int64             // Telegram chat ID the dialog runs in, stored as INTEGER in the database
+	UserId    int64             // Telegram user ID answering the questions, stored as INTEGER in the database
+	Name      string            // Name of the registered dialog, stored as TEXT in the database
+	Step      string            // Step awaiting the next answer, stored as TEXT in the database
+	Data      map[string]string // Answers collected so far, stored as TEXT (JSON) in the database
+	ExpiresAt time.Time         // When the dialog times out, stored as INTEGER (Unix time) in the database
+	UpdatedAt time.Time         // When the dialog last advanced, stored as INTEGER (Unix time) in the database
+}
+
+// NewDialog creates a Dialog at its first step which times out after the timeout.
+func NewDialog(chatId, userId int64, name, step string, timeout time.Duration) *Dialog {
+	now := time.Now()
+	return &Dialog{
+		ChatId:    chatId,
+		UserId:    userId,
+		Name:      name,
+		Step:      step,
+		Data:      make(map[string]string),
+		ExpiresAt: now.Add(timeout),
+		UpdatedAt: now,
+	}
+}
+
+// Expired reports whether the dialog has timed out.
+func (d *Dialog) Expired() bool {
+	return !time.Now().Before(d.ExpiresAt)
+}
+
+// DataToString encodes the collected answers for storage.
+func (d *Dialog) DataToString() string {
+	if len(d.Data) == 0 {
+		return "{}"
+	}
+	blob, _ := json.Marshal(d.Data)
+	return string(blob)
+}
+
+// DataFromString decodes the collected answers read from storage.
+func (d *Dialog) DataFromString(s string) error {
+	d.Data = make(map[string]string)
+	if s == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(s), &d.Data)
+}
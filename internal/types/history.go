@@ -0,0 +1,37 @@
+package types
+
+import "time"
+
+// HistoryMessage is a single turn of a chat conversation remembered for the LLM.
+type HistoryMessage struct {
+	Id        int64     // Unique identifier, increasing with time, stored as INTEGER in the database
+	ChatId    int64     // Telegram chat ID of the conversation, stored as INTEGER in the database
+	ThreadId  int       // Forum topic of the conversation, 0 for the whole chat, stored as INTEGER in the database
+	UserId    int64     // Telegram user ID who asked or was answered, stored as INTEGER in the database
+	Role      string    // LLM role of the message ("user" or "assistant"), stored as TEXT in the database
+	Content   string    // Text of the message, stored as TEXT in the database
+	Tokens    int       // Estimated number of tokens of the message, stored as INTEGER in the database
+	CreatedAt time.Time // When the message was sent, stored as INTEGER (Unix time) in the database
+}
+
+// NewHistoryMessage creates a HistoryMessage timestamped with the current time.
+func NewHistoryMessage(chatId int64, threadId int, userId int64, role, content string, tokens int) *HistoryMessage {
+	return &HistoryMessage{
+		ChatId:    chatId,
+		ThreadId:  threadId,
+		UserId:    userId,
+		Role:      role,
+		Content:   content,
+		Tokens:    tokens,
+		CreatedAt: time.Now(),
+	}
+}
+
+// Summary is the rolling summary of the older part of a chat conversation.
+type Summary struct {
+	ChatId    int64     // Telegram chat ID of the conversation, stored as INTEGER in the database
+	ThreadId  int       // Forum topic of the conversation, 0 for the whole chat, stored as INTEGER in the database
+	Text      string    // Summary of the turns no longer kept verbatim, stored as TEXT in the database
+	Tokens    int       // Estimated number of tokens of the summary, stored as INTEGER in the database
+	UpdatedAt time.Time // When the summary was last rewritten, stored as INTEGER (Unix time) in the database
+}
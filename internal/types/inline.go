@@ -0,0 +1,30 @@
+package types
+
+import "time"
+
+// InlineAnswer is an LLM answer offered to an inline query. It doubles as the cache of
+// inline answers; its cost is charged to the user when it is generated.
+type InlineAnswer struct {
+	Id         int64     // Unique identifier used as the inline result ID, stored as INTEGER in the database
+	UserId     int64     // Telegram user ID who asked, stored as INTEGER in the database
+	Query      string    // Text of the inline query, stored as TEXT in the database
+	Model      string    // Model which answered, stored as TEXT in the database
+	PromptHash string    // Hash of the system prompt and settings of the persona, stored as TEXT in the database
+	Answer     string    // Text of the answer, stored as TEXT in the database
+	Cost       float64   // Estimated cost of the answer in USD, 0 if reused from the cache, stored as REAL in the database
+	CreatedAt  time.Time // When the answer was generated, stored as INTEGER (Unix time) in the database
+	ChosenAt   time.Time // When the answer was last sent, zero if never, stored as INTEGER (Unix time, 0 if never) in the database
+}
+
+// NewInlineAnswer creates an InlineAnswer timestamped with the current time.
+func NewInlineAnswer(userId int64, query, model, promptHash, answer string, cost float64) *InlineAnswer {
+	return &InlineAnswer{
+		UserId:     userId,
+		Query:      query,
+		Model:      model,
+		PromptHash: promptHash,
+		Answer:     answer,
+		Cost:       cost,
+		CreatedAt:  time.Now(),
+	}
+}
@@ -0,0 +1,46 @@
+package types
+
+import "time"
+
+// Job kinds handled by the scheduler.
+const (
+	JobReminder = "reminder"
+	JobDigest   = "digest" // Sends the collected notifications to their recipients
+	JobBackup   = "backup" // Backs the database up and deletes the oldest backups
+)
+
+// Job is a scheduled delivery, either one-shot or recurring.
+type Job struct {
+	Id        int64     // Unique identifier, stored as INTEGER in the database
+	Kind      string    // Kind of the job selecting its handler (JobReminder, ...), stored as TEXT in the database
+	UserId    int64     // Telegram user ID who scheduled the job, stored as INTEGER in the database
+	ChatId    int64     // Telegram chat ID to deliver to, stored as INTEGER in the database
+	ThreadId  int       // Forum topic to deliver to, 0 for the whole chat, stored as INTEGER in the database
+	Text      string    // Payload of the job, e.g. the reminder text, stored as TEXT in the database
+	Cron      string    // Recurrence as a cron expression, empty for one-shot jobs, stored as TEXT in the database
+	Timezone  string    // IANA time zone the recurrence is computed in, stored as TEXT in the database
+	NextRunAt time.Time // When the job is due, stored as INTEGER (Unix time) in the database
+	LastRunAt time.Time // When the job last ran, zero if never, stored as INTEGER (Unix time, 0 if never) in the database
+	Attempts  int       // Failed runs in a row, stored as INTEGER in the database
+	CreatedAt time.Time // When the job was scheduled, stored as INTEGER (Unix time) in the database
+}
+
+// NewJob creates a Job timestamped with the current time.
+func NewJob(kind string, userId, chatId int64, threadId int, text, cron, timezone string, nextRunAt time.Time) *Job {
+	return &Job{
+		Kind:      kind,
+		UserId:    userId,
+		ChatId:    chatId,
+		ThreadId:  threadId,
+		Text:      text,
+		Cron:      cron,
+		Timezone:  timezone,
+		NextRunAt: nextRunAt,
+		CreatedAt: time.Now(),
+	}
+}
+
+// Recurring reports whether the job runs repeatedly.
+func (j *Job) Recurring() bool {
+	return j.Cron != ""
+}
@@ -0,0 +1,36 @@
+package types
+
+import "time"
+
+// MembershipChange records a transition of a chat member's status, e.g. the bot being
+// added to a group or a user blocking the bot.
+type MembershipChange struct {
+	Id        int64     // Unique identifier, stored as INTEGER in the database
+	ChatId    int64     // Telegram chat ID, stored as INTEGER in the database
+	UserId    int64     // Telegram user ID of the member whose status changed, stored as INTEGER in the database
+	ChangedBy int64     // Telegram user ID of who made the change, stored as INTEGER in the database
+	OldStatus string    // Status before the change (StatusMember, StatusLeft, ...), stored as TEXT in the database
+	NewStatus string    // Status after the change, stored as TEXT in the database
+	CreatedAt time.Time // When the change happened, stored as INTEGER (Unix time) in the database
+}
+
+// NewMembershipChange creates a MembershipChange timestamped with the current time.
+func NewMembershipChange(chatId, userId, changedBy int64, oldStatus, newStatus string) *MembershipChange {
+	return &MembershipChange{
+		ChatId:    chatId,
+		UserId:    userId,
+		ChangedBy: changedBy,
+		OldStatus: oldStatus,
+		NewStatus: newStatus,
+		CreatedAt: time.Now(),
+	}
+}
+
+// IsPresentStatus reports whether a member with the status is in the chat.
+func IsPresentStatus(status string) bool {
+	switch status {
+	case StatusOwner, StatusAdministrator, StatusMember, StatusRestricted:
+		return true
+	}
+	return false
+}
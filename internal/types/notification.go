@@ -0,0 +1,67 @@
+package types
+
+import "time"
+
+// Notification categories of the events sent to the masters and admins.
+const (
+	NotifyLifecycle = "lifecycle" // The bot started, stops or reloaded its configuration
+	NotifyNewUser   = "new_user"  // A new user or chat showed up
+	NotifyError     = "error"     // Something failed which needs a look
+	NotifyQuota     = "quota"     // A user exceeded the daily quota
+	NotifySecurity  = "security"  // Refused commands, permission changes, the bot added to or removed from chats
+)
+
+// NotifyCategories lists the notification categories in the order they are shown.
+var NotifyCategories = []string{NotifyLifecycle, NotifyNewUser, NotifyError, NotifyQuota, NotifySecurity}
+
+// Delivery modes of a notification category.
+const (
+	NotifyInstant = "instant" // Sent right away
+	NotifyDigest  = "digest"  // Collected and sent in the periodic digest
+	NotifyOff     = "off"
+)
+
+// NotifyModes lists the delivery modes.
+var NotifyModes = []string{NotifyInstant, NotifyDigest, NotifyOff}
+
+// notifyDefaults are the delivery modes of the categories nobody chose a mode for; the
+// frequent, low-priority events go to the digest.
+var notifyDefaults = map[string]string{
+	NotifyQuota: NotifyDigest,
+}
+
+// NotifySetting returns the key of the user or chat setting holding the delivery mode of
+// the category.
+func NotifySetting(category string) string {
+	return "notify_" + category
+}
+
+// NotifyMode returns the delivery mode of the category given the user or chat setting.
+func NotifyMode(category, setting string) string {
+	if setting != "" {
+		return setting
+	}
+	if mode, ok := notifyDefaults[category]; ok {
+		return mode
+	}
+	return NotifyInstant
+}
+
+// Notification is an event waiting for the next digest of a recipient.
+type Notification struct {
+	Id        int64     // Unique identifier, stored as INTEGER in the database
+	ChatId    int64     // Recipient, a master, an admin or the admin group, stored as INTEGER in the database
+	Category  string    // Category of the event (NotifyError, ...), stored as TEXT in the database
+	Text      string    // Message of the event, stored as TEXT in the database
+	CreatedAt time.Time // When the event happened, stored as INTEGER (Unix time) in the database
+}
+
+// NewNotification creates a Notification timestamped with the current time.
+func NewNotification(chatId int64, category, text string) *Notification {
+	return &Notification{
+		ChatId:    chatId,
+		Category:  category,
+		Text:      text,
+		CreatedAt: time.Now(),
+	}
+}
@@ -0,0 +1,39 @@
+package types
+
+import (
+	"fmt"
+	"time"
+)
+
+// Persona is a named system prompt with model parameters the bot can act as.
+type Persona struct {
+	Id           int64     // Unique identifier, stored as INTEGER in the database
+	Name         string    // Unique short name used in commands, stored as TEXT in the database
+	SystemPrompt string    // System prompt prepended to every LLM request, stored as TEXT in the database
+	Model        string    // Model override, empty means the default model, stored as TEXT in the database
+	Temperature  *float64  // Temperature override, nil means the model default, stored as REAL (nullable) in the database
+	CreatedBy    int64     // Telegram user ID of the author, stored as INTEGER in the database
+	CreatedAt    time.Time // When the persona was created, stored as INTEGER (Unix time) in the database
+}
+
+// NewPersona creates a Persona authored by the given user.
+func NewPersona(name, systemPrompt string, createdBy int64) *Persona {
+	return &Persona{
+		Name:         name,
+		SystemPrompt: systemPrompt,
+		CreatedBy:    createdBy,
+		CreatedAt:    time.Now(),
+	}
+}
+
+// Describe returns a one-line summary of the persona's model parameters.
+func (p *Persona) Describe() string {
+	model := p.Model
+	if model == "" {
+		model = "default model"
+	}
+	if p.Temperature == nil {
+		return fmt.Sprintf("%s (%s)", p.Name, model)
+	}
+	return fmt.Sprintf("%s (%s, temperature %.2g)", p.Name, model, *p.Temperature)
+}
@@ -0,0 +1,129 @@
+package types
+
+import (
+	"fmt"
+	"time"
+)
+
+// TgChat represents a Telegram chat the bot has seen: a private chat, a group or a channel.
+type TgChat struct {
+	Id          int64             // Unique identifier from Telegram API, stored as INTEGER in the database
+	Type        string            // Chat type ("private", "group", "supergroup", "channel"), stored as TEXT in the database
+	Title       string            // Title of the group or name of the private chat, stored as TEXT in the database
+	CreatedAt   time.Time         // When the chat was first seen, stored as INTEGER (Unix time) in the database
+	SeenAt      time.Time         // When the chat was last seen, stored as INTEGER (Unix time) in the database
+	Permissions map[string]bool   // Permissions granted to everybody in the chat, stored as TEXT (comma-separated) in the database
+	Settings    map[string]string // Chat preferences, stored as TEXT (JSON object) in the database
+	Status      string            // The bot's membership status in the chat, empty if unknown, stored as TEXT in the database
+}
+
+// Membership statuses reported by Telegram.
+const (
+	StatusOwner         = "creator"
+	StatusAdministrator = "administrator"
+	StatusMember        = "member"
+	StatusRestricted    = "restricted"
+	StatusLeft          = "left"
+	StatusKicked        = "kicked" // In private chats: the user blocked the bot
+)
+
+// NewTgChat creates a TgChat with empty permissions and settings.
+func NewTgChat(id int64, chatType, title string) *TgChat {
+	return &TgChat{
+		Id:          id,
+		Type:        chatType,
+		Title:       title,
+		CreatedAt:   time.Now(),
+		SeenAt:      time.Now(),
+		Permissions: make(map[string]bool),
+		Settings:    make(map[string]string),
+	}
+}
+
+// AddPermissionsFromString parses a comma-separated string and adds permissions to the chat.
+func (c *TgChat) AddPermissionsFromString(permissions string) {
+	if c.Permissions == nil {
+		c.Permissions = make(map[string]bool)
+	}
+	addPermissionsFromString(c.Permissions, permissions)
+}
+
+// PermissionsToString converts the chat's permissions to a comma-separated string.
+func (c *TgChat) PermissionsToString() string {
+	return permissionsToString(c.Permissions)
+}
+
+// AddPermission grants a permission to everybody in the chat.
+func (c *TgChat) AddPermission(permission string) {
+	if c.Permissions == nil {
+		c.Permissions = make(map[string]bool)
+	}
+	c.Permissions[permission] = true
+}
+
+// RemovePermission removes a single permission from the chat.
+func (c *TgChat) RemovePermission(permission string) {
+	if c.Permissions != nil {
+		delete(c.Permissions, permission)
+	}
+}
+
+// ClearPermissions removes all permissions from the chat.
+func (c *TgChat) ClearPermissions() {
+	c.Permissions = make(map[string]bool)
+}
+
+// HasPermission checks if the chat has the permission. Unlike for users, CanEverything
+// is not a wildcard here: a chat cannot make all its members masters.
+func (c *TgChat) HasPermission(permission string) bool {
+	return c.Permissions[permission]
+}
+
+// GetSetting returns the value of a chat setting or an empty string if it is not set.
+func (c *TgChat) GetSetting(key string) string {
+	return c.Settings[key]
+}
+
+// SetSetting sets a chat setting; an empty value removes it.
+func (c *TgChat) SetSetting(key, value string) {
+	if c.Settings == nil {
+		c.Settings = make(map[string]string)
+	}
+	if value == "" {
+		delete(c.Settings, key)
+		return
+	}
+	c.Settings[key] = value
+}
+
+// SettingsToString serializes the chat's settings to a JSON object.
+func (c *TgChat) SettingsToString() string {
+	return settingsToString(c.Settings)
+}
+
+// SetSettingsFromString replaces the chat's settings with the ones parsed from a JSON object.
+// Malformed input leaves the settings empty.
+func (c *TgChat) SetSettingsFromString(settings string) {
+	c.Settings = settingsFromString(settings)
+}
+
+// BotRemoved reports whether the bot has left or was removed from the chat, or, for
+// private chats, whether the user blocked the bot. Messages cannot be sent there.
+func (c *TgChat) BotRemoved() bool {
+	return c.Status == StatusLeft || c.Status == StatusKicked
+}
+
+// String formats the TgChat fields into a human-readable string.
+func (c *TgChat) String() string {
+	return fmt.Sprintf("TgChat{Id: %d, Type: %q, Title: %q, CreatedAt: %q, SeenAt: %q, Permissions: \"[%s]\", Status: %q}",
+		c.Id, c.Type, c.Title, c.CreatedAt.Format(time.RFC3339), c.SeenAt.Format(time.RFC3339), c.PermissionsToString(), c.Status)
+}
+
+// HasAccess evaluates a permission for a user in a chat: it is granted if the user has it,
+// or if the chat grants it to everybody in it. The chat may be nil if it is unknown.
+func HasAccess(user *TgUser, chat *TgChat, permission string) bool {
+	if user != nil && user.HasPermission(permission) {
+		return true
+	}
+	return chat != nil && chat.HasPermission(permission)
+}
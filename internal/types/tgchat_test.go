@@ -0,0 +1,54 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTgChat_Permissions(t *testing.T) {
+	chat := NewTgChat(-100, "group", "Family")
+	assert.Equal(t, "group", chat.Type)
+	assert.Empty(t, chat.PermissionsToString(), "new chat should have no permissions")
+
+	chat.AddPermissionsFromString("CanChat, CanDraw")
+	assert.Equal(t, "CanChat,CanDraw", chat.PermissionsToString())
+	chat.RemovePermission(CanDraw)
+	assert.False(t, chat.HasPermission(CanDraw))
+
+	chat.AddPermission(CanEverything)
+	assert.False(t, chat.HasPermission(CanUseSound), "CanEverything is not a wildcard for chats")
+
+	chat.ClearPermissions()
+	assert.False(t, chat.HasPermission(CanChat))
+}
+
+func TestTgChat_Settings(t *testing.T) {
+	chat := NewTgChat(-100, "group", "Family")
+	assert.Equal(t, "{}", chat.SettingsToString())
+
+	chat.SetSetting(SettingModel, "openai/gpt-4o")
+	chat.SetSetting(SettingEnabled, "off")
+	chat.SetSetting(SettingEnabled, "")
+	assert.Equal(t, `{"model":"openai/gpt-4o"}`, chat.SettingsToString())
+
+	chat.SetSettingsFromString("not json")
+	assert.Empty(t, chat.Settings, "malformed settings should be dropped")
+}
+
+func TestHasAccess(t *testing.T) {
+	user := NewTgUser(1, "user", nil)
+	chat := NewTgChat(-100, "group", "Family")
+
+	assert.False(t, HasAccess(user, chat, CanChat))
+	assert.False(t, HasAccess(user, nil, CanChat))
+
+	chat.AddPermission(CanChat)
+	assert.True(t, HasAccess(user, chat, CanChat), "chat permissions apply to its members")
+	assert.False(t, HasAccess(user, nil, CanChat), "chat permissions do not apply elsewhere")
+
+	user.AddPermission(CanDraw)
+	assert.True(t, HasAccess(user, chat, CanDraw))
+	assert.True(t, HasAccess(user, nil, CanDraw))
+	assert.False(t, HasAccess(nil, nil, CanDraw))
+}
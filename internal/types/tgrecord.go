@@ -0,0 +1,9 @@
+package types
+
+// TgRecord is an update received from Telegram or a message sent by the bot, as recorded
+// in the tgdump table.
+type TgRecord struct {
+	Uid  int64  // Unique identifier in the order of recording, stored as INTEGER in the database
+	Out  bool   // Whether the bot sent the message, stored as BOOLEAN in the database
+	Data []byte // JSON of the models.Update received or the models.Message sent, stored as TEXT in the database
+}
@@ -1,6 +1,7 @@
 package types
 
 import (
+	"encoding/json"
 	"fmt"
 	"sort"
 	"strings"
@@ -17,18 +18,36 @@ const (
 	CanManageRoles      = "CanManageRoles"
 	CanGetStatistics    = "CanGetStatistics"
 	CanGetAllStatistics = "CanGetAllStatistics"
+	CanManageUsers      = "CanManageUsers" // Approve and revoke users and chats
+	CanStopBot          = "CanStopBot"
 )
 
+// KnownPermissions lists all permissions the bot checks.
+var KnownPermissions = []string{
+	CanEverything, CanChat, CanDraw, CanUseSound, CanUseRoles, CanManageRoles, CanGetStatistics, CanGetAllStatistics,
+	CanManageUsers, CanStopBot,
+}
+
 // TgUser represents a Telegram user.
 type TgUser struct {
-	Id          int64           // Unique identifier from Telegram API, stored as INTEGER in the database
-	Name        string          // Name or nickname of the user, stored as TEXT in the database
-	CreatedAt   time.Time       // When the user was first seen, stored as INTEGER (Unix time) in the database
-	SeenAt      time.Time       // When the user was last seen, stored as INTEGER (Unix time) in the database
-	Permissions map[string]bool // Set of permissions for the user, stored as TEXT (comma-separated) in the database
-	Info        []byte          // Additional information about the user record, stored as TEXT in the database
+	Id          int64             // Unique identifier from Telegram API, stored as INTEGER in the database
+	Name        string            // Name or nickname of the user, stored as TEXT in the database
+	CreatedAt   time.Time         // When the user was first seen, stored as INTEGER (Unix time) in the database
+	SeenAt      time.Time         // When the user was last seen, stored as INTEGER (Unix time) in the database
+	Permissions map[string]bool   // Set of permissions for the user, stored as TEXT (comma-separated) in the database
+	Info        []byte            // Additional information about the user record, stored as TEXT in the database
+	Settings    map[string]string // User preferences, stored as TEXT (JSON object) in the database
 }
 
+// Setting keys for TgUser and chat settings.
+const (
+	SettingVoiceReplies = "voice_replies"
+	SettingModel        = "model"
+	SettingTimezone     = "timezone" // IANA time zone of reminders
+	SettingEnabled      = "enabled"  // Chat setting: "off" when group admins disabled the bot
+	SettingThreads      = "threads"  // Chat setting: "off" to share one conversation among forum topics
+)
+
 // Constructor for TgUser that initializes Permissions as an empty map.
 func NewTgUser(id int64, name string, info []byte) *TgUser {
 	return &TgUser{
@@ -38,6 +57,7 @@ func NewTgUser(id int64, name string, info []byte) *TgUser {
 		SeenAt:      time.Now(),
 		Permissions: make(map[string]bool),
 		Info:        info,
+		Settings:    make(map[string]string),
 	}
 }
 
@@ -51,23 +71,12 @@ func (u *TgUser) AddPermissionsFromString(permissions string) {
 	if u.Permissions == nil {
 		u.Permissions = make(map[string]bool)
 	}
-	for _, perm := range strings.Split(permissions, ",") {
-		perm = strings.TrimSpace(perm)
-		if perm == "" {
-			continue // Skip empty permissions
-		}
-		u.Permissions[perm] = true
-	}
+	addPermissionsFromString(u.Permissions, permissions)
 }
 
 // PermissionsToString converts the user's permissions to a comma-separated string.
 func (u *TgUser) PermissionsToString() string {
-	var perms []string
-	for perm := range u.Permissions {
-		perms = append(perms, perm)
-	}
-	sort.Strings(perms) // Ensure permissions are sorted alphabetically
-	return strings.Join(perms, ",")
+	return permissionsToString(u.Permissions)
 }
 
 // AddPermission adds a single permission to the user.
@@ -93,6 +102,34 @@ func (u *TgUser) HasPermission(permission string) bool {
 	return u.Permissions[CanEverything] || u.Permissions[permission]
 }
 
+// GetSetting returns the value of a user setting or an empty string if it is not set.
+func (u *TgUser) GetSetting(key string) string {
+	return u.Settings[key]
+}
+
+// SetSetting sets a user setting; an empty value removes it.
+func (u *TgUser) SetSetting(key, value string) {
+	if u.Settings == nil {
+		u.Settings = make(map[string]string)
+	}
+	if value == "" {
+		delete(u.Settings, key)
+		return
+	}
+	u.Settings[key] = value
+}
+
+// SettingsToString serializes the user's settings to a JSON object.
+func (u *TgUser) SettingsToString() string {
+	return settingsToString(u.Settings)
+}
+
+// SetSettingsFromString replaces the user's settings with the ones parsed from a JSON object.
+// Malformed input leaves the settings empty.
+func (u *TgUser) SetSettingsFromString(settings string) {
+	u.Settings = settingsFromString(settings)
+}
+
 // String formats the TgUser fields into a human-readable string.
 // - Id: Displayed as is.
 // - Name: Quoted string.
@@ -109,3 +146,45 @@ func (u *TgUser) String() string {
 	return fmt.Sprintf("TgUser{Id: %d, Name: %q, CreatedAt: %q, SeenAt: %q, Permissions: %q, Info: %q}",
 		u.Id, u.Name, u.CreatedAt.Format(time.RFC3339), u.SeenAt.Format(time.RFC3339), permissions, u.Info)
 }
+
+// addPermissionsFromString parses a comma-separated string and adds the permissions to the set.
+func addPermissionsFromString(set map[string]bool, permissions string) {
+	for _, perm := range strings.Split(permissions, ",") {
+		perm = strings.TrimSpace(perm)
+		if perm == "" {
+			continue // Skip empty permissions
+		}
+		set[perm] = true
+	}
+}
+
+// permissionsToString converts a set of permissions to a sorted comma-separated string.
+func permissionsToString(set map[string]bool) string {
+	var perms []string
+	for perm := range set {
+		perms = append(perms, perm)
+	}
+	sort.Strings(perms) // Ensure permissions are sorted alphabetically
+	return strings.Join(perms, ",")
+}
+
+// settingsToString serializes settings to a JSON object.
+func settingsToString(settings map[string]string) string {
+	if len(settings) == 0 {
+		return "{}"
+	}
+	data, _ := json.Marshal(settings) // A map of strings always marshals
+	return string(data)
+}
+
+// settingsFromString parses settings from a JSON object; malformed input gives empty settings.
+func settingsFromString(data string) map[string]string {
+	settings := make(map[string]string)
+	if data == "" {
+		return settings
+	}
+	if err := json.Unmarshal([]byte(data), &settings); err != nil {
+		return make(map[string]string)
+	}
+	return settings
+}
@@ -71,3 +71,21 @@ func TestTgUser_String(t *testing.T) {
 
 	assert.Equal(t, expected, user.String(), "String method output mismatch")
 }
+
+func TestTgUser_Settings(t *testing.T) {
+	user := NewTgUser(12345, "TestUser", nil)
+	assert.Equal(t, "{}", user.SettingsToString(), "empty settings should serialize to an empty object")
+
+	user.SetSetting(SettingVoiceReplies, "on")
+	assert.Equal(t, "on", user.GetSetting(SettingVoiceReplies), "setting should be stored")
+	assert.Equal(t, `{"voice_replies":"on"}`, user.SettingsToString(), "settings string mismatch")
+
+	user.SetSetting(SettingVoiceReplies, "")
+	assert.Equal(t, "", user.GetSetting(SettingVoiceReplies), "empty value should remove the setting")
+
+	user.SetSettingsFromString(`{"a":"1","b":"2"}`)
+	assert.Equal(t, map[string]string{"a": "1", "b": "2"}, user.Settings, "settings should be parsed")
+
+	user.SetSettingsFromString("not json")
+	assert.Empty(t, user.Settings, "malformed settings should be dropped")
+}
@@ -0,0 +1,28 @@
+package types
+
+import "time"
+
+// ToolCall is an audit record of a tool the LLM called on behalf of a user.
+type ToolCall struct {
+	Id        int64     // Unique identifier, stored as INTEGER in the database
+	UserId    int64     // Telegram user ID the model was answering, stored as INTEGER in the database
+	ChatId    int64     // Telegram chat ID the conversation happened in, stored as INTEGER in the database
+	Tool      string    // Name of the called tool, stored as TEXT in the database
+	Arguments string    // JSON-encoded arguments passed by the model, stored as TEXT in the database
+	Result    string    // Result returned to the model, stored as TEXT in the database
+	Error     string    // Error message if the call failed, stored as TEXT in the database
+	CreatedAt time.Time // When the call was made, stored as INTEGER (Unix time) in the database
+}
+
+// NewToolCall creates a ToolCall record timestamped with the current time.
+func NewToolCall(userId, chatId int64, tool, arguments, result, errMsg string) *ToolCall {
+	return &ToolCall{
+		UserId:    userId,
+		ChatId:    chatId,
+		Tool:      tool,
+		Arguments: arguments,
+		Result:    result,
+		Error:     errMsg,
+		CreatedAt: time.Now(),
+	}
+}
@@ -0,0 +1,31 @@
+package types
+
+import "time"
+
+// Usage kinds recorded in the usage table.
+const (
+	UsageChat  = "chat"
+	UsageImage = "image"
+	UsageAudio = "audio"
+)
+
+// Usage represents a single paid API call made on behalf of a user.
+type Usage struct {
+	Id        int64     // Unique identifier, stored as INTEGER in the database
+	UserId    int64     // Telegram user ID the cost is charged to, stored as INTEGER in the database
+	Kind      string    // Kind of the API call (UsageChat, UsageImage, ...), stored as TEXT in the database
+	Model     string    // Model used for the call, stored as TEXT in the database
+	Cost      float64   // Estimated cost in USD, stored as REAL in the database
+	CreatedAt time.Time // When the call was made, stored as INTEGER (Unix time) in the database
+}
+
+// NewUsage creates a Usage record timestamped with the current time.
+func NewUsage(userId int64, kind, model string, cost float64) *Usage {
+	return &Usage{
+		UserId:    userId,
+		Kind:      kind,
+		Model:     model,
+		Cost:      cost,
+		CreatedAt: time.Now(),
+	}
+}